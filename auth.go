@@ -0,0 +1,575 @@
+package geecache
+
+import (
+	pb "GeeCache/geecache/geecachepb"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 认证与授权
+// server通过SetAuth开启认证 每个rpc先由Authenticator确定调用方的Identity
+// 再按目标Group的ACL检查权限 失败分别返回Unauthenticated与PermissionDenied
+// 节点之间的请求同样需要认证 因此各节点需通过SetSigner(或mTLS证书)表明自己的身份
+
+// Identity 通过认证的调用方
+type Identity struct {
+	Name   string
+	Method string // 认证方式 如"bearer" "hmac" "mtls"
+}
+
+// Authenticator 从rpc的context中认证调用方
+// 请求中没有该方式的凭证时返回ErrNoCredentials 以便ChainAuth尝试下一种方式
+type Authenticator interface {
+	Authenticate(ctx context.Context, fullMethod string, req interface{}) (Identity, error)
+}
+
+// Signer 为发出的rpc附加凭证 与Authenticator配对使用
+type Signer interface {
+	Sign(ctx context.Context, fullMethod string, req interface{}) (context.Context, error)
+}
+
+// MessageSigner 是Signer的可选接口 为流式rpc(如Handoff)中的每条消息签名
+// 建立流时的凭证只认证了流本身 逐条签名防止流中的消息被篡改、重放或重排
+// ctx为Sign返回的context seq为消息在流中的序号 从0开始
+type MessageSigner interface {
+	SignMessage(ctx context.Context, seq uint64, msg proto.Message) ([]byte, error)
+}
+
+// MessageAuthenticator 是Authenticator的可选接口 校验流中每条消息的签名
+// id不是由该方式认证时直接放行
+type MessageAuthenticator interface {
+	AuthenticateMessage(ctx context.Context, id Identity, seq uint64, msg proto.Message, sig []byte) error
+}
+
+var ErrNoCredentials = errors.New("no credentials")
+
+const (
+	authorizationHeader = "authorization"
+	hmacIDHeader        = "x-geecache-id"
+	hmacTimeHeader      = "x-geecache-timestamp"
+	hmacNonceHeader     = "x-geecache-nonce"
+	hmacSigHeader       = "x-geecache-signature"
+	authorityHeader     = ":authority"
+
+	defaultHMACSkew = 5 * time.Minute
+)
+
+type identityKey struct{}
+
+// IdentityFromContext 返回rpc调用方的Identity 未开启认证时返回false
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(Identity)
+	return id, ok
+}
+
+// BearerAuth 静态token认证 tokens为token到身份名的映射
+type BearerAuth map[string]string
+
+func (a BearerAuth) Authenticate(ctx context.Context, fullMethod string, req interface{}) (Identity, error) {
+	values := metadata.ValueFromIncomingContext(ctx, authorizationHeader)
+	if len(values) == 0 {
+		return Identity{}, ErrNoCredentials
+	}
+	token, ok := strings.CutPrefix(values[0], "Bearer ")
+	if !ok {
+		return Identity{}, ErrNoCredentials
+	}
+	// 逐个常量时间比较 避免通过耗时猜测token
+	for t, name := range a {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return Identity{Name: name, Method: "bearer"}, nil
+		}
+	}
+	return Identity{}, errors.New("invalid bearer token")
+}
+
+// BearerSigner 在每个rpc上附加"authorization: Bearer token"
+type BearerSigner string
+
+func (s BearerSigner) Sign(ctx context.Context, fullMethod string, req interface{}) (context.Context, error) {
+	return metadata.AppendToOutgoingContext(ctx, authorizationHeader, "Bearer "+string(s)), nil
+}
+
+// HMACAuth 校验HMAC-SHA256签名的请求
+// 签名覆盖身份名、时间戳、nonce、目标节点(:authority)、rpc方法与请求内容
+// 时间戳与当前时间相差超过Skew的请求被拒绝 Skew内出现过的nonce会被记住 重放的请求被拒绝
+// 每个节点只记得自己收到的nonce 因此签名绑定目标节点 防止请求被重放到其他节点
+// 流式rpc中的每条消息也需要签名
+type HMACAuth struct {
+	Keys map[string][]byte // 身份名 -> 共享密钥
+	Skew time.Duration     // 0表示defaultHMACSkew
+	now  func() time.Time
+
+	mu     sync.Mutex
+	nonces map[string]time.Time // 身份名/nonce -> 过期时间
+	sweep  time.Time            // 下一次清理过期nonce的时间
+}
+
+func (a *HMACAuth) Authenticate(ctx context.Context, fullMethod string, req interface{}) (Identity, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	id, ts, sig := first(md, hmacIDHeader), first(md, hmacTimeHeader), first(md, hmacSigHeader)
+	if id == "" || sig == "" {
+		return Identity{}, ErrNoCredentials
+	}
+	nonce := first(md, hmacNonceHeader)
+	if nonce == "" {
+		return Identity{}, errors.New("missing hmac nonce")
+	}
+	key, ok := a.Keys[id]
+	if !ok {
+		return Identity{}, fmt.Errorf("unknown hmac identity %s", id)
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return Identity{}, fmt.Errorf("invalid hmac timestamp %q", ts)
+	}
+	skew := a.Skew
+	if skew <= 0 {
+		skew = defaultHMACSkew
+	}
+	now := time.Now
+	if a.now != nil {
+		now = a.now
+	}
+	if d := now().Sub(time.Unix(unix, 0)); d > skew || d < -skew {
+		return Identity{}, errors.New("hmac timestamp out of range")
+	}
+	expected, err := hmacSign(key, id, ts, nonce, first(md, authorityHeader), fullMethod, req)
+	if err != nil {
+		return Identity{}, err
+	}
+	got, err := hex.DecodeString(sig)
+	if err != nil || !hmac.Equal(got, expected) {
+		return Identity{}, errors.New("invalid hmac signature")
+	}
+	// 签名有效后才记录nonce 否则伪造的请求可以占用nonce
+	if !a.remember(id+"/"+nonce, time.Unix(unix, 0).Add(skew), now()) {
+		return Identity{}, errors.New("replayed hmac nonce")
+	}
+	return Identity{Name: id, Method: "hmac"}, nil
+}
+
+// remember 记录nonce直到expire 之后时间戳检查会拒绝它 nonce已出现过时返回false
+func (a *HMACAuth) remember(nonce string, expire, now time.Time) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.nonces == nil {
+		a.nonces = make(map[string]time.Time)
+	}
+	if now.After(a.sweep) {
+		for n, exp := range a.nonces {
+			if now.After(exp) {
+				delete(a.nonces, n)
+			}
+		}
+		a.sweep = now.Add(time.Minute)
+	}
+	if _, ok := a.nonces[nonce]; ok {
+		return false
+	}
+	a.nonces[nonce] = expire
+	return true
+}
+
+// AuthenticateMessage 校验HMACSigner对流中消息的签名
+func (a *HMACAuth) AuthenticateMessage(ctx context.Context, id Identity, seq uint64, msg proto.Message, sig []byte) error {
+	if id.Method != "hmac" {
+		return nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	expected, err := hmacSignMessage(a.Keys[id.Name], id.Name, first(md, hmacNonceHeader), seq, msg)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(sig, expected) {
+		return fmt.Errorf("invalid hmac signature of message %d", seq)
+	}
+	return nil
+}
+
+// HMACSigner 以ID与Key对请求签名 目标节点取自Client连接的地址
+type HMACSigner struct {
+	ID  string
+	Key []byte
+	now func() time.Time
+}
+
+func (s *HMACSigner) Sign(ctx context.Context, fullMethod string, req interface{}) (context.Context, error) {
+	now := time.Now
+	if s.now != nil {
+		now = s.now
+	}
+	ts := strconv.FormatInt(now().Unix(), 10)
+	nonce := randomID(16)
+	sig, err := hmacSign(s.Key, s.ID, ts, nonce, authorityFromContext(ctx), fullMethod, req)
+	if err != nil {
+		return ctx, err
+	}
+	return metadata.AppendToOutgoingContext(ctx,
+		hmacIDHeader, s.ID,
+		hmacTimeHeader, ts,
+		hmacNonceHeader, nonce,
+		hmacSigHeader, hex.EncodeToString(sig),
+	), nil
+}
+
+// SignMessage 以Sign生成的nonce与消息的序号对流中的消息签名
+func (s *HMACSigner) SignMessage(ctx context.Context, seq uint64, msg proto.Message) ([]byte, error) {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	return hmacSignMessage(s.Key, s.ID, first(md, hmacNonceHeader), seq, msg)
+}
+
+// hmacSign 流式rpc的req为nil 只对方法签名 流中的消息由hmacSignMessage逐条签名
+func hmacSign(key []byte, id, ts, nonce, authority, fullMethod string, req interface{}) ([]byte, error) {
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s\n%s\n", id, ts, nonce, authority, fullMethod)
+	if m, ok := req.(proto.Message); ok {
+		digest, err := messageDigest(m)
+		if err != nil {
+			return nil, err
+		}
+		mac.Write(digest)
+	}
+	return mac.Sum(nil), nil
+}
+
+// hmacSignMessage 签名绑定流的nonce与消息的序号
+func hmacSignMessage(key []byte, id, nonce string, seq uint64, msg proto.Message) ([]byte, error) {
+	digest, err := messageDigest(msg)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%s\n%s\n%d\n", id, nonce, seq)
+	mac.Write(digest)
+	return mac.Sum(nil), nil
+}
+
+// messageDigest 消息的sha256 不包括签名字段本身
+func messageDigest(m proto.Message) ([]byte, error) {
+	if fd := signatureField(m); fd != nil {
+		m = proto.Clone(m)
+		m.ProtoReflect().Clear(fd)
+	}
+	body, err := proto.MarshalOptions{Deterministic: true}.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(body)
+	return digest[:], nil
+}
+
+// signatureField 返回流中消息携带签名的字段 没有时返回nil
+func signatureField(m proto.Message) protoreflect.FieldDescriptor {
+	return m.ProtoReflect().Descriptor().Fields().ByName("signature")
+}
+
+func first(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// MTLSAuth 以客户端证书作为身份 需要server开启TLSConfig.Mutual
+// 身份名依次取证书的第一个DNS SAN、URI SAN、IP SAN 都没有时使用CommonName
+type MTLSAuth struct{}
+
+func (MTLSAuth) Authenticate(ctx context.Context, fullMethod string, req interface{}) (Identity, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return Identity{}, ErrNoCredentials
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return Identity{}, ErrNoCredentials
+	}
+	leaf := info.State.VerifiedChains[0][0]
+	name := leaf.Subject.CommonName
+	switch {
+	case len(leaf.DNSNames) > 0:
+		name = leaf.DNSNames[0]
+	case len(leaf.URIs) > 0:
+		name = leaf.URIs[0].String()
+	case len(leaf.IPAddresses) > 0:
+		name = leaf.IPAddresses[0].String()
+	}
+	return Identity{Name: name, Method: "mtls"}, nil
+}
+
+// ChainAuth 依次尝试多种认证方式 请求中带有凭证但校验失败时直接拒绝
+type ChainAuth []Authenticator
+
+func (c ChainAuth) Authenticate(ctx context.Context, fullMethod string, req interface{}) (Identity, error) {
+	for _, a := range c {
+		id, err := a.Authenticate(ctx, fullMethod, req)
+		if !errors.Is(err, ErrNoCredentials) {
+			return id, err
+		}
+	}
+	return Identity{}, ErrNoCredentials
+}
+
+// AuthenticateMessage 交给各个认证方式 它们只校验由自己认证的流
+func (c ChainAuth) AuthenticateMessage(ctx context.Context, id Identity, seq uint64, msg proto.Message, sig []byte) error {
+	for _, a := range c {
+		if ma, ok := a.(MessageAuthenticator); ok {
+			if err := ma.AuthenticateMessage(ctx, id, seq, msg, sig); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Permission Group上的操作权限
+type Permission uint8
+
+const (
+	PermRead       Permission = 1 << iota // Get/BatchGet
+	PermWrite                             // Set与哈希环变化时的Handoff
+	PermInvalidate                        // Delete 包括Remove与Invalidate
+)
+
+func (p Permission) String() string {
+	var names []string
+	for _, perm := range []struct {
+		p    Permission
+		name string
+	}{{PermRead, "read"}, {PermWrite, "write"}, {PermInvalidate, "invalidate"}} {
+		if p&perm.p != 0 {
+			names = append(names, perm.name)
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+// ACL 身份名到权限的映射 "*"匹配任意已认证的身份
+type ACL map[string]Permission
+
+func (a ACL) Allow(name string, perm Permission) bool {
+	return a[name]&perm == perm || a["*"]&perm == perm
+}
+
+// SetACL 设置Group的访问控制 只在server开启认证时生效
+// 未设置ACL的Group允许任意已认证的身份访问
+func (g *Group) SetACL(acl ACL) {
+	g.acl = acl
+}
+
+// methodPermissions rpc方法需要的权限
+var methodPermissions = map[string]Permission{
+	"Get":      PermRead,
+	"BatchGet": PermRead,
+	"Set":      PermWrite,
+	"Handoff":  PermWrite,
+	"Delete":   PermInvalidate,
+	"Stats":    PermRead,
+}
+
+func methodPermission(fullMethod string) Permission {
+	return methodPermissions[fullMethod[strings.LastIndex(fullMethod, "/")+1:]]
+}
+
+// SetAuth 开启rpc认证 需在Start之前调用
+func (s *server) SetAuth(auth Authenticator) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.auth = auth
+}
+
+// SetSigner 设置本节点访问其他节点时使用的凭证 需在SetPeers/Start之前调用
+func (s *server) SetSigner(signer Signer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.signer = signer
+	for addr := range s.clients {
+		s.clients[addr] = s.newClient(addr)
+	}
+}
+
+// SetSigner 设置Client发出rpc时附加的凭证 需在第一次请求之前调用
+func (c *Client) SetSigner(signer Signer) {
+	c.signer = signer
+}
+
+// authenticate 认证调用方 返回带有Identity的context
+func (s *server) authenticate(ctx context.Context, fullMethod string, req interface{}) (context.Context, error) {
+	id, err := s.auth.Authenticate(ctx, fullMethod, req)
+	if err != nil {
+		return ctx, status.Errorf(codes.Unauthenticated, "authentication failed: %v", err)
+	}
+	return context.WithValue(ctx, identityKey{}, id), nil
+}
+
+// authorize 检查id对group的权限 group不存在时交给handler处理
+func (s *server) authorize(id Identity, fullMethod string, group string) error {
+	g := s.group(group)
+	if g == nil || g.acl == nil {
+		return nil
+	}
+	if perm := methodPermission(fullMethod); !g.acl.Allow(id.Name, perm) {
+		return status.Errorf(codes.PermissionDenied, "%s is not allowed to %s group %s", id.Name, perm, group)
+	}
+	return nil
+}
+
+type groupRequest interface {
+	GetGroup() string
+}
+
+func (s *server) authUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := s.authenticate(ctx, info.FullMethod, req)
+	if err != nil {
+		return nil, err
+	}
+	if r, ok := req.(groupRequest); ok {
+		id, _ := IdentityFromContext(ctx)
+		if err := s.authorize(id, info.FullMethod, r.GetGroup()); err != nil {
+			return nil, err
+		}
+	}
+	return handler(ctx, req)
+}
+
+func (s *server) authStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.authenticate(ss.Context(), info.FullMethod, nil)
+	if err != nil {
+		return err
+	}
+	id, _ := IdentityFromContext(ctx)
+	return handler(srv, &authStream{ServerStream: ss, ctx: ctx, s: s, id: id, method: info.FullMethod})
+}
+
+// authStream 对流中的每条消息校验签名并检查权限
+type authStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	s      *server
+	id     Identity
+	method string
+	seq    uint64 // 下一条消息的序号
+}
+
+func (a *authStream) Context() context.Context {
+	return a.ctx
+}
+
+func (a *authStream) RecvMsg(m interface{}) error {
+	if err := a.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if err := a.authenticateMessage(m); err != nil {
+		return err
+	}
+	if r, ok := m.(groupRequest); ok {
+		return a.s.authorize(a.id, a.method, r.GetGroup())
+	}
+	return nil
+}
+
+// authenticateMessage Authenticator满足MessageAuthenticator时校验消息的签名
+func (a *authStream) authenticateMessage(m interface{}) error {
+	ma, ok := a.s.auth.(MessageAuthenticator)
+	msg, isProto := m.(proto.Message)
+	if !ok || !isProto || signatureField(msg) == nil {
+		return nil
+	}
+	seq := a.seq
+	a.seq++
+	sig := msg.ProtoReflect().Get(signatureField(msg)).Bytes()
+	if err := ma.AuthenticateMessage(a.ctx, a.id, seq, msg, sig); err != nil {
+		return status.Errorf(codes.Unauthenticated, "authentication failed: %v", err)
+	}
+	return nil
+}
+
+type authorityKey struct{}
+
+// withAuthority 记录rpc的目标节点 即对端收到的:authority
+func withAuthority(ctx context.Context, authority string) context.Context {
+	return context.WithValue(ctx, authorityKey{}, authority)
+}
+
+func authorityFromContext(ctx context.Context) string {
+	authority, _ := ctx.Value(authorityKey{}).(string)
+	return authority
+}
+
+// signedConn 在每个rpc发出前由Signer附加凭证
+type signedConn struct {
+	*grpc.ClientConn
+	signer    Signer
+	authority string // 目标节点的地址
+}
+
+func (c signedConn) Invoke(ctx context.Context, method string, args, reply interface{}, opts ...grpc.CallOption) error {
+	ctx, err := c.signer.Sign(withAuthority(ctx, c.authority), method, args)
+	if err != nil {
+		return err
+	}
+	return c.ClientConn.Invoke(ctx, method, args, reply, opts...)
+}
+
+func (c signedConn) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	ctx, err := c.signer.Sign(withAuthority(ctx, c.authority), method, nil)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := c.ClientConn.NewStream(ctx, desc, method, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if ms, ok := c.signer.(MessageSigner); ok {
+		return &signedStream{ClientStream: stream, ctx: ctx, signer: ms}, nil
+	}
+	return stream, nil
+}
+
+// signedStream 为流中发出的每条消息签名
+type signedStream struct {
+	grpc.ClientStream
+	ctx    context.Context
+	signer MessageSigner
+	seq    uint64
+}
+
+func (s *signedStream) SendMsg(m interface{}) error {
+	msg, ok := m.(proto.Message)
+	if !ok || signatureField(msg) == nil {
+		return s.ClientStream.SendMsg(m)
+	}
+	sig, err := s.signer.SignMessage(s.ctx, s.seq, msg)
+	if err != nil {
+		return err
+	}
+	s.seq++
+	msg = proto.Clone(msg)
+	msg.ProtoReflect().Set(signatureField(msg), protoreflect.ValueOfBytes(sig))
+	return s.ClientStream.SendMsg(msg)
+}
+
+// grpcClient 返回conn上的rpc客户端 设置了Signer时为每个rpc附加凭证
+func (c *Client) grpcClient(conn *grpc.ClientConn) pb.GroupCacheClient {
+	if c.signer == nil {
+		return pb.NewGroupCacheClient(conn)
+	}
+	return pb.NewGroupCacheClient(signedConn{ClientConn: conn, signer: c.signer, authority: c.name})
+}
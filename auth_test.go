@@ -0,0 +1,256 @@
+package geecache
+
+import (
+	pb "GeeCache/geecache/geecachepb"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"testing"
+	"time"
+)
+
+// authNode 启动开启认证的server 返回以signer连接它的Client
+func authNode(t *testing.T, auth Authenticator, groups map[string]*Group) func(signer Signer) *Client {
+	const addr = "127.0.0.1:9301"
+	cluster := newBufNet()
+	cluster.node(t, addr, groups, func(s *server) { s.SetAuth(auth) })
+	return func(signer Signer) *Client {
+		client := cluster.client(t, addr)
+		client.signer = signer
+		return client
+	}
+}
+
+func expectCode(t *testing.T, what string, err error, code codes.Code) {
+	t.Helper()
+	if got := status.Code(err); got != code {
+		t.Fatalf("%s: expect %s, got %v", what, code, err)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	secret := []byte("writer-secret")
+	auth := ChainAuth{
+		BearerAuth{"reader-token": "reader"},
+		&HMACAuth{Keys: map[string][]byte{"writer": secret}},
+	}
+	private := NewGroup("auth-private", 2<<10, countingGetter(new(int32)))
+	private.SetACL(ACL{
+		"reader": PermRead,
+		"writer": PermRead | PermWrite | PermInvalidate,
+	})
+	open := NewGroup("auth-open", 2<<10, countingGetter(new(int32)))
+	client := authNode(t, auth, map[string]*Group{
+		"auth-private": private,
+		"auth-open":    open,
+	})
+	ctx := context.Background()
+	value := NewByteView([]byte("v"))
+
+	// 没有凭证或凭证错误
+	_, err := client(nil).Fetch("auth-private", "key")
+	expectCode(t, "no credentials", err, codes.Unauthenticated)
+	_, err = client(BearerSigner("wrong")).Fetch("auth-private", "key")
+	expectCode(t, "wrong token", err, codes.Unauthenticated)
+	_, err = client(&HMACSigner{ID: "writer", Key: []byte("guess")}).Fetch("auth-private", "key")
+	expectCode(t, "wrong hmac key", err, codes.Unauthenticated)
+	stale := &HMACSigner{ID: "writer", Key: secret, now: func() time.Time { return time.Now().Add(-time.Hour) }}
+	_, err = client(stale).Fetch("auth-private", "key")
+	expectCode(t, "stale hmac timestamp", err, codes.Unauthenticated)
+
+	// reader只能读
+	reader := client(BearerSigner("reader-token"))
+	if v, err := reader.Fetch("auth-private", "key"); err != nil || v.String() != "value-key" {
+		t.Fatalf("reader get: %s %v", v, err)
+	}
+	expectCode(t, "reader set", reader.Set(ctx, "auth-private", "key", value), codes.PermissionDenied)
+	expectCode(t, "reader delete", reader.Delete(ctx, "auth-private", "key", false), codes.PermissionDenied)
+	results, err := reader.FetchMany(ctx, "auth-private", []string{"a", "b"})
+	if err != nil || len(results) != 2 || results[0].Err != nil {
+		t.Fatalf("reader batch get: %v %v", results, err)
+	}
+
+	// writer通过HMAC签名 可以写入与删除
+	writer := client(&HMACSigner{ID: "writer", Key: secret})
+	if err := writer.Set(ctx, "auth-private", "key", value); err != nil {
+		t.Fatalf("writer set: %v", err)
+	}
+	if err := writer.Delete(ctx, "auth-private", "key", false); err != nil {
+		t.Fatalf("writer delete: %v", err)
+	}
+
+	// 没有ACL的Group允许任意已认证的身份
+	if err := reader.Set(ctx, "auth-open", "key", value); err != nil {
+		t.Fatalf("group without ACL: %v", err)
+	}
+	_, err = client(nil).Fetch("auth-open", "key")
+	expectCode(t, "group without ACL still requires authentication", err, codes.Unauthenticated)
+}
+
+func TestHMACReplay(t *testing.T) {
+	secret := []byte("secret")
+	auth := &HMACAuth{Keys: map[string][]byte{"node": secret}}
+	signer := &HMACSigner{ID: "node", Key: secret}
+	const method = "/geecachepb.GroupCache/Get"
+	req := &pb.Request{Group: "g", Key: "key"}
+
+	// 把签名后的出站metadata当作本节点收到的请求
+	const self = "127.0.0.1:9301"
+	incoming := func(ctx context.Context) context.Context {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		md = metadata.Join(md, metadata.Pairs(authorityHeader, self))
+		return metadata.NewIncomingContext(context.Background(), md)
+	}
+	ctx, err := signer.Sign(withAuthority(context.Background(), self), method, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.Authenticate(incoming(ctx), method, req); err != nil {
+		t.Fatalf("first request: %v", err)
+	}
+	if _, err := auth.Authenticate(incoming(ctx), method, req); err == nil {
+		t.Fatal("replayed request should be rejected")
+	}
+	// 签名覆盖请求内容 换一个key会使签名失效
+	ctx, _ = signer.Sign(withAuthority(context.Background(), self), method, req)
+	if _, err := auth.Authenticate(incoming(ctx), method, &pb.Request{Group: "g", Key: "other"}); err == nil {
+		t.Fatal("signature should not be valid for another request")
+	}
+}
+
+// recordSigner 记录签名后的metadata replay为true时不再签名 而是重放记录的metadata
+type recordSigner struct {
+	Signer
+	md     metadata.MD
+	replay bool
+}
+
+func (s *recordSigner) Sign(ctx context.Context, fullMethod string, req interface{}) (context.Context, error) {
+	if s.replay {
+		return metadata.NewOutgoingContext(ctx, s.md), nil
+	}
+	ctx, err := s.Signer.Sign(ctx, fullMethod, req)
+	s.md, _ = metadata.FromOutgoingContext(ctx)
+	return ctx, err
+}
+
+func TestHMACReplayToOtherNode(t *testing.T) {
+	const (
+		addrA = "127.0.0.1:9331"
+		addrB = "127.0.0.1:9332"
+	)
+	secret := []byte("secret")
+	g := NewGroup("auth-replay", 2<<10, countingGetter(new(int32)))
+	cluster := newBufNet()
+	// 每个节点有自己的nonce记录
+	for _, addr := range []string{addrA, addrB} {
+		auth := &HMACAuth{Keys: map[string][]byte{"node": secret}}
+		cluster.node(t, addr, map[string]*Group{"auth-replay": g}, func(s *server) { s.SetAuth(auth) })
+	}
+
+	signer := &recordSigner{Signer: &HMACSigner{ID: "node", Key: secret}}
+	a := cluster.client(t, addrA)
+	a.SetSigner(signer)
+	if _, err := a.Fetch("auth-replay", "key"); err != nil {
+		t.Fatalf("signed request: %v", err)
+	}
+	// 发给A的请求被截获后重放给B 签名绑定了目标节点 B拒绝
+	signer.replay = true
+	b := cluster.client(t, addrB)
+	b.SetSigner(signer)
+	_, err := b.Fetch("auth-replay", "key")
+	expectCode(t, "replay to another node", err, codes.Unauthenticated)
+	_, err = a.Fetch("auth-replay", "key")
+	expectCode(t, "replay to the same node", err, codes.Unauthenticated)
+}
+
+// tamperSigner 在签名之后修改流中的消息
+type tamperSigner struct {
+	*HMACSigner
+}
+
+func (s tamperSigner) SignMessage(ctx context.Context, seq uint64, msg proto.Message) ([]byte, error) {
+	sig, err := s.HMACSigner.SignMessage(ctx, seq, msg)
+	msg.(*pb.SetRequest).Key = "tampered"
+	return sig, err
+}
+
+func TestHandoffAuth(t *testing.T) {
+	secret := []byte("node-secret")
+	private := NewGroup("auth-handoff", 2<<10, countingGetter(new(int32)))
+	private.SetACL(ACL{"node": PermRead | PermWrite})
+	client := authNode(t, ChainAuth{
+		BearerAuth{"node-token": "node", "reader-token": "reader"},
+		&HMACAuth{Keys: map[string][]byte{"node": secret}},
+	}, map[string]*Group{
+		"auth-handoff": private,
+	})
+
+	send := func(c *Client, key string) error {
+		conn, err := c.pool.get(context.Background(), c.name)
+		if err != nil {
+			return err
+		}
+		stream, err := c.grpcClient(conn).Handoff(context.Background())
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(setRequest("auth-handoff", key, NewByteView([]byte("v")))); err != nil {
+			return err
+		}
+		_, err = stream.CloseAndRecv()
+		return err
+	}
+	expectCode(t, "reader handoff", send(client(BearerSigner("reader-token")), "key"), codes.PermissionDenied)
+	if err := send(client(BearerSigner("node-token")), "key"); err != nil {
+		t.Fatalf("node handoff: %v", err)
+	}
+	if _, ok := private.mainCache.peek("key"); !ok {
+		t.Fatal("handoff entry should be stored")
+	}
+
+	// HMAC认证的流中每条消息都需要签名
+	if err := send(client(&HMACSigner{ID: "node", Key: secret}), "signed"); err != nil {
+		t.Fatalf("signed handoff: %v", err)
+	}
+	if _, ok := private.mainCache.peek("signed"); !ok {
+		t.Fatal("signed handoff entry should be stored")
+	}
+	tampered := client(tamperSigner{&HMACSigner{ID: "node", Key: secret}})
+	expectCode(t, "tampered handoff", send(tampered, "key2"), codes.Unauthenticated)
+	if _, ok := private.mainCache.peek("tampered"); ok {
+		t.Fatal("tampered entry should not be stored")
+	}
+}
+
+func TestMTLSAuth(t *testing.T) {
+	ca := newTestCA(t)
+	certFile, keyFile := ca.issue(t, "client", "client.geecache")
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := (MTLSAuth{}).Authenticate(context.Background(), "", nil); err != ErrNoCredentials {
+		t.Fatalf("expect ErrNoCredentials without a peer, got %v", err)
+	}
+	ctx := peer.NewContext(context.Background(), &peer.Peer{
+		AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{
+			VerifiedChains: [][]*x509.Certificate{{leaf, ca.cert}},
+		}},
+	})
+	id, err := MTLSAuth{}.Authenticate(ctx, "", nil)
+	if err != nil || id.Name != "client.geecache" || id.Method != "mtls" {
+		t.Fatalf("unexpected identity %+v %v", id, err)
+	}
+}
@@ -0,0 +1,180 @@
+package geecache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// GetMulti 一次获取多个key 返回每个key各自的结果
+// 未命中的key按owner分组 每个远端节点只发起一次BatchGet
+// 本地负责(以及远端获取失败)的key 若getter实现了BatchGetter则通过一次GetMany加载
+// 与并发的Get一样经过singleflight 已经在加载中的key不会被重复加载
+// 每个key的远端获取、副本回退与本地加载与Get使用相同的步骤
+func (g *Group) GetMulti(ctx context.Context, keys []string) map[string]Result {
+	results := make(map[string]Result, len(keys))
+	var misses []string
+	for _, key := range keys {
+		if _, ok := results[key]; ok {
+			continue
+		}
+		if key == "" {
+			results[key] = Result{Err: fmt.Errorf("key is required")}
+			continue
+		}
+		if v, ok := g.lookupCache(key); ok {
+			results[key] = Result{Value: v}
+			continue
+		}
+		results[key] = Result{}
+		misses = append(misses, key)
+	}
+	if len(misses) == 0 {
+		return results
+	}
+
+	g.loads.Add(int64(len(misses)))
+	g.countN(MetricLoads, int64(len(misses)))
+	// 没有由本次调用加载的key复用了其他请求的加载结果
+	var led atomic.Int64
+	vals, errs := g.loader.FlyMulti(ctx, misses, func(ctx context.Context, keys []string) ([]interface{}, []error) {
+		led.Add(int64(len(keys)))
+		return g.loadMany(ctx, keys)
+	})
+	if deduped := int64(len(misses)) - led.Load(); deduped > 0 {
+		g.loadsDeduped.Add(deduped)
+		g.countN(MetricLoadsDeduped, deduped)
+	}
+	for i, key := range misses {
+		if errs[i] != nil {
+			results[key] = Result{Err: errs[i]}
+			continue
+		}
+		results[key] = Result{Value: vals[i].(ByteView)}
+	}
+	return results
+}
+
+// loadMany 加载一批key 返回的结果与keys一一对应
+func (g *Group) loadMany(ctx context.Context, keys []string) ([]interface{}, []error) {
+	vals := make([]interface{}, len(keys))
+	errs := make([]error, len(keys))
+
+	// 按owner分组 PickPeer由server的Placer决定
+	var local []int
+	byPeer := make(map[Fetcher][]int)
+	for i, key := range keys {
+		if g.server != nil {
+			if peer, ok := g.server.PickPeer(key); ok {
+				byPeer[peer] = append(byPeer[peer], i)
+				continue
+			}
+		}
+		local = append(local, i)
+	}
+
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	for peer, idx := range byPeer {
+		wg.Add(1)
+		go func(peer Fetcher, idx []int) {
+			defer wg.Done()
+			failed := g.fetchManyFromPeer(ctx, peer, keys, idx, vals)
+			mu.Lock()
+			local = append(local, failed...)
+			mu.Unlock()
+		}(peer, idx)
+	}
+	wg.Wait()
+
+	g.getManyLocally(ctx, keys, local, vals, errs)
+	return vals, errs
+}
+
+// fetchManyFromPeer 从peer获取keys中下标为idx的key 返回获取失败的下标
+// 与load一样 远端失败的key依次尝试副本节点 仍然失败的回退到本地加载
+// 一次BatchGet不做对冲 对冲会把整批请求复制到多个副本上
+func (g *Group) fetchManyFromPeer(ctx context.Context, peer Fetcher, keys []string, idx []int, vals []interface{}) (failed []int) {
+	bf, ok := peer.(BatchFetcher)
+	if !ok {
+		for _, i := range idx {
+			if value, ok := g.fetchFromOwner(ctx, peer, keys[i]); ok {
+				vals[i] = value
+				continue
+			}
+			failed = append(failed, i)
+		}
+		return failed
+	}
+
+	start := time.Now()
+
+	batch := make([]string, len(idx))
+	for j, i := range idx {
+		batch[j] = keys[i]
+	}
+	spanCtx, span := g.startSpan(ctx, SpanFetchMany, "keys", len(batch), "peer", peerName(peer))
+	results, err := bf.FetchMany(spanCtx, g.name, batch)
+	if err == nil && len(results) != len(batch) {
+		err = fmt.Errorf("peer returned %d results for %d keys", len(results), len(batch))
+	}
+	endSpan(span, err)
+	g.observePeer(peer, start, err)
+	if err != nil {
+		g.logger.Warn("fail to batch get from peer", "group", g.name, "keys", len(batch), "err", err)
+	}
+	for j, i := range idx {
+		if err == nil && results[j].Err == nil {
+			vals[i] = g.fromPeer(keys[i], results[j].Value, start)
+			continue
+		}
+		if err == nil {
+			g.logger.Warn("fail to get from peer", "group", g.name, "key", keys[i], "err", results[j].Err)
+		}
+		if value, ok := g.fetchFromReplicas(ctx, keys[i], false); ok {
+			vals[i] = value
+			continue
+		}
+		failed = append(failed, i)
+	}
+	return failed
+}
+
+// getManyLocally 从本地加载keys中下标为idx的key
+func (g *Group) getManyLocally(ctx context.Context, keys []string, idx []int, vals []interface{}, errs []error) {
+	if len(idx) == 0 {
+		return
+	}
+	bg, ok := g.getter.(BatchGetter)
+	if !ok {
+		for _, i := range idx {
+			vals[i], errs[i] = g.getLocally(ctx, keys[i])
+		}
+		return
+	}
+
+	start := time.Now()
+	batch := make([]string, len(idx))
+	for j, i := range idx {
+		batch[j] = keys[i]
+	}
+	spanCtx, span := g.startSpan(ctx, SpanGetLocally, "keys", len(batch))
+	results, err := bg.GetMany(spanCtx, batch)
+	if err == nil && len(results) != len(batch) {
+		err = fmt.Errorf("GetMany returned %d results for %d keys", len(results), len(batch))
+	}
+	endSpan(span, err)
+	g.observeGetter(start, err)
+	for j, i := range idx {
+		var value ByteView
+		keyErr := err
+		if err == nil {
+			value, keyErr = results[j].Value, results[j].Err
+		}
+		vals[i], errs[i] = g.fillLocally(ctx, keys[i], value, keyErr, start)
+	}
+}
@@ -0,0 +1,203 @@
+package geecache
+
+import (
+	pb "GeeCache/geecache/geecachepb"
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// batchGetter 同时实现Getter与BatchGetter
+type batchGetter struct {
+	gets    int32
+	batches int32
+}
+
+func (b *batchGetter) Get(key string) (ByteView, error) {
+	atomic.AddInt32(&b.gets, 1)
+	if v, ok := db[key]; ok {
+		return NewByteView([]byte(v)), nil
+	}
+	return ByteView{}, fmt.Errorf("%s not exist", key)
+}
+
+func (b *batchGetter) GetMany(ctx context.Context, keys []string) ([]Result, error) {
+	atomic.AddInt32(&b.batches, 1)
+	results := make([]Result, len(keys))
+	for i, key := range keys {
+		if v, ok := db[key]; ok {
+			results[i].Value = NewByteView([]byte(v))
+		} else {
+			results[i].Err = fmt.Errorf("%s not exist", key)
+		}
+	}
+	return results, nil
+}
+
+func TestGetMulti(t *testing.T) {
+	remote := NewGroup("multi-remote", 2<<10, GetterFunc(func(key string) (ByteView, error) {
+		return NewByteView([]byte("remote-" + key)), nil
+	}))
+	getter := &batchGetter{}
+	local := NewGroup("multi-local", 2<<10, getter)
+	peer := &fakePeer{g: remote}
+	local.RegisterSvr(&fakePicker{owners: map[string]*fakePeer{"r1": peer, "r2": peer, "r3": peer}})
+
+	local.mainCache.add("Sam", NewByteView([]byte("567")))
+	keys := []string{"Tom", "r1", "Jack", "r2", "Sam", "r3", "unknown", "Tom", ""}
+	results := local.GetMulti(context.Background(), keys)
+
+	expect := map[string]string{"Tom": "630", "Jack": "589", "Sam": "567", "r1": "remote-r1", "r2": "remote-r2", "r3": "remote-r3"}
+	for key, v := range expect {
+		if r := results[key]; r.Err != nil || r.Value.String() != v {
+			t.Fatalf("%s: expect %s, got %s %v", key, v, r.Value, r.Err)
+		}
+	}
+	if results["unknown"].Err == nil || results[""].Err == nil {
+		t.Fatal("unknown and empty key should have per-key errors")
+	}
+	if len(results) != 8 {
+		t.Fatalf("expect 8 distinct keys, got %d", len(results))
+	}
+	// 每个远端节点一次BatchGet 本地未命中的key一次GetMany
+	if n := atomic.LoadInt32(&peer.batches); n != 1 {
+		t.Fatalf("expect 1 batch to peer, got %d", n)
+	}
+	if b, g := atomic.LoadInt32(&getter.batches), atomic.LoadInt32(&getter.gets); b != 1 || g != 0 {
+		t.Fatalf("expect 1 GetMany and no Get, got %d %d", b, g)
+	}
+	if _, ok := local.mainCache.peek("Jack"); !ok {
+		t.Fatal("Jack should be cached after GetMulti")
+	}
+}
+
+func TestGetMultiSingleflight(t *testing.T) {
+	var loads int32
+	release := make(chan struct{})
+	g := NewGroup("multi-flight", 2<<10, GetterFunc(func(key string) (ByteView, error) {
+		atomic.AddInt32(&loads, 1)
+		<-release
+		return NewByteView([]byte(db[key])), nil
+	}))
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		g.Get("Tom")
+	}()
+	for atomic.LoadInt32(&loads) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	go func() {
+		defer wg.Done()
+		// Tom已经在加载中 只有Jack需要加载
+		results := g.GetMulti(context.Background(), []string{"Tom", "Jack"})
+		if results["Tom"].Value.String() != "630" || results["Jack"].Value.String() != "589" {
+			t.Errorf("unexpected results %v", results)
+		}
+	}()
+	for atomic.LoadInt32(&loads) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	if n := atomic.LoadInt32(&loads); n != 2 {
+		t.Fatalf("expect 2 loads, got %d", n)
+	}
+	// Get与GetMulti的加载计入同一组统计 GetMulti中的Tom复用了Get的结果
+	if stats := g.Stats(); stats.Loads != 3 || stats.LoadsDeduped != 1 {
+		t.Fatalf("expect 3 loads with 1 deduped, got %+v", stats)
+	}
+}
+
+func TestGetMultiReplication(t *testing.T) {
+	const (
+		addrA = "127.0.0.1:9601"
+		addrB = "127.0.0.1:9602"
+		addrC = "127.0.0.1:9603"
+	)
+	var originA, originB, originC int32
+	gA := NewGroup("multi-replica", 1<<20, countingGetter(&originA), WithReplication(2))
+	gB := NewGroup("multi-replica", 1<<20, countingGetter(&originB), WithReplication(2))
+	gC := NewGroup("multi-replica", 1<<20, countingGetter(&originC), WithReplication(2))
+
+	cluster := newBufNet()
+	a := cluster.node(t, addrA, map[string]*Group{"multi-replica": gA})
+	b := cluster.node(t, addrB, map[string]*Group{"multi-replica": gB})
+	c := cluster.node(t, addrC, map[string]*Group{"multi-replica": gC})
+	for _, svr := range []*server{a, b, c} {
+		svr.SetPeers(addrA, addrB, addrC)
+	}
+	gA.RegisterSvr(a)
+	gB.RegisterSvr(b)
+	gC.RegisterSvr(c)
+
+	// 找出owner为B 副本为C的key
+	var keys []string
+	for i := 0; len(keys) < 2; i++ {
+		key := fmt.Sprintf("key%d", i)
+		if replicas := a.PickReplicas(key, 2); a.owner(key) == addrB && len(replicas) == 1 && replicas[0].(*Client).name == addrC {
+			keys = append(keys, key)
+		}
+	}
+	viaGet, viaMulti := keys[0], keys[1]
+
+	// B通过Get或GetMulti加载的key同样写入副本C
+	if _, err := gB.Get(viaGet); err != nil {
+		t.Fatal(err)
+	}
+	if r := gB.GetMulti(context.Background(), []string{viaMulti})[viaMulti]; r.Err != nil {
+		t.Fatal(r.Err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		_, ok1 := gC.mainCache.peek(viaGet)
+		_, ok2 := gC.mainCache.peek(viaMulti)
+		if ok1 && ok2 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for _, key := range keys {
+		if _, ok := gC.mainCache.peek(key); !ok {
+			t.Fatalf("%s should be replicated to C", key)
+		}
+	}
+
+	// B不可用 A的GetMulti与Get一样从副本C读取
+	cluster.down(addrB)
+	results := gA.GetMulti(context.Background(), keys)
+	for _, key := range keys {
+		if r := results[key]; r.Err != nil || r.Value.String() != "value-"+key {
+			t.Fatalf("get %s from replica: %s %v", key, r.Value, r.Err)
+		}
+	}
+	if n := atomic.LoadInt32(&originA) + atomic.LoadInt32(&originC); n != 0 {
+		t.Fatalf("replica read should not hit the origin, got %d loads", n)
+	}
+}
+
+func TestBatchGetRPC(t *testing.T) {
+	NewGroup("multi-rpc", 2<<10, GetterFunc(func(key string) (ByteView, error) {
+		if v, ok := db[key]; ok {
+			return NewByteView([]byte(v)), nil
+		}
+		return ByteView{}, fmt.Errorf("%s not exist", key)
+	}))
+	svr := &server{}
+	resp, err := svr.BatchGet(context.Background(), &pb.BatchRequest{Group: "multi-rpc", Keys: []string{"Tom", "unknown"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := resp.GetEntries()
+	if len(entries) != 2 || entries[0].GetKey() != "Tom" || entries[1].GetError() == "" {
+		t.Fatalf("unexpected entries %v", entries)
+	}
+	if v, err := viewFromResponse(entries[0].GetValue()); err != nil || v.String() != "630" {
+		t.Fatalf("expect 630, got %s %v", v, err)
+	}
+}
@@ -13,6 +13,46 @@ import "time"
 type ByteView struct {
 	b      []byte
 	expire time.Time
+	meta   Metadata
+	delta  time.Duration // 加载该值的耗时 用于提前刷新 不在节点间传输
+}
+
+// Metadata 是随value一起存储和传输的附加信息 缓存本身不解释其含义
+type Metadata struct {
+	Version     uint64 // 数据版本号 可用于乐观锁/比较新旧
+	Flags       uint32 // 由业务自定义的标志位
+	ContentType string // value的编码类型 如application/json
+}
+
+// NewByteView 创建一个永不过期的ByteView b会被拷贝
+func NewByteView(b []byte) ByteView {
+	return ByteView{b: cloneBytes(b)}
+}
+
+// NewByteViewWithTTL 创建一个ttl后过期的ByteView ttl<=0表示永不过期
+func NewByteViewWithTTL(b []byte, ttl time.Duration) ByteView {
+	v := NewByteView(b)
+	if ttl > 0 {
+		v.expire = time.Now().Add(ttl)
+	}
+	return v
+}
+
+// NewByteViewExpireAt 创建一个在t时刻过期的ByteView t为零值表示永不过期
+func NewByteViewExpireAt(b []byte, t time.Time) ByteView {
+	v := NewByteView(b)
+	v.expire = t
+	return v
+}
+
+// WithMetadata 返回附带了meta的ByteView副本
+func (v ByteView) WithMetadata(meta Metadata) ByteView {
+	v.meta = meta
+	return v
+}
+
+func (v ByteView) Metadata() Metadata {
+	return v.meta
 }
 
 func (v ByteView) Len() int {
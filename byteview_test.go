@@ -0,0 +1,69 @@
+package geecache
+
+import (
+	pb "GeeCache/geecache/geecachepb"
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewByteView(t *testing.T) {
+	b := []byte("630")
+	v := NewByteView(b)
+	b[0] = '7'
+	if v.String() != "630" || !v.Expire().IsZero() {
+		t.Fatalf("NewByteView should copy bytes and never expire, got %s", v)
+	}
+
+	if v := NewByteViewWithTTL(b, time.Minute); v.Expire().Before(time.Now()) {
+		t.Fatalf("expire should be in the future")
+	}
+	if v := NewByteViewWithTTL(b, 0); !v.Expire().IsZero() {
+		t.Fatalf("ttl<=0 should never expire")
+	}
+	at := time.Now().Add(time.Hour)
+	if v := NewByteViewExpireAt(b, at); !v.Expire().Equal(at) {
+		t.Fatalf("expire should equal %v", at)
+	}
+}
+
+func TestMetadataRoundTrip(t *testing.T) {
+	meta := Metadata{Version: 3, Flags: 1, ContentType: "application/json"}
+	view := NewByteViewWithTTL([]byte(`{"score":630}`), time.Minute).WithMetadata(meta)
+	g := NewGroup("meta", 2<<10, GetterFunc(func(key string) (ByteView, error) {
+		return view, nil
+	}))
+	g.SetHotCache(2 << 10)
+
+	// getter -> mainCache(lru)
+	if _, err := g.Get("Tom"); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := g.mainCache.peek("Tom"); !ok || v.Metadata() != meta {
+		t.Fatalf("metadata lost in mainCache")
+	}
+
+	// server.Get -> pb.Response -> client
+	svr := &server{}
+	resp, err := svr.Get(context.Background(), &pb.Request{Group: "meta", Key: "Tom"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := viewFromResponse(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Metadata() != meta || !reflect.DeepEqual(got.ByteSlice(), view.ByteSlice()) {
+		t.Fatalf("metadata lost over rpc, got %+v", got.Metadata())
+	}
+	if got.Expire().UnixNano() != view.Expire().UnixNano() {
+		t.Fatalf("expire lost over rpc")
+	}
+
+	// hotCache
+	g.hotCache.add("Jack", got)
+	if v, ok := g.hotCache.peek("Jack"); !ok || v.Metadata() != meta {
+		t.Fatalf("metadata lost in hotCache")
+	}
+}
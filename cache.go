@@ -1,53 +1,249 @@
 package geecache
 
 import (
-	"GeeCache/geecache/lru"
+	"GeeCache/geecache/policy"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
-// 这样设计可以进行cache和算法的分离，比如我现在实现了lfu缓存模块
-// 只需替换cache成员即可
+// 这样设计可以进行cache和算法的分离 cache只依赖policy.Policy接口
+// 淘汰算法(lru/lfu/lru-k/2q/arc)在创建Group时通过WithPolicy选择
+//
+// 所有淘汰算法在Get时都会修改内部结构(如移动链表节点) 因此读写都需要互斥锁
+// 为避免所有请求串行在同一把锁上 cache按key的hash分为多个独立加锁的shard
+// 每个shard平分cacheBytes
+//
+// grace>0时 有过期时间的值以graceEntry存储 淘汰算法按expire+grace判断过期
+// 因此过期后的grace窗口内仍能读出旧值 由Group决定是否返回旧值并在后台刷新
 
 type cache struct {
-	mu         sync.RWMutex
-	lru        *lru.Cache
+	shards     []*shard
 	cacheBytes int
+	janitor    *janitor      // 后台清理过期键 可能为nil
+	grace      time.Duration // 过期后仍保留旧值的时长
+	stats      *cacheStats
 }
 
-func newCache(capacity int) *cache {
-	return &cache{
+// cacheStats 各shard共享的统计 sink不为nil时同时上报给sink
+type cacheStats struct {
+	hits, misses           atomic.Int64
+	evictions, expirations atomic.Int64
+	bytes, entries         atomic.Int64
+
+	sink   MetricsSink
+	labels []string // group, cache
+}
+
+func (st *cacheStats) count(c *atomic.Int64, name string) {
+	c.Add(1)
+	if st.sink != nil {
+		st.sink.Counter(name, 1, st.labels...)
+	}
+}
+
+// resize 记录shard的内存与条目数变化
+func (st *cacheStats) resize(bytes, entries int) {
+	if bytes == 0 && entries == 0 {
+		return
+	}
+	b, e := st.bytes.Add(int64(bytes)), st.entries.Add(int64(entries))
+	if st.sink != nil {
+		st.sink.Gauge(MetricCacheBytes, float64(b), st.labels...)
+		st.sink.Gauge(MetricCacheEntries, float64(e), st.labels...)
+	}
+}
+
+// setMetrics 需在cache使用之前调用
+func (c *cache) setMetrics(sink MetricsSink, group, name string) {
+	c.stats.sink = sink
+	c.stats.labels = []string{"group", group, "cache", name}
+}
+
+type graceEntry struct {
+	ByteView
+	deadline time.Time
+}
+
+// Expire 淘汰算法看到的过期时间
+func (e graceEntry) Expire() time.Time {
+	return e.deadline
+}
+
+type shard struct {
+	mu         sync.Mutex
+	policy     policy.Policy
+	newPolicy  policy.Factory // 为nil时使用lru
+	cacheBytes int
+
+	stats    *cacheStats
+	bytes    int  // 上次同步到stats时的内存
+	entries  int  // 上次同步到stats时的条目数
+	removing bool // 正在主动删除 此时的淘汰回调不计入统计
+}
+
+// newCache shards<=1时只有一个shard 此时淘汰行为与单个policy完全一致
+func newCache(capacity int, newPolicy policy.Factory, shards int) *cache {
+	if shards < 1 {
+		shards = 1
+	}
+	c := &cache{
+		shards:     make([]*shard, shards),
 		cacheBytes: capacity,
+		stats:      &cacheStats{},
+	}
+	for i := range c.shards {
+		c.shards[i] = &shard{
+			newPolicy:  newPolicy,
+			cacheBytes: capacity / shards,
+			stats:      c.stats,
+		}
+	}
+	// 无法整除的部分分给第一个shard
+	c.shards[0].cacheBytes += capacity % shards
+	return c
+}
+
+func (c *cache) shard(key string) *shard {
+	if len(c.shards) == 1 {
+		return c.shards[0]
 	}
+	return c.shards[fnv32(key)%uint32(len(c.shards))]
 }
 
 func (c *cache) add(key string, value ByteView) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	if c.lru == nil {
+	if c.grace > 0 && !value.expire.IsZero() {
+		c.shard(key).add(key, graceEntry{ByteView: value, deadline: value.expire.Add(c.grace)})
+		return
+	}
+	c.shard(key).add(key, value)
+}
+
+// get 用户请求的查找 计入命中与未命中
+func (c *cache) get(key string) (value ByteView, ok bool) {
+	value, ok = c.peek(key)
+	if ok {
+		c.stats.count(&c.stats.hits, MetricCacheHits)
+	} else {
+		c.stats.count(&c.stats.misses, MetricCacheMisses)
+	}
+	return
+}
+
+// peek 与get相同但不计入命中率 用于handoff等内部的查找
+func (c *cache) peek(key string) (ByteView, bool) {
+	return c.shard(key).get(key)
+}
+
+func (c *cache) remove(key string) {
+	c.shard(key).remove(key)
+}
+
+// rangeEntries 逐个shard复制键值后在锁外调用fn 直到fn返回false
+func (c *cache) rangeEntries(fn func(key string, value ByteView) bool) {
+	for _, s := range c.shards {
+		if !s.rangeEntries(fn) {
+			return
+		}
+	}
+}
+
+func (s *shard) rangeEntries(fn func(key string, value ByteView) bool) bool {
+	type kv struct {
+		key   string
+		value ByteView
+	}
+	var entries []kv
+	s.mu.Lock()
+	if r, ok := s.policy.(policy.Ranger); ok {
+		r.Range(func(key string, value policy.Value) bool {
+			if e, isGrace := value.(graceEntry); isGrace {
+				entries = append(entries, kv{key, e.ByteView})
+			} else {
+				entries = append(entries, kv{key, value.(ByteView)})
+			}
+			return true
+		})
+	}
+	s.mu.Unlock()
+
+	for _, e := range entries {
+		if !fn(e.key, e.value) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *shard) add(key string, value policy.Value) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.policy == nil {
 		//延迟初始化
-		c.lru = lru.New(c.cacheBytes, nil)
+		newPolicy := s.newPolicy
+		if newPolicy == nil {
+			newPolicy = policy.LRU
+		}
+		s.policy = newPolicy(s.cacheBytes, s.onEvicted)
+	}
+	s.policy.Add(key, value)
+	s.sync()
+}
+
+// onEvicted 区分容量淘汰与过期删除 调用方持有锁
+func (s *shard) onEvicted(key string, value policy.Value) {
+	if s.removing {
+		return
+	}
+	if expire := value.Expire(); !expire.IsZero() && !expire.After(time.Now()) {
+		s.stats.count(&s.stats.expirations, MetricCacheExpirations)
+	} else {
+		s.stats.count(&s.stats.evictions, MetricCacheEvictions)
 	}
-	c.lru.Add(key, value)
+}
 
+// sync 将policy的内存与条目数变化同步到stats 调用方持有锁
+func (s *shard) sync() {
+	bytes, entries := s.policy.Bytes(), s.policy.Len()
+	s.stats.resize(bytes-s.bytes, entries-s.entries)
+	s.bytes, s.entries = bytes, entries
 }
 
-func (c *cache) get(key string) (value ByteView, ok bool) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	if c.lru == nil {
+func (s *shard) get(key string) (value ByteView, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.policy == nil {
 		return
 	}
-	if v, ok := c.lru.Get(key); ok {
-		return v.(ByteView), ok
+	v, ok := s.policy.Get(key)
+	if !ok {
+		s.sync() // 可能删除了过期键
+		return
 	}
-	return
+	if e, isGrace := v.(graceEntry); isGrace {
+		return e.ByteView, true
+	}
+	return v.(ByteView), true
 }
 
-func (c *cache) remove(key string) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	if c.lru == nil {
+func (s *shard) remove(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.policy == nil {
 		return
 	}
-	c.lru.Remove(key)
+	s.removing = true
+	s.policy.Remove(key)
+	s.removing = false
+	s.sync()
+}
+
+// fnv32 为FNV-1a 用于选择shard
+func fnv32(key string) uint32 {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return h
 }
@@ -1,9 +1,15 @@
 package geecache
 
 import (
+	"GeeCache/geecache/policy"
+	"GeeCache/geecache/tinylfu"
 	"fmt"
 	"log"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 var db = map[string]string{
@@ -43,3 +49,209 @@ func TestGet(t *testing.T) {
 	}
 
 }
+
+func TestGroupPolicy(t *testing.T) {
+	policies := map[string]policy.Factory{
+		"lfu":  policy.LFU,
+		"lru2": policy.LRUK(2),
+		"2q":   policy.TwoQ,
+		"arc":  policy.ARC,
+	}
+	for name, newPolicy := range policies {
+		loads := 0
+		g := NewGroup("policy-"+name, 2<<10, GetterFunc(
+			func(key string) (ByteView, error) {
+				loads++
+				return NewByteView([]byte(db[key])), nil
+			}), WithPolicy(newPolicy))
+		for i := 0; i < 2; i++ {
+			if v, err := g.Get("Tom"); err != nil || v.String() != "630" {
+				t.Fatalf("[%s] failed to get Tom", name)
+			}
+		}
+		if loads != 1 {
+			t.Fatalf("[%s] Tom should be cached, loads=%d", name, loads)
+		}
+		if _, ok := g.mainCache.shards[0].policy.(*policy.LRUKCache); name == "lru2" && !ok {
+			t.Fatalf("[%s] policy not applied", name)
+		}
+	}
+}
+
+func TestGroupAdmission(t *testing.T) {
+	g := NewGroup("admission", 2<<10, GetterFunc(
+		func(key string) (ByteView, error) {
+			return NewByteView([]byte(key)), nil
+		}), WithAdmission(), WithPolicy(policy.LFU))
+	if v, err := g.Get("Tom"); err != nil || v.String() != "Tom" {
+		t.Fatal("failed to get Tom")
+	}
+	if _, ok := g.mainCache.shards[0].policy.(*tinylfu.Cache); !ok {
+		t.Fatal("admission should wrap the policy")
+	}
+}
+
+func TestCacheShards(t *testing.T) {
+	c := newCache(1000, nil, 8)
+	total := 0
+	for _, s := range c.shards {
+		total += s.cacheBytes
+	}
+	if total != 1000 {
+		t.Fatalf("shards should split cacheBytes, got %d", total)
+	}
+
+	// go test -race 检查并发读写
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				key := strconv.Itoa((i * j) % 100)
+				c.add(key, NewByteView([]byte(key)))
+				if v, ok := c.get(key); ok && v.String() != key {
+					t.Errorf("get %s returned %s", key, v.String())
+				}
+				if j%10 == 0 {
+					c.remove(key)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+// go test -bench CacheParallel -run ^$ -cpu 1,4,16
+func BenchmarkCacheParallel(b *testing.B) {
+	keys := make([]string, 4096)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+	for _, shards := range []int{1, 16} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			c := newCache(1<<20, nil, shards)
+			for _, key := range keys {
+				c.add(key, NewByteView([]byte(key)))
+			}
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					key := keys[i%len(keys)]
+					if i%10 == 0 {
+						c.add(key, NewByteView([]byte(key)))
+					} else {
+						c.get(key)
+					}
+					i++
+				}
+			})
+		})
+	}
+}
+
+func TestJanitor(t *testing.T) {
+	c := newCache(0, nil, 4)
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(i)
+		c.add(key, NewByteViewWithTTL([]byte(key), 10*time.Millisecond))
+	}
+	c.add("Tom", NewByteView([]byte("630")))
+	c.startJanitor(5*time.Millisecond, 10)
+	defer c.Close()
+
+	// 不调用get 由后台协程清理
+	deadline := time.Now().Add(time.Second)
+	for cacheLen(c) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("janitor should remove expired keys, %d left", cacheLen(c))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if v, ok := c.get("Tom"); !ok || v.String() != "630" {
+		t.Fatal("unexpired Tom should stay")
+	}
+
+	c.Close()
+	c.Close() // 可以重复调用
+}
+
+func cacheLen(c *cache) int {
+	n := 0
+	for _, s := range c.shards {
+		s.mu.Lock()
+		if s.policy != nil {
+			n += s.policy.Len()
+		}
+		s.mu.Unlock()
+	}
+	return n
+}
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	var loads int32
+	g := NewGroup("stale", 2<<10, GetterFunc(func(key string) (ByteView, error) {
+		n := atomic.AddInt32(&loads, 1)
+		return NewByteViewWithTTL([]byte(strconv.Itoa(int(n))), 50*time.Millisecond), nil
+	}), WithStaleWhileRevalidate(time.Second))
+
+	if v, _ := g.Get("Tom"); v.String() != "1" {
+		t.Fatalf("expect 1, got %s", v)
+	}
+	time.Sleep(80 * time.Millisecond)
+	// 已过期但处于grace窗口 立即返回旧值 只触发一次后台刷新
+	for i := 0; i < 10; i++ {
+		if v, err := g.Get("Tom"); err != nil || v.String() != "1" {
+			t.Fatalf("expect stale 1, got %s %v", v, err)
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+	if v, _ := g.Get("Tom"); v.String() != "2" {
+		t.Fatalf("expect refreshed 2, got %s", v)
+	}
+	if n := atomic.LoadInt32(&loads); n != 2 {
+		t.Fatalf("expect 2 loads, got %d", n)
+	}
+
+	// 超过grace后与普通过期相同
+	time.Sleep(1100 * time.Millisecond)
+	if v, _ := g.Get("Tom"); v.String() != "3" {
+		t.Fatalf("expect reload 3 after grace, got %s", v)
+	}
+}
+
+func TestRefreshAhead(t *testing.T) {
+	var loads int32
+	g := NewGroup("refresh-ahead", 2<<10, GetterFunc(func(key string) (ByteView, error) {
+		n := atomic.AddInt32(&loads, 1)
+		time.Sleep(10 * time.Millisecond)
+		return NewByteViewWithTTL([]byte(strconv.Itoa(int(n))), 200*time.Millisecond), nil
+	}), WithRefreshAhead(1000))
+
+	g.Get("Tom")
+	// beta很大时 在过期前就会被刷新
+	deadline := time.Now().Add(150 * time.Millisecond)
+	for time.Now().Before(deadline) && atomic.LoadInt32(&loads) < 2 {
+		if v, err := g.Get("Tom"); err != nil || v.String() == "" {
+			t.Fatalf("read should never miss, got %s %v", v, err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := atomic.LoadInt32(&loads); n < 2 {
+		t.Fatal("Tom should be refreshed before expiry")
+	}
+
+	// 不开启时不提前刷新
+	var loads2 int32
+	g2 := NewGroup("no-refresh-ahead", 2<<10, GetterFunc(func(key string) (ByteView, error) {
+		atomic.AddInt32(&loads2, 1)
+		return NewByteViewWithTTL([]byte("630"), time.Minute), nil
+	}))
+	for i := 0; i < 100; i++ {
+		g2.Get("Tom")
+	}
+	if n := atomic.LoadInt32(&loads2); n != 1 {
+		t.Fatalf("expect 1 load, got %d", n)
+	}
+}
@@ -2,77 +2,237 @@ package geecache
 
 import (
 	pb "GeeCache/geecache/geecachepb"
-	"GeeCache/geecache/register_node"
 	"context"
+	"errors"
 	"fmt"
-	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"sync"
 	"time"
 )
 
+// 调用方未设置deadline时 远端请求的默认超时时间
+const defaultFetchTimeout = 10 * time.Second
+
 type Client struct {
-	name string
+	name    string
+	pool    *connPool // 为nil时使用defaultPool
+	policy  PeerPolicy
+	breaker *breaker // 为nil时不熔断
+	latency latency  // 最近成功请求的延迟 用于计算对冲的等待时间
+	signer  Signer   // 不为nil时为每个rpc附加凭证
+	tracer  Tracer   // 不为nil时在rpc的metadata中传播trace上下文
+
+	// track 不为nil时在rpc期间计入该节点的负载 用于有界负载
+	track func(addr string) (done func())
+}
+
+var (
+	defaultPoolOnce sync.Once
+	defaultPool     *connPool
+)
+
+// Name 返回peer的地址
+func (c *Client) Name() string {
+	return c.name
+}
+
+// connPool 由server创建的Client共享server的连接池 单独创建的Client共享defaultPool
+func (c *Client) connPool() *connPool {
+	if c.pool != nil {
+		return c.pool
+	}
+	defaultPoolOnce.Do(func() {
+		defaultPool = newConnPool(nil, 0)
+	})
+	return defaultPool
 }
 
 func (c *Client) Fetch(group string, key string) (ByteView, error) {
-	cli, err := clientv3.New(defaultEtcdConfig)
+	return c.FetchContext(context.Background(), group, key)
+}
+
+// FetchContext 从远端节点获取缓存 ctx的deadline/取消会传递给etcd解析与gRPC调用
+// 若ctx没有deadline 则使用defaultFetchTimeout
+func (c *Client) FetchContext(ctx context.Context, group string, key string) (ByteView, error) {
+	var resp *pb.Response
+	err := c.call(ctx, func(ctx context.Context, grpcClient pb.GroupCacheClient) (err error) {
+		resp, err = grpcClient.Get(ctx, &pb.Request{
+			Group: group,
+			Key:   key,
+		})
+		return err
+	})
 	if err != nil {
-		return ByteView{}, err
+		return ByteView{}, fmt.Errorf("could not get %s/%s from peer %s: %w", group, key, c.name, err)
 	}
-	defer cli.Close()
-	conn, err := register_node.EtcdDial(cli, c.name)
-	if err != nil {
-		return ByteView{}, err
+	return viewFromResponse(resp)
+}
+
+// viewFromResponse 将rpc响应还原为ByteView 包括过期时间与Metadata
+func viewFromResponse(resp *pb.Response) (ByteView, error) {
+	expire := expireFromUnixNano(resp.GetExpire())
+	if !expire.IsZero() && time.Now().After(expire) {
+		return ByteView{}, fmt.Errorf("peer returned expired value")
 	}
-	defer conn.Close()
-	grpcClient := pb.NewGroupCacheClient(conn)
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-	resp, err := grpcClient.Get(ctx, &pb.Request{
-		Group: group,
-		Key:   key,
+
+	return ByteView{
+		b:      resp.GetValue(),
+		expire: expire,
+		meta: Metadata{
+			Version:     resp.GetVersion(),
+			Flags:       resp.GetFlags(),
+			ContentType: resp.GetContentType(),
+		},
+	}, nil
+}
+
+// FetchMany 通过一次BatchGet获取多个key 返回的结果与keys一一对应
+func (c *Client) FetchMany(ctx context.Context, group string, keys []string) ([]Result, error) {
+	var resp *pb.BatchResponse
+	err := c.call(ctx, func(ctx context.Context, grpcClient pb.GroupCacheClient) (err error) {
+		resp, err = grpcClient.BatchGet(ctx, &pb.BatchRequest{
+			Group: group,
+			Keys:  keys,
+		})
+		return err
 	})
 	if err != nil {
-		return ByteView{}, fmt.Errorf("could not get %s/%s from peer %s", group, key, c.name)
+		return nil, fmt.Errorf("could not batch get %d keys of %s from peer %s: %w", len(keys), group, c.name, err)
+	}
+	entries := resp.GetEntries()
+	if len(entries) != len(keys) {
+		return nil, fmt.Errorf("peer %s returned %d entries for %d keys", c.name, len(entries), len(keys))
 	}
-	var expire time.Time
-	if resp.Expire != 0 {
-		expire = time.Unix(resp.Expire/int64(time.Second), resp.Expire%int64(time.Second))
-		if time.Now().After(expire) {
-			return ByteView{}, fmt.Errorf("peer returned expired value")
+	results := make([]Result, len(keys))
+	for i, entry := range entries {
+		if entry.GetError() != "" {
+			results[i].Err = fmt.Errorf("could not get %s/%s from peer %s: %s", group, keys[i], c.name, entry.GetError())
+			continue
 		}
+		results[i].Value, results[i].Err = viewFromResponse(entry.GetValue())
 	}
+	return results, nil
+}
 
-	return ByteView{resp.Value, expire}, nil
+// Set 将value写入远端节点的mainCache
+func (c *Client) Set(ctx context.Context, group string, key string, value ByteView) error {
+	err := c.call(ctx, func(ctx context.Context, grpcClient pb.GroupCacheClient) error {
+		_, err := grpcClient.Set(ctx, setRequest(group, key, value))
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("could not set %s/%s to peer %s: %w", group, key, c.name, err)
+	}
+	return nil
 }
 
-/*
-	func (c *Client)Delete(group string, key string) ([]byte, error) {
-		cli, err := clientv3.New(defaultEtcdConfig)
-		if err != nil {
-			return nil, err
+// setRequest 将ByteView转换为写请求 包括过期时间与Metadata
+func setRequest(group string, key string, value ByteView) *pb.SetRequest {
+	return &pb.SetRequest{
+		Group:       group,
+		Key:         key,
+		Value:       value.b,
+		Expire:      expireToUnixNano(value.expire),
+		Version:     value.meta.Version,
+		Flags:       value.meta.Flags,
+		ContentType: value.meta.ContentType,
+	}
+}
+
+// Delete 删除远端节点上的缓存 hotOnly为true时只删除hotCache中的副本
+func (c *Client) Delete(ctx context.Context, group string, key string, hotOnly bool) error {
+	err := c.call(ctx, func(ctx context.Context, grpcClient pb.GroupCacheClient) error {
+		_, err := grpcClient.Delete(ctx, &pb.DeleteRequest{
+			Group:   group,
+			Key:     key,
+			HotOnly: hotOnly,
+		})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("could not delete %s/%s from peer %s: %w", group, key, c.name, err)
+	}
+	return nil
+}
+
+// call 按policy执行rpc 可重试的错误会在随机退避后重试 节点熔断时直接返回ErrBreakerOpen
+func (c *Client) call(ctx context.Context, fn func(ctx context.Context, grpcClient pb.GroupCacheClient) error) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultFetchTimeout)
+		defer cancel()
+	}
+	ctx = injectTrace(ctx, c.tracer)
+	if c.track != nil {
+		defer c.track(c.name)()
+	}
+	var err error
+	for attempt := 0; ; attempt++ {
+		if !c.breaker.allow() {
+			if err == nil {
+				return ErrBreakerOpen
+			}
+			return err
 		}
-		defer cli.Close()
-		conn, err := register_node.EtcdDial(cli, c.name)
-		if err != nil {
-			return nil, err
+		start := time.Now()
+		err = c.attempt(ctx, fn)
+		c.breaker.record(err)
+		if err == nil {
+			c.latency.add(time.Since(start))
+			return nil
 		}
-		defer conn.Close()
-		grpcClient := pb.NewGroupCacheClient(conn)
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-		resp, err := grpcClient.Delete(ctx, &pb.Request{
-			Group: group,
-			Key:   key,
-		})
-		if err != nil {
-			return nil, fmt.Errorf("could not get %s/%s from peer %s", group, key, c.name)
+		if attempt >= c.policy.Retries || !retryable(err) || ctx.Err() != nil {
+			return err
 		}
-		return resp.GetValue(), nil
+		timer := time.NewTimer(c.policy.backoff(attempt))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+}
+
+// attempt 从连接池取出peer的连接后执行一次rpc
+// rpc返回Unavailable说明连接可能已失效 丢弃它以便下次重新建立
+func (c *Client) attempt(ctx context.Context, fn func(ctx context.Context, grpcClient pb.GroupCacheClient) error) error {
+	pool := c.connPool()
+	conn, err := pool.get(ctx, c.name)
+	if err != nil {
+		if errors.Is(err, errPoolClosed) {
+			return err
+		}
+		return fmt.Errorf("%w: %w", errUnreachable, err)
+	}
+	err = fn(ctx, c.grpcClient(conn))
+	if status.Code(err) == codes.Unavailable {
+		pool.markBad(c.name, conn)
 	}
-*/
+	return err
+}
+
+// HedgeDelay 返回最近请求的p95延迟 policy未开启对冲或样本不足时返回false
+func (c *Client) HedgeDelay() (time.Duration, bool) {
+	if !c.policy.Hedge {
+		return 0, false
+	}
+	return c.latency.p95()
+}
+
+// BreakerState 返回该节点熔断器的状态
+func (c *Client) BreakerState() BreakerState {
+	return c.breaker.State()
+}
+
 func NewClient(addr string) *Client {
 	return &Client{name: addr}
 
 }
 
 var _ Fetcher = (*Client)(nil)
+var _ ContextFetcher = (*Client)(nil)
+var _ PeerWriter = (*Client)(nil)
+var _ BatchFetcher = (*Client)(nil)
+var _ Hedger = (*Client)(nil)
@@ -2,6 +2,8 @@ package consistenthash
 
 import (
 	"hash/crc32"
+	"math"
+	"slices"
 	"sort"
 	"strconv"
 )
@@ -13,38 +15,94 @@ var (
 
 type Hash func(data []byte) uint32
 
+// Map 一致性哈希环
+// 每个节点在环上有replicas*weight个虚拟节点 权重越大分到的key越多
+//
+// 可选的有界负载模式(Consistent Hashing with Bounded Loads, Mirrokni et al.):
+// 调用方通过Inc/Done报告各节点的负载 当顺时针找到的节点负载超过
+// (1+ε)*平均负载(按权重分摊)时 key溢出到环上的下一个节点
+//
+// Warning: 不提供并发保护 由调用方加锁
 type Map struct {
 	hash     Hash
 	replicas int   //虚拟节点倍数
 	keys     []int //sorted
 	hashMap  map[int]string
+	weights  map[string]int // 节点 -> 权重
+	total    int            // 权重之和
+
+	epsilon   float64 // >0时开启有界负载
+	loads     map[string]int64
+	totalLoad int64
 }
 
 type ConsOptions func(*Map)
 
-func New(replicas int, fn Hash) *Map {
+// WithBoundedLoad 开启有界负载 每个节点的负载不超过(1+epsilon)倍的平均负载
+func WithBoundedLoad(epsilon float64) ConsOptions {
+	return func(m *Map) {
+		m.epsilon = epsilon
+	}
+}
+
+func New(replicas int, fn Hash, opts ...ConsOptions) *Map {
 	m := &Map{
 		replicas: replicas,
 		hash:     fn,
 		hashMap:  make(map[int]string),
+		weights:  make(map[string]int),
+		loads:    make(map[string]int64),
 	}
 	if m.hash == nil { // 默认散列函数为crc32
 		m.hash = crc32.ChecksumIEEE
 	}
+	for _, opt := range opts {
+		opt(m)
+	}
 	return m
 }
 
+// Register 以权重1注册节点
 func (m *Map) Register(keys ...string) {
 	for _, key := range keys {
-		for i := 0; i < m.replicas; i++ {
-			hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
-			m.keys = append(m.keys, hash)
-			m.hashMap[hash] = key
+		m.add(key, 1)
+	}
+	sort.Ints(m.keys)
+}
+
+// RegisterWeighted 注册带权重的节点 虚拟节点数为replicas*weight
+// 已存在的节点会以新的权重重新注册
+func (m *Map) RegisterWeighted(key string, weight int) {
+	if weight <= 0 {
+		weight = 1
+	}
+	if w, ok := m.weights[key]; ok {
+		if w == weight {
+			return
 		}
+		m.Remove(key)
 	}
+	m.add(key, weight)
 	sort.Ints(m.keys)
 }
 
+// add 调用方需在之后对keys排序
+func (m *Map) add(key string, weight int) {
+	if _, ok := m.weights[key]; ok {
+		return
+	}
+	m.weights[key] = weight
+	m.total += weight
+	for i := 0; i < m.replicas*weight; i++ {
+		hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
+		if _, ok := m.hashMap[hash]; ok {
+			continue // 与其他虚拟节点冲突
+		}
+		m.keys = append(m.keys, hash)
+		m.hashMap[hash] = key
+	}
+}
+
 // 选择节点
 func (m *Map) Get(key string) string {
 	if len(m.keys) == 0 {
@@ -54,21 +112,108 @@ func (m *Map) Get(key string) string {
 	idx := sort.Search(len(m.keys), func(i int) bool {
 		return m.keys[i] >= hash
 	})
+	if m.epsilon <= 0 {
+		return m.hashMap[m.keys[idx%len(m.keys)]]
+	}
+	// 有界负载 顺时针找到第一个未超载的节点
+	for i := 0; i < len(m.keys); i++ {
+		node := m.hashMap[m.keys[(idx+i)%len(m.keys)]]
+		if m.loads[node]+1 <= m.maxLoad(node) {
+			return node
+		}
+	}
 	return m.hashMap[m.keys[idx%len(m.keys)]]
 }
 
+// GetN 返回从key的位置顺时针遇到的前n个不同节点 第一个即Get(不考虑负载)的结果
+// 节点数不足n时返回所有节点
+func (m *Map) GetN(key string, n int) []string {
+	if len(m.keys) == 0 || n <= 0 {
+		return nil
+	}
+	if n > len(m.weights) {
+		n = len(m.weights)
+	}
+	hash := int(m.hash([]byte(key)))
+	idx := sort.Search(len(m.keys), func(i int) bool {
+		return m.keys[i] >= hash
+	})
+	nodes := make([]string, 0, n)
+	for i := 0; i < len(m.keys) && len(nodes) < n; i++ {
+		node := m.hashMap[m.keys[(idx+i)%len(m.keys)]]
+		if !slices.Contains(nodes, node) {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// maxLoad 按权重分摊的负载上限 ceil((totalLoad+1)*(1+ε)*w/W)
+func (m *Map) maxLoad(node string) int64 {
+	avg := float64(m.totalLoad+1) * float64(m.weights[node]) / float64(m.total)
+	return int64(math.Ceil(avg * (1 + m.epsilon)))
+}
+
+// Inc 节点的负载加一 通常在把key分配给节点或发出请求时调用
+func (m *Map) Inc(node string) {
+	if _, ok := m.weights[node]; !ok {
+		return
+	}
+	m.loads[node]++
+	m.totalLoad++
+}
+
+// Done 节点的负载减一 与Inc配对
+func (m *Map) Done(node string) {
+	if m.loads[node] <= 0 {
+		return
+	}
+	m.loads[node]--
+	m.totalLoad--
+}
+
+// Loads 返回各节点当前的负载
+func (m *Map) Loads() map[string]int64 {
+	loads := make(map[string]int64, len(m.weights))
+	for node := range m.weights {
+		loads[node] = m.loads[node]
+	}
+	return loads
+}
+
+// Members 返回所有节点
+func (m *Map) Members() []string {
+	members := make([]string, 0, len(m.weights))
+	for node := range m.weights {
+		members = append(members, node)
+	}
+	sort.Strings(members)
+	return members
+}
+
 func (m *Map) Remove(keys ...string) {
 	for _, key := range keys {
-		for i := 0; i < m.replicas; i++ {
+		weight, ok := m.weights[key]
+		if !ok {
+			continue
+		}
+		for i := 0; i < m.replicas*weight; i++ {
 			hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
-			delete(m.hashMap, hash)
+			if m.hashMap[hash] == key {
+				delete(m.hashMap, hash)
+			}
 		}
+		delete(m.weights, key)
+		m.total -= weight
+		m.totalLoad -= m.loads[key]
+		delete(m.loads, key)
 	}
-	newKeys := make([]int, 0, len(m.hashMap)) // 重建哈希环
-	for key := range m.hashMap {
-		newKeys = append(newKeys, key)
+	// keys本身有序 原地过滤掉已删除的虚拟节点即可 无需重新排序
+	ring := m.keys[:0]
+	for _, hash := range m.keys {
+		if _, ok := m.hashMap[hash]; ok {
+			ring = append(ring, hash)
+		}
 	}
-	m.keys = newKeys
-	sort.Ints(m.keys)
-
+	m.keys = ring
 }
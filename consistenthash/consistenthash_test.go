@@ -34,3 +34,137 @@ func TestHashing(t *testing.T) {
 		}
 	}
 }
+
+// share 统计n个key在各节点上的分布
+func share(m *Map, n int) map[string]int {
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		counts[m.Get("key"+strconv.Itoa(i))]++
+	}
+	return counts
+}
+
+func TestWeighted(t *testing.T) {
+	const n = 100000
+	m := New(100, nil)
+	m.Register("a", "b")
+	m.RegisterWeighted("c", 4)
+
+	// c的权重是a、b的4倍 应分到约2/3的key
+	counts := share(m, n)
+	if frac := float64(counts["c"]) / n; frac < 0.58 || frac > 0.75 {
+		t.Fatalf("expect c to own ~0.67 of keys, got %.3f (%v)", frac, counts)
+	}
+	for _, node := range []string{"a", "b"} {
+		if frac := float64(counts[node]) / n; frac < 0.1 || frac > 0.24 {
+			t.Fatalf("expect %s to own ~0.17 of keys, got %.3f (%v)", node, frac, counts)
+		}
+	}
+
+	// 降低权重后 只有c的部分key被重新分配
+	before := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		key := "key" + strconv.Itoa(i)
+		before[key] = m.Get(key)
+	}
+	m.RegisterWeighted("c", 1)
+	for key, owner := range before {
+		if owner != "c" && m.Get(key) != owner {
+			t.Fatalf("%s should stay on %s", key, owner)
+		}
+	}
+	counts = share(m, n)
+	if frac := float64(counts["c"]) / n; frac < 0.23 || frac > 0.43 {
+		t.Fatalf("expect c to own ~1/3 of keys after reweight, got %.3f", frac)
+	}
+
+	m.Remove("c")
+	if len(m.Members()) != 2 {
+		t.Fatalf("expect 2 members, got %v", m.Members())
+	}
+	if counts := share(m, 1000); counts["c"] != 0 {
+		t.Fatal("removed node should not own keys")
+	}
+}
+
+func TestBoundedLoad(t *testing.T) {
+	const (
+		nodes   = 10
+		keys    = 10000
+		epsilon = 0.25
+	)
+	maxLoad := func(m *Map) int64 {
+		var max int64
+		for i := 0; i < keys; i++ {
+			node := m.Get("key" + strconv.Itoa(i))
+			m.Inc(node)
+		}
+		for _, load := range m.Loads() {
+			if load > max {
+				max = load
+			}
+		}
+		return max
+	}
+	register := func(m *Map) {
+		for i := 0; i < nodes; i++ {
+			m.Register("node" + strconv.Itoa(i))
+		}
+	}
+
+	plain := New(10, nil)
+	register(plain)
+	bounded := New(10, nil, WithBoundedLoad(epsilon))
+	register(bounded)
+
+	limit := int64(float64(keys) / nodes * (1 + epsilon))
+	unbounded := maxLoad(plain)
+	got := maxLoad(bounded)
+	if got > limit+1 {
+		t.Fatalf("max load %d exceeds (1+ε)*avg=%d", got, limit)
+	}
+	if unbounded <= got {
+		t.Fatalf("bounded load should lower the max load, %d vs %d", got, unbounded)
+	}
+
+	// Done之后负载降低 key重新回到原本的节点
+	for node, load := range bounded.Loads() {
+		for i := int64(0); i < load; i++ {
+			bounded.Done(node)
+		}
+	}
+	for i := 0; i < 1000; i++ {
+		key := "key" + strconv.Itoa(i)
+		if bounded.Get(key) != plain.Get(key) {
+			t.Fatalf("without load %s should map to its ring owner", key)
+		}
+	}
+}
+
+func TestGetN(t *testing.T) {
+	m := New(50, nil)
+	if m.GetN("key", 2) != nil {
+		t.Fatal("empty ring should return no node")
+	}
+	m.Register("a", "b", "c", "d")
+	for i := 0; i < 1000; i++ {
+		key := "key" + strconv.Itoa(i)
+		nodes := m.GetN(key, 3)
+		if len(nodes) != 3 || nodes[0] != m.Get(key) {
+			t.Fatalf("%s: unexpected replicas %v", key, nodes)
+		}
+		if nodes[0] == nodes[1] || nodes[1] == nodes[2] || nodes[0] == nodes[2] {
+			t.Fatalf("%s: replicas should be distinct, got %v", key, nodes)
+		}
+	}
+	if nodes := m.GetN("key", 10); len(nodes) != 4 {
+		t.Fatalf("expect all 4 nodes, got %v", nodes)
+	}
+
+	// 主节点移除后 原来的第一个副本成为主节点
+	nodes := m.GetN("key1", 2)
+	m.Remove(nodes[0])
+	if got := m.Get("key1"); got != nodes[1] {
+		t.Fatalf("expect %s to take over key1, got %s", nodes[1], got)
+	}
+}
@@ -0,0 +1,67 @@
+package discovery
+
+import (
+	"GeeCache/geecache/logger"
+	"context"
+	"sort"
+)
+
+// discovery 抽象节点的服务发现
+// 之前节点成员关系写死为localhost:2379上的etcd 单元测试和小规模部署都离不开etcd
+// 现在etcd只是其中一种实现 此外还有:
+//   - Static: 固定的节点列表
+//   - File:   JSON/YAML文件 修改文件即可增删节点
+//   - Memory: 进程内注册中心 用于测试
+
+// Discovery 定义了注册自身、列出节点、监听节点变化的能力
+type Discovery interface {
+	// Register 将addr注册为一个节点 阻塞直到ctx结束或出错 返回前注销addr
+	Register(ctx context.Context, addr string) error
+	// List 返回当前所有节点(包括自己) 结果已排序
+	List(ctx context.Context) ([]string, error)
+	// Watch 先发送一次当前的节点列表 之后每次节点变化都发送完整的节点列表
+	// ctx结束时channel被关闭
+	Watch(ctx context.Context) (<-chan []string, error)
+}
+
+// LoggerSetter 是Discovery的可选接口 server启动时把自己的Logger交给服务发现
+type LoggerSetter interface {
+	SetLogger(l logger.Logger)
+}
+
+// normalize 去重并排序 使相同的成员关系总是得到相同的列表
+func normalize(addrs []string) []string {
+	set := make(map[string]struct{}, len(addrs))
+	out := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		if _, ok := set[addr]; ok || addr == "" {
+			continue
+		}
+		set[addr] = struct{}{}
+		out = append(out, addr)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// send 发送节点列表 ctx结束时放弃
+func send(ctx context.Context, ch chan<- []string, peers []string) bool {
+	select {
+	case ch <- peers:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
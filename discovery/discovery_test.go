@@ -0,0 +1,129 @@
+package discovery
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// next 读取下一次节点列表 超时则失败
+func next(t *testing.T, ch <-chan []string) []string {
+	t.Helper()
+	select {
+	case peers, ok := <-ch:
+		if !ok {
+			t.Fatal("watch channel closed")
+		}
+		return peers
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for peers")
+	}
+	return nil
+}
+
+func expectPeers(t *testing.T, got []string, expect ...string) {
+	t.Helper()
+	if len(got) != len(expect) || (len(expect) > 0 && !reflect.DeepEqual(got, expect)) {
+		t.Fatalf("expect peers %v, got %v", expect, got)
+	}
+}
+
+func TestStatic(t *testing.T) {
+	d := NewStatic("127.0.0.1:8002", "127.0.0.1:8001", "127.0.0.1:8002")
+	peers, _ := d.List(context.Background())
+	expectPeers(t, peers, "127.0.0.1:8001", "127.0.0.1:8002")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, _ := d.Watch(ctx)
+	expectPeers(t, next(t, ch), "127.0.0.1:8001", "127.0.0.1:8002")
+	cancel()
+	if _, ok := <-ch; ok {
+		t.Fatal("watch channel should be closed after ctx done")
+	}
+}
+
+func TestMemory(t *testing.T) {
+	d := NewMemory()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, _ := d.Watch(ctx)
+	expectPeers(t, next(t, ch))
+
+	regCtx, unregister := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- d.Register(regCtx, "127.0.0.1:8001")
+	}()
+	expectPeers(t, next(t, ch), "127.0.0.1:8001")
+
+	d.Add("127.0.0.1:8002")
+	expectPeers(t, next(t, ch), "127.0.0.1:8001", "127.0.0.1:8002")
+
+	// Register返回前注销自己
+	unregister()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	expectPeers(t, next(t, ch), "127.0.0.1:8002")
+	peers, _ := d.List(context.Background())
+	expectPeers(t, peers, "127.0.0.1:8002")
+}
+
+func TestFile(t *testing.T) {
+	for _, name := range []string{"peers.json", "peers.yaml"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			write := func(peers ...string) {
+				var data string
+				if filepath.Ext(name) == ".json" {
+					data = `{"peers": [`
+					for i, p := range peers {
+						if i > 0 {
+							data += ","
+						}
+						data += `"` + p + `"`
+					}
+					data += "]}"
+				} else {
+					data = "peers:\n"
+					for _, p := range peers {
+						data += "  - " + p + "\n"
+					}
+				}
+				if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			write("127.0.0.1:8001")
+			d := NewFile(path, 10*time.Millisecond)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			ch, err := d.Watch(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expectPeers(t, next(t, ch), "127.0.0.1:8001")
+
+			write("127.0.0.1:8002", "127.0.0.1:8001")
+			expectPeers(t, next(t, ch), "127.0.0.1:8001", "127.0.0.1:8002")
+
+			// 格式错误时保留上一次的列表
+			if err := os.WriteFile(path, []byte("{"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(50 * time.Millisecond)
+			write("127.0.0.1:8002")
+			expectPeers(t, next(t, ch), "127.0.0.1:8002")
+
+			peers, err := d.List(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			expectPeers(t, peers, "127.0.0.1:8002")
+		})
+	}
+}
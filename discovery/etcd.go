@@ -0,0 +1,131 @@
+package discovery
+
+import (
+	"GeeCache/geecache/logger"
+	"GeeCache/geecache/register_node"
+	"context"
+	"errors"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"strings"
+	"sync"
+)
+
+// Etcd 基于etcd的服务发现 节点以service/addr为key、addr为value注册在租约下
+// 节点宕机后租约过期 key被自动删除
+type Etcd struct {
+	cfg     clientv3.Config
+	service string
+	logger  logger.Logger // 注册过程的日志 nil时使用register_node的默认Logger
+
+	once sync.Once
+	cli  *clientv3.Client
+	err  error
+}
+
+func NewEtcd(cfg clientv3.Config, service string) *Etcd {
+	return &Etcd{cfg: cfg, service: service}
+}
+
+// client 第一次使用时才连接etcd
+func (e *Etcd) client() (*clientv3.Client, error) {
+	e.once.Do(func() {
+		e.cli, e.err = clientv3.New(e.cfg)
+	})
+	return e.cli, e.err
+}
+
+// SetLogger 设置注册过程使用的Logger 需在Register之前调用
+func (e *Etcd) SetLogger(l logger.Logger) {
+	e.logger = l
+}
+
+func (e *Etcd) Register(ctx context.Context, addr string) error {
+	return register_node.RegisterLogger(ctx, e.cfg, e.service, addr, e.logger)
+}
+
+func (e *Etcd) prefix() string {
+	return e.service + "/"
+}
+
+func (e *Etcd) List(ctx context.Context) ([]string, error) {
+	peers, _, err := e.list(ctx)
+	return peers, err
+}
+
+// list 返回节点列表以及读取时的revision 从该revision之后开始watch不会漏掉事件
+func (e *Etcd) list(ctx context.Context) ([]string, int64, error) {
+	cli, err := e.client()
+	if err != nil {
+		return nil, 0, err
+	}
+	resp, err := cli.Get(ctx, e.prefix(), clientv3.WithPrefix())
+	if err != nil {
+		return nil, 0, err
+	}
+	peers := make([]string, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		peers = append(peers, string(kv.Value))
+	}
+	return normalize(peers), resp.Header.Revision, nil
+}
+
+func (e *Etcd) Watch(ctx context.Context) (<-chan []string, error) {
+	peers, rev, err := e.list(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cli, _ := e.client()
+	set := make(map[string]string, len(peers)) // key -> addr
+	for _, addr := range peers {
+		set[e.prefix()+addr] = addr
+	}
+
+	ch := make(chan []string, 1)
+	ch <- peers
+	wch := cli.Watch(ctx, e.prefix(), clientv3.WithPrefix(), clientv3.WithRev(rev+1))
+	go func() {
+		defer close(ch)
+		for resp := range wch {
+			if resp.Err() != nil {
+				return
+			}
+			for _, ev := range resp.Events {
+				key := string(ev.Kv.Key)
+				if ev.Type == clientv3.EventTypeDelete {
+					delete(set, key)
+				} else {
+					set[key] = string(ev.Kv.Value)
+				}
+			}
+			next := make([]string, 0, len(set))
+			for key, addr := range set {
+				if addr == "" {
+					addr = strings.TrimPrefix(key, e.prefix())
+				}
+				next = append(next, addr)
+			}
+			next = normalize(next)
+			if equal(next, peers) {
+				continue
+			}
+			peers = next
+			if !send(ctx, ch, peers) {
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// Close 关闭List/Watch使用的etcd client
+func (e *Etcd) Close() error {
+	e.once.Do(func() {
+		e.err = errors.New("etcd discovery is closed")
+	})
+	if e.cli != nil {
+		return e.cli.Close()
+	}
+	return nil
+}
+
+var _ Discovery = (*Etcd)(nil)
@@ -0,0 +1,107 @@
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// File 从JSON或YAML文件读取节点列表 并定期检查文件是否被修改
+// 文件格式(扩展名为.yaml/.yml时按YAML解析 否则按JSON解析):
+//
+//	{"peers": ["127.0.0.1:8001", "127.0.0.1:8002"]}
+//
+//	peers:
+//	  - 127.0.0.1:8001
+//	  - 127.0.0.1:8002
+type File struct {
+	path     string
+	interval time.Duration
+}
+
+type fileConfig struct {
+	Peers []string `json:"peers" yaml:"peers"`
+}
+
+const defaultFileInterval = time.Second
+
+// NewFile interval为检查文件的周期 <=0时使用1s
+func NewFile(path string, interval time.Duration) *File {
+	if interval <= 0 {
+		interval = defaultFileInterval
+	}
+	return &File{path: path, interval: interval}
+}
+
+// Register 节点列表由文件决定 只阻塞到ctx结束
+func (f *File) Register(ctx context.Context, addr string) error {
+	<-ctx.Done()
+	return nil
+}
+
+func (f *File) List(ctx context.Context) ([]string, error) {
+	peers, _, err := f.read()
+	return peers, err
+}
+
+func (f *File) read() ([]string, []byte, error) {
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var cfg fileConfig
+	switch strings.ToLower(filepath.Ext(f.path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &cfg)
+	default:
+		err = json.Unmarshal(data, &cfg)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse %s failed: %v", f.path, err)
+	}
+	return normalize(cfg.Peers), data, nil
+}
+
+// Watch 文件内容变化且能被正确解析时发送新的节点列表
+// 文件暂时不可读或格式错误时保留上一次的列表
+func (f *File) Watch(ctx context.Context) (<-chan []string, error) {
+	peers, last, err := f.read()
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan []string, 1)
+	ch <- peers
+	go func() {
+		defer close(ch)
+		ticker := time.NewTicker(f.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			next, data, err := f.read()
+			if err != nil || bytes.Equal(data, last) {
+				continue
+			}
+			last = data
+			if equal(next, peers) {
+				continue
+			}
+			peers = next
+			if !send(ctx, ch, peers) {
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+var _ Discovery = (*File)(nil)
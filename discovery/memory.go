@@ -0,0 +1,98 @@
+package discovery
+
+import (
+	"context"
+	"sync"
+)
+
+// Memory 是进程内的注册中心 多个server共享同一个Memory即可互相发现
+type Memory struct {
+	mu       sync.Mutex
+	peers    map[string]int // addr -> 注册次数
+	watchers map[chan []string]struct{}
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		peers:    make(map[string]int),
+		watchers: make(map[chan []string]struct{}),
+	}
+}
+
+func (m *Memory) Register(ctx context.Context, addr string) error {
+	m.Add(addr)
+	<-ctx.Done()
+	m.Remove(addr)
+	return nil
+}
+
+// Add 直接加入一个节点 用于模拟节点上线
+func (m *Memory) Add(addr string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.peers[addr]++
+	if m.peers[addr] == 1 {
+		m.notify()
+	}
+}
+
+// Remove 直接移除一个节点 用于模拟节点下线
+func (m *Memory) Remove(addr string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.peers[addr] == 0 {
+		return
+	}
+	m.peers[addr]--
+	if m.peers[addr] == 0 {
+		delete(m.peers, addr)
+		m.notify()
+	}
+}
+
+func (m *Memory) List(ctx context.Context) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.list(), nil
+}
+
+func (m *Memory) list() []string {
+	peers := make([]string, 0, len(m.peers))
+	for addr := range m.peers {
+		peers = append(peers, addr)
+	}
+	return normalize(peers)
+}
+
+// Watch 每个watcher的channel只保留最新的节点列表 慢的watcher不会阻塞注册
+func (m *Memory) Watch(ctx context.Context) (<-chan []string, error) {
+	ch := make(chan []string, 1)
+	m.mu.Lock()
+	ch <- m.list()
+	m.watchers[ch] = struct{}{}
+	m.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		m.mu.Lock()
+		delete(m.watchers, ch)
+		close(ch)
+		m.mu.Unlock()
+	}()
+	return ch, nil
+}
+
+// notify 调用方需持有锁
+func (m *Memory) notify() {
+	peers := m.list()
+	for ch := range m.watchers {
+		// 丢弃还没被读取的旧列表
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- append([]string(nil), peers...)
+	}
+}
+
+var _ Discovery = (*Memory)(nil)
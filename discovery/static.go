@@ -0,0 +1,34 @@
+package discovery
+
+import "context"
+
+// Static 是固定的节点列表 成员关系不会变化
+type Static struct {
+	peers []string
+}
+
+func NewStatic(peers ...string) *Static {
+	return &Static{peers: normalize(peers)}
+}
+
+// Register 节点列表由配置决定 只阻塞到ctx结束
+func (s *Static) Register(ctx context.Context, addr string) error {
+	<-ctx.Done()
+	return nil
+}
+
+func (s *Static) List(ctx context.Context) ([]string, error) {
+	return append([]string(nil), s.peers...), nil
+}
+
+func (s *Static) Watch(ctx context.Context) (<-chan []string, error) {
+	ch := make(chan []string, 1)
+	ch <- append([]string(nil), s.peers...)
+	go func() {
+		<-ctx.Done()
+		close(ch)
+	}()
+	return ch, nil
+}
+
+var _ Discovery = (*Static)(nil)
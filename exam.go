@@ -5,7 +5,6 @@ import (
 	"log"
 
 	"sync"
-	"time"
 )
 
 func main() {
@@ -20,7 +19,7 @@ func main() {
 		func(key string) (ByteView, error) {
 			log.Println("[Mysql] search key", key)
 			if v, ok := mysql[key]; ok {
-				return ByteView{[]byte(v), time.Time{}}, nil
+				return NewByteView([]byte(v)), nil
 			}
 			return ByteView{}, fmt.Errorf("%s not exist", key)
 		}))
@@ -33,7 +32,7 @@ func main() {
 	}
 
 	// 设置同伴节点IP(包括自己)
-	// todo: 这里的peer地址从etcd获取(服务发现)
+	// Start之后节点地址会通过服务发现(默认为etcd)实时更新
 
 	svr.SetPeers(addr)
 
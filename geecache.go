@@ -1,10 +1,18 @@
 package geecache
 
 import (
+	"GeeCache/geecache/hotkey"
+	"GeeCache/geecache/logger"
+	"GeeCache/geecache/policy"
 	"GeeCache/geecache/singleflight"
+	"GeeCache/geecache/tinylfu"
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"math"
+	"math/rand"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -21,16 +29,136 @@ func (f GetterFunc) Get(key string) (ByteView, error) {
 	return f(key)
 }
 
+// ContextGetter 是支持context的Getter
+// 若传给NewGroup的Getter同时实现了该接口 Group会调用GetContext
+// 这样调用方的deadline和取消信号可以传递到数据源
+type ContextGetter interface {
+	GetContext(ctx context.Context, key string) (ByteView, error)
+}
+
+// ContextGetterFunc 函数类型同时实现Getter和ContextGetter接口
+type ContextGetterFunc func(ctx context.Context, key string) (ByteView, error)
+
+func (f ContextGetterFunc) Get(key string) (ByteView, error) {
+	return f(context.Background(), key)
+}
+
+func (f ContextGetterFunc) GetContext(ctx context.Context, key string) (ByteView, error) {
+	return f(ctx, key)
+}
+
+// BatchGetter 是可选的批量Getter
+// 若getter实现了该接口 GetMulti中本地未命中的key会通过一次GetMany加载
+// 返回的结果与keys一一对应 error不为nil表示所有key都加载失败
+type BatchGetter interface {
+	GetMany(ctx context.Context, keys []string) ([]Result, error)
+}
+
+// Result 是批量获取中单个key的结果
+type Result struct {
+	Value ByteView
+	Err   error
+}
+
 // Group 提供命名管理缓存/填充缓存的能力
 type Group struct {
 	name      string
 	getter    Getter
 	mainCache *cache
 	hotCache  *cache
+	hotKeys   *hotkey.Detector // 决定远端key是否值得放入hotCache
 	server    PeerPicker
 	//use singleflight
 	loader           *singleflight.Flight
-	emptyKeyDuration time.Duration // getter返回error时对应空值key的过期时间
+	emptyKeyDuration time.Duration  // getter返回error时对应空值key的过期时间
+	newPolicy        policy.Factory // mainCache/hotCache使用的淘汰算法
+	admission        bool           // 是否在淘汰算法前加上W-TinyLFU准入过滤
+	shards           int            // mainCache/hotCache的shard数量
+	janitorInterval  time.Duration  // 后台清理过期键的周期 0表示只惰性删除
+	janitorBudget    int            // 后台清理每批删除的过期键数量
+	staleGrace       time.Duration  // 过期后仍可返回旧值的时长
+	refreshBeta      float64        // XFetch提前刷新的系数 0表示不提前刷新
+	refreshing       sync.Map       // 正在后台刷新的key
+	replication      int            // 每个key的副本数(包括owner) <=1表示不复制
+	acl              ACL            // server开启认证时的访问控制 nil表示不限制
+	metrics          MetricsSink    // 为nil时不上报指标
+	logger           logger.Logger
+	tracer           Tracer // 为nil时不创建span
+
+	loads, loadsDeduped atomic.Int64 // 未命中后的加载次数 以及其中被singleflight合并的次数
+}
+
+// GroupOption 在NewGroup时配置Group
+type GroupOption func(*Group)
+
+// WithPolicy 设置缓存淘汰算法 默认为policy.LRU
+func WithPolicy(newPolicy policy.Factory) GroupOption {
+	return func(g *Group) {
+		g.newPolicy = newPolicy
+	}
+}
+
+// WithShards 将缓存分为n个独立加锁的shard 每个shard平分cacheBytes
+// 高并发时可以减少锁竞争 默认为1
+func WithShards(n int) GroupOption {
+	return func(g *Group) {
+		g.shards = n
+	}
+}
+
+// WithJanitor 启动后台协程 每隔interval主动清理过期键
+// budget为每批删除的数量 <=0时使用默认值 DestroyGroup时协程会被停止
+func WithJanitor(interval time.Duration, budget int) GroupOption {
+	return func(g *Group) {
+		g.janitorInterval = interval
+		g.janitorBudget = budget
+	}
+}
+
+// WithAdmission 在淘汰算法前加上W-TinyLFU准入过滤
+// 只有比即将被淘汰的key更热的新key才会进入缓存 防止批量扫描冲刷热key
+func WithAdmission() GroupOption {
+	return func(g *Group) {
+		g.admission = true
+	}
+}
+
+// WithStaleWhileRevalidate 值过期后的grace时间内仍返回旧值 同时在后台刷新一次
+// 避免热key过期的瞬间所有读请求都等待Getter
+func WithStaleWhileRevalidate(grace time.Duration) GroupOption {
+	return func(g *Group) {
+		g.staleGrace = grace
+	}
+}
+
+// WithRefreshAhead 按XFetch算法在过期前概率性地提前刷新
+// 加载越慢、越接近过期 提前刷新的概率越大 beta>1更倾向于提前 通常取1
+func WithRefreshAhead(beta float64) GroupOption {
+	return func(g *Group) {
+		g.refreshBeta = beta
+	}
+}
+
+// WithReplication 每个key保存在n个节点上 owner之外的n-1个副本由owner加载后写入
+// owner不可用时 读请求依次尝试副本 都失败后才调用本地的Getter
+func WithReplication(n int) GroupOption {
+	return func(g *Group) {
+		g.replication = n
+	}
+}
+
+// WithLogger 设置Group的Logger 默认只输出Info及以上级别的日志
+func WithLogger(l logger.Logger) GroupOption {
+	return func(g *Group) {
+		g.logger = l
+	}
+}
+
+// WithMetrics 将缓存命中、加载、Getter与远端请求的指标上报给sink
+func WithMetrics(sink MetricsSink) GroupOption {
+	return func(g *Group) {
+		g.metrics = sink
+	}
 }
 
 var (
@@ -38,7 +166,7 @@ var (
 	groups = make(map[string]*Group)
 )
 
-func NewGroup(name string, cacheBytes int, getter Getter) *Group {
+func NewGroup(name string, cacheBytes int, getter Getter, opts ...GroupOption) *Group {
 	if getter == nil {
 		panic("nil Getter")
 	}
@@ -46,11 +174,21 @@ func NewGroup(name string, cacheBytes int, getter Getter) *Group {
 	mu.Lock()
 	defer mu.Unlock()
 	g := &Group{
-		name:      name,
-		getter:    getter,
-		mainCache: &cache{cacheBytes: cacheBytes},
-		loader:    &singleflight.Flight{},
+		name:   name,
+		getter: getter,
+		loader: &singleflight.Flight{},
+		logger: logger.Default(),
+	}
+	for _, opt := range opts {
+		opt(g)
 	}
+	if g.admission {
+		g.newPolicy = tinylfu.Wrap(g.newPolicy)
+	}
+	g.mainCache = newCache(cacheBytes, g.newPolicy, g.shards)
+	g.mainCache.grace = g.staleGrace
+	g.mainCache.setMetrics(g.metrics, name, "main")
+	g.mainCache.startJanitor(g.janitorInterval, g.janitorBudget)
 	groups[name] = g
 	return g
 }
@@ -66,27 +204,94 @@ func (g *Group) SetHotCache(cacheBytes int) {
 	if cacheBytes <= 0 {
 		panic("hot cache must be greater than 0")
 	}
-	g.hotCache = &cache{
-		cacheBytes: cacheBytes,
+	if g.hotCache != nil {
+		g.hotCache.Close()
 	}
+	g.hotCache = newCache(cacheBytes, g.newPolicy, g.shards)
+	g.hotCache.grace = g.staleGrace
+	g.hotCache.setMetrics(g.metrics, g.name, "hot")
+	g.hotCache.startJanitor(g.janitorInterval, g.janitorBudget)
+	if g.hotKeys == nil {
+		g.SetHotKeyConfig(hotkey.DefaultConfig)
+	}
+}
+
+// SetHotKeyConfig 设置热点key的晋升/降级阈值
+// 从远端节点获取的key只有在被判定为热点后才会放入hotCache 降级时从hotCache删除
+func (g *Group) SetHotKeyConfig(cfg hotkey.Config) {
+	g.hotKeys = hotkey.New(cfg, g.removeHotLocally)
 }
 
 func (g *Group) Get(key string) (ByteView, error) {
+	return g.GetContext(context.Background(), key)
+}
+
+// GetContext 与Get相同 但ctx会一路传递到singleflight、Getter以及远端节点
+// ctx被取消时调用方立即返回 但正在进行的加载不会因此被其他等待者感知到取消
+func (g *Group) GetContext(ctx context.Context, key string) (value ByteView, err error) {
 	if key == "" {
 		return ByteView{}, fmt.Errorf("key is required")
 	}
+	ctx, span := g.startSpan(ctx, SpanGet, "key", key)
+	defer func() { endSpan(span, err) }()
 
-	if v, ok := g.mainCache.get(key); ok { // 先从主缓存获取
-		log.Println("[GeeCache] hit")
+	if v, ok := g.lookupCache(key); ok {
+		span.SetAttributes("hit", true)
 		return v, nil
 	}
+	return g.load(ctx, key)
+}
+
+// lookupCache 依次查找mainCache与hotCache
+func (g *Group) lookupCache(key string) (ByteView, bool) {
+	if v, ok := g.mainCache.get(key); ok { // 先从主缓存获取
+		if logger.Enabled(g.logger, logger.LevelDebug) {
+			g.logger.Debug("cache hit", "group", g.name, "key", key)
+		}
+		g.revalidate(key, v)
+		return v, true
+	}
 	if g.hotCache != nil {
 		if v, ok := g.hotCache.get(key); ok { // 主缓存没有看热点缓存
-			log.Println("[Cache] hot cache hit")
-			return v, nil
+			if logger.Enabled(g.logger, logger.LevelDebug) {
+				g.logger.Debug("hot cache hit", "group", g.name, "key", key)
+			}
+			g.hotKeys.Record(key) // 继续计数 否则窗口结束时会被降级
+			g.revalidate(key, v)
+			return v, true
+		}
+	}
+	return ByteView{}, false
+}
+
+// revalidate 值已过期(处于grace窗口内)或XFetch判定需要提前刷新时 在后台刷新一次
+// 同一个key同时只有一个后台刷新 刷新失败时旧值保留到grace结束
+func (g *Group) revalidate(key string, v ByteView) {
+	if v.expire.IsZero() {
+		return
+	}
+	now := time.Now()
+	if now.Before(v.expire) && !g.refreshEarly(v, now) {
+		return
+	}
+	if _, loading := g.refreshing.LoadOrStore(key, struct{}{}); loading {
+		return
+	}
+	go func() {
+		defer g.refreshing.Delete(key)
+		if _, err := g.load(context.Background(), key); err != nil {
+			g.logger.Warn("fail to refresh", "group", g.name, "key", key, "err", err)
 		}
+	}()
+}
+
+// refreshEarly XFetch: now - delta*beta*ln(rand) >= expire 时提前刷新
+func (g *Group) refreshEarly(v ByteView, now time.Time) bool {
+	if g.refreshBeta <= 0 || v.delta <= 0 {
+		return false
 	}
-	return g.load(key)
+	gap := float64(v.delta) * g.refreshBeta * -math.Log(1-rand.Float64())
+	return float64(v.expire.Sub(now)) <= gap
 }
 
 func (g *Group) Registerserver(server PeerPicker) {
@@ -96,18 +301,30 @@ func (g *Group) Registerserver(server PeerPicker) {
 	g.server = server
 }
 
-func (g *Group) load(key string) (value ByteView, err error) {
-	view, err := g.loader.Fly(key, func() (interface{}, error) {
+func (g *Group) load(ctx context.Context, key string) (value ByteView, err error) {
+	g.loads.Add(1)
+	g.count(MetricLoads)
+	ctx, span := g.startSpan(ctx, SpanLoad, "key", key)
+	// fn在单独的协程中执行 没有执行fn的调用方复用了其他请求的加载结果
+	var leader atomic.Bool
+	defer func() {
+		if !leader.Load() {
+			g.loadsDeduped.Add(1)
+			g.count(MetricLoadsDeduped)
+			span.SetAttributes("shared", true)
+		}
+		endSpan(span, err)
+	}()
+	view, err := g.loader.FlyContext(ctx, key, func(ctx context.Context) (interface{}, error) {
+		leader.Store(true)
 		if g.server != nil {
 			if peer, ok := g.server.PickPeer(key); ok {
-				value, err := peer.Fetch(g.name, key)
-				if err == nil {
+				if value, ok := g.fetchFromOwner(ctx, peer, key); ok {
 					return value, nil
 				}
-				log.Printf("fail to get *%s* from peer, %s.\n", key, err.Error())
 			}
 		}
-		return g.getLocally(key)
+		return g.getLocally(ctx, key)
 	})
 	if err == nil {
 		return view.(ByteView), nil
@@ -115,25 +332,78 @@ func (g *Group) load(key string) (value ByteView, err error) {
 	return
 }
 
+// fetchFromOwner 从owner获取key 失败时依次尝试副本节点 都失败时由调用方回退到本地加载
+func (g *Group) fetchFromOwner(ctx context.Context, peer Fetcher, key string) (ByteView, bool) {
+	start := time.Now()
+	value, hedged, err := g.fetchHedged(ctx, peer, key)
+	if err == nil {
+		return g.fromPeer(key, value, start), true
+	}
+	g.logger.Warn("fail to get from peer", "group", g.name, "key", key, "err", err)
+	return g.fetchFromReplicas(ctx, key, hedged)
+}
+
+// fetchFromPeer 若peer支持context则使用FetchContext
+func (g *Group) fetchFromPeer(ctx context.Context, peer Fetcher, key string) (value ByteView, err error) {
+	ctx, span := g.startSpan(ctx, SpanFetch, "key", key, "peer", peerName(peer))
+	defer func() { endSpan(span, err) }()
+	start := time.Now()
+	if cf, ok := peer.(ContextFetcher); ok {
+		value, err = cf.FetchContext(ctx, g.name, key)
+	} else {
+		value, err = peer.Fetch(g.name, key)
+	}
+	g.observePeer(peer, start, err)
+	return value, err
+}
+
+// fromPeer 记录从远端获取的值 热点key会被放入hotCache
+func (g *Group) fromPeer(key string, value ByteView, start time.Time) ByteView {
+	value.delta = time.Since(start)
+	// 并发请求被singleflight合并 只计数一次
+	if g.hotCache != nil && g.hotKeys.Record(key) {
+		g.populateCache(key, value, g.hotCache)
+	}
+	return value
+}
+
 // 从本地获取
-func (g *Group) getLocally(key string) (ByteView, error) {
+func (g *Group) getLocally(ctx context.Context, key string) (ByteView, error) {
 	//1.调用回调函数
-	value, err := g.getter.Get(key)
+	var value ByteView
+	var err error
+	getterCtx, span := g.startSpan(ctx, SpanGetLocally, "key", key)
+	start := time.Now()
+	if cg, ok := g.getter.(ContextGetter); ok {
+		value, err = cg.GetContext(getterCtx, key)
+	} else {
+		value, err = g.getter.Get(key)
+	}
+	endSpan(span, err)
+	g.observeGetter(start, err)
+	return g.fillLocally(ctx, key, value, err, start)
+}
+
+// fillLocally 将Getter的结果添加到mainCache 并写入副本节点
+func (g *Group) fillLocally(ctx context.Context, key string, value ByteView, err error, start time.Time) (ByteView, error) {
 	if err != nil {
-		if g.emptyKeyDuration == 0 {
+		// 因取消/超时导致的失败不应被当成空值缓存
+		if g.emptyKeyDuration == 0 || ctx.Err() != nil {
 			return ByteView{}, err
 		}
 		value = ByteView{
 			expire: time.Now().Add(g.emptyKeyDuration),
 		}
 	}
+	value.delta = time.Since(start)
 	//2.将源数据添加到缓存mainCache中
 	g.populateCache(key, value, g.mainCache)
+	g.replicate(key, value)
 	return value, nil
 }
 
 func (g *Group) populateCache(key string, value ByteView, cache *cache) {
-	if cache != nil {
+	if cache == nil {
 		return
 	}
 	cache.add(key, value)
@@ -142,11 +412,143 @@ func (g *Group) populateCache(key string, value ByteView, cache *cache) {
 // 从本地节点删除缓存
 func (g *Group) removeLocally(key string) {
 	g.mainCache.remove(key)
+	g.removeHotLocally(key)
+}
+
+// 从本地节点的hotCache删除远端key的副本
+func (g *Group) removeHotLocally(key string) {
 	if g.hotCache != nil {
 		g.hotCache.remove(key)
 	}
 }
 
+// 写入本地节点 本地即owner 因此hotCache中不应再有副本
+func (g *Group) setLocally(key string, value ByteView) {
+	g.populateCache(key, value, g.mainCache)
+	g.removeHotLocally(key)
+}
+
+// Set 写入key ttl<=0表示永不过期
+func (g *Group) Set(key string, value []byte, ttl time.Duration) error {
+	return g.SetContext(context.Background(), key, value, ttl)
+}
+
+// SetContext 将key写入owner节点的mainCache 并清理其他节点hotCache中的旧副本
+func (g *Group) SetContext(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	view := ByteView{b: cloneBytes(value)}
+	if ttl > 0 {
+		view.expire = time.Now().Add(ttl)
+	}
+
+	owner, err := g.pickWriter(key)
+	if err != nil {
+		return err
+	}
+	if owner == nil {
+		g.setLocally(key, view)
+	} else {
+		if err := owner.Set(ctx, g.name, key, view); err != nil {
+			return err
+		}
+		// 本地不是owner 丢弃可能残留的旧值
+		g.removeLocally(key)
+	}
+	err = g.writeReplicas(key, func(w PeerWriter) error {
+		return w.Set(ctx, g.name, key, view)
+	})
+	return errors.Join(err, g.broadcastDelete(ctx, key, true, owner))
+}
+
+// Remove 删除key
+func (g *Group) Remove(key string) error {
+	return g.RemoveContext(context.Background(), key)
+}
+
+// RemoveContext 从owner节点删除key 并清理其他节点hotCache中的副本
+func (g *Group) RemoveContext(ctx context.Context, key string) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	owner, err := g.pickWriter(key)
+	if err != nil {
+		return err
+	}
+	if owner != nil {
+		if err := owner.Delete(ctx, g.name, key, false); err != nil {
+			return err
+		}
+	}
+	g.removeLocally(key)
+	err = g.writeReplicas(key, func(w PeerWriter) error {
+		return w.Delete(ctx, g.name, key, false)
+	})
+	return errors.Join(err, g.broadcastDelete(ctx, key, true, owner))
+}
+
+// Invalidate 使key在所有节点上失效
+func (g *Group) Invalidate(key string) error {
+	return g.InvalidateContext(context.Background(), key)
+}
+
+// InvalidateContext 与Remove不同 它不经过owner路由 而是让每个节点都丢弃key的
+// mainCache/hotCache副本 可以清理掉哈希环变化后残留在旧owner上的数据
+func (g *Group) InvalidateContext(ctx context.Context, key string) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	g.removeLocally(key)
+	return g.broadcastDelete(ctx, key, false, nil)
+}
+
+// pickWriter 选出key的owner 返回nil表示owner是本地节点
+func (g *Group) pickWriter(key string) (PeerWriter, error) {
+	if g.server == nil {
+		return nil, nil
+	}
+	peer, ok := g.server.PickPeer(key)
+	if !ok {
+		return nil, nil
+	}
+	w, ok := peer.(PeerWriter)
+	if !ok {
+		return nil, fmt.Errorf("peer of %s does not support write", key)
+	}
+	return w, nil
+}
+
+// broadcastDelete 通知除skip以外的所有远端节点删除key
+func (g *Group) broadcastDelete(ctx context.Context, key string, hotOnly bool, skip PeerWriter) error {
+	lister, ok := g.server.(PeerLister)
+	if !ok {
+		return nil
+	}
+	var (
+		wg    sync.WaitGroup
+		errMu sync.Mutex
+		errs  []error
+	)
+	for _, peer := range lister.ListPeers() {
+		w, ok := peer.(PeerWriter)
+		if !ok || (skip != nil && w == skip) {
+			continue
+		}
+		wg.Add(1)
+		go func(w PeerWriter) {
+			defer wg.Done()
+			if err := w.Delete(ctx, g.name, key, hotOnly); err != nil {
+				errMu.Lock()
+				errs = append(errs, err)
+				errMu.Unlock()
+			}
+		}(w)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
 /*func (g *Group) getFromPeer(peer PeerGetter, key string) (ByteView, error) {
 	req := &pb.Request{
 		Group: g.name,
@@ -174,12 +576,22 @@ func GetGroup(name string) *Group {
 	return g
 }
 
+// DestroyGroup 关闭Group的后台协程并从全局注册表中移除
+// 若Group注册的节点选择器可以Stop(如server) 也一并停止
 func DestroyGroup(name string) {
-	g := GetGroup(name)
-	if g != nil {
-		svr := g.server.(*server)
-		svr.Stop()
-		delete(groups, name)
-		log.Printf("Destory cache [%s %s]", name, svr.addr)
+	mu.Lock()
+	g := groups[name]
+	delete(groups, name)
+	mu.Unlock()
+	if g == nil {
+		return
+	}
+	g.mainCache.Close()
+	if g.hotCache != nil {
+		g.hotCache.Close()
+	}
+	if s, ok := g.server.(interface{ Stop() }); ok {
+		s.Stop()
 	}
+	g.logger.Info("destroy cache", "group", name)
 }
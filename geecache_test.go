@@ -1,21 +1,273 @@
 package geecache
 
 import (
+	"GeeCache/geecache/hotkey"
+	"context"
+	"errors"
+	"fmt"
 	"reflect"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
-var _ Getter = GetterFunc(func(key string) ([]byte, error) {
-	return []byte(key), nil
+var _ Getter = GetterFunc(func(key string) (ByteView, error) {
+	return ByteView{b: []byte(key)}, nil
 })
 
+var _ ContextGetter = ContextGetterFunc(nil)
+
 func TestGetter(t *testing.T) {
 
-	var f Getter = GetterFunc(func(key string) ([]byte, error) {
-		return []byte(key), nil
+	var f Getter = GetterFunc(func(key string) (ByteView, error) {
+		return ByteView{b: []byte(key)}, nil
 	})
 	expect := []byte("key")
-	if v, _ := f.Get("key"); !reflect.DeepEqual(v, expect) {
+	if v, _ := f.Get("key"); !reflect.DeepEqual(v.ByteSlice(), expect) {
 		t.Errorf("callback failed")
 	}
 }
+
+func TestGetContext(t *testing.T) {
+	var loads int32
+	release := make(chan struct{})
+	g := NewGroup("ctx", 2<<10, ContextGetterFunc(
+		func(ctx context.Context, key string) (ByteView, error) {
+			atomic.AddInt32(&loads, 1)
+			select {
+			case <-release:
+				return ByteView{b: []byte(key)}, nil
+			case <-ctx.Done():
+				return ByteView{}, ctx.Err()
+			}
+		}))
+
+	// 等待者超时放弃 不应取消正在进行的加载
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := g.GetContext(context.Background(), "Tom")
+		done <- err
+	}()
+	time.Sleep(5 * time.Millisecond)
+	if _, err := g.GetContext(ctx, "Tom"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect deadline exceeded, got %v", err)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("in-flight load was cancelled: %v", err)
+	}
+	if v, err := g.Get("Tom"); err != nil || v.String() != "Tom" || atomic.LoadInt32(&loads) != 1 {
+		t.Fatalf("expect cached Tom with 1 load, got %q %v (loads=%d)", v.String(), err, loads)
+	}
+}
+
+func TestGetContextAllWaitersGone(t *testing.T) {
+	cancelled := make(chan struct{})
+	g := NewGroup("ctx-cancel", 2<<10, ContextGetterFunc(
+		func(ctx context.Context, key string) (ByteView, error) {
+			<-ctx.Done()
+			close(cancelled)
+			return ByteView{}, ctx.Err()
+		}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		cancel()
+	}()
+	if _, err := g.GetContext(ctx, "Tom"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expect canceled, got %v", err)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("getter should observe cancellation once all waiters are gone")
+	}
+}
+
+// fakePeer 直接操作另一个Group的本地缓存 模拟远端节点
+type fakePeer struct {
+	g       *Group
+	batches int32 // FetchMany被调用的次数
+}
+
+func (p *fakePeer) FetchMany(ctx context.Context, group string, keys []string) ([]Result, error) {
+	atomic.AddInt32(&p.batches, 1)
+	results := p.g.GetMulti(ctx, keys)
+	out := make([]Result, len(keys))
+	for i, key := range keys {
+		out[i] = results[key]
+	}
+	return out, nil
+}
+
+func (p *fakePeer) Fetch(group string, key string) (ByteView, error) {
+	return p.g.GetContext(context.Background(), key)
+}
+
+func (p *fakePeer) Set(ctx context.Context, group string, key string, value ByteView) error {
+	p.g.setLocally(key, value)
+	return nil
+}
+
+func (p *fakePeer) Delete(ctx context.Context, group string, key string, hotOnly bool) error {
+	if hotOnly {
+		p.g.removeHotLocally(key)
+	} else {
+		p.g.removeLocally(key)
+	}
+	return nil
+}
+
+// fakePicker 将owners中的key路由到对应peer 其余key由本地负责
+type fakePicker struct {
+	owners map[string]*fakePeer
+	peers  []*fakePeer
+}
+
+func (p *fakePicker) PickPeer(key string) (Fetcher, bool) {
+	peer, ok := p.owners[key]
+	return peer, ok
+}
+
+func (p *fakePicker) ListPeers() []Fetcher {
+	peers := make([]Fetcher, 0, len(p.peers))
+	for _, peer := range p.peers {
+		peers = append(peers, peer)
+	}
+	return peers
+}
+
+func TestSetRemoveInvalidate(t *testing.T) {
+	noop := GetterFunc(func(key string) (ByteView, error) {
+		return ByteView{}, fmt.Errorf("%s not exist", key)
+	})
+	local := NewGroup("write-local", 2<<10, noop)
+	remote := NewGroup("write-remote", 2<<10, noop)
+	local.SetHotCache(2 << 10)
+	remote.SetHotCache(2 << 10)
+	peer := &fakePeer{g: remote}
+	local.RegisterSvr(&fakePicker{
+		owners: map[string]*fakePeer{"Jack": peer},
+		peers:  []*fakePeer{peer},
+	})
+
+	// owner为本地
+	if err := local.Set("Tom", []byte("630"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := local.mainCache.peek("Tom"); !ok || v.String() != "630" {
+		t.Fatalf("Tom should be set locally")
+	}
+
+	// owner为远端 同时清理本地与远端的hotCache副本
+	local.hotCache.add("Jack", ByteView{b: []byte("old")})
+	remote.hotCache.add("Tom", ByteView{b: []byte("old")})
+	if err := local.Set("Jack", []byte("589"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := remote.mainCache.peek("Jack"); !ok || v.String() != "589" || v.Expire().IsZero() {
+		t.Fatalf("Jack should be set on owner with ttl")
+	}
+	if _, ok := local.hotCache.peek("Jack"); ok {
+		t.Fatalf("stale hot copy of Jack should be dropped")
+	}
+	if err := local.Set("Tom", []byte("631"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := remote.hotCache.peek("Tom"); ok {
+		t.Fatalf("hot copy of Tom on peer should be dropped")
+	}
+
+	if err := local.Remove("Jack"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := remote.mainCache.peek("Jack"); ok {
+		t.Fatalf("Jack should be removed from owner")
+	}
+
+	// Invalidate清理所有节点上的所有副本
+	remote.mainCache.add("Tom", ByteView{b: []byte("stale")})
+	if err := local.Invalidate("Tom"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := local.mainCache.peek("Tom"); ok {
+		t.Fatalf("Tom should be invalidated locally")
+	}
+	if _, ok := remote.mainCache.peek("Tom"); ok {
+		t.Fatalf("Tom should be invalidated on peer")
+	}
+}
+
+func TestHotCachePromotion(t *testing.T) {
+	remote := NewGroup("hot-remote", 2<<10, GetterFunc(func(key string) (ByteView, error) {
+		return NewByteView([]byte("630")), nil
+	}))
+	local := NewGroup("hot-local", 2<<10, GetterFunc(func(key string) (ByteView, error) {
+		return ByteView{}, fmt.Errorf("%s not exist", key)
+	}))
+	local.SetHotCache(2 << 10)
+	local.SetHotKeyConfig(hotkey.Config{Window: 50 * time.Millisecond, Promote: 3, Demote: 1})
+	peer := &fakePeer{g: remote}
+	local.RegisterSvr(&fakePicker{owners: map[string]*fakePeer{"Tom": peer, "Jack": peer}})
+
+	for i := 0; i < 2; i++ {
+		if _, err := local.Get("Tom"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	local.Get("Jack")
+	if _, ok := local.hotCache.peek("Tom"); ok {
+		t.Fatal("Tom is not hot yet")
+	}
+	local.Get("Tom")
+	if _, ok := local.hotCache.peek("Tom"); !ok {
+		t.Fatal("Tom should be promoted to hot cache")
+	}
+	if _, ok := local.hotCache.peek("Jack"); ok {
+		t.Fatal("Jack should not be in hot cache")
+	}
+	if v, err := local.Get("Tom"); err != nil || v.String() != "630" {
+		t.Fatalf("expect 630 from hot cache, got %q %v", v.String(), err)
+	}
+
+	// 整个窗口都没有访问 降级并从hotCache删除
+	time.Sleep(120 * time.Millisecond)
+	local.Get("Jack")
+	if _, ok := local.hotCache.peek("Tom"); ok {
+		t.Fatal("Tom should be demoted from hot cache")
+	}
+}
+
+// recordLogger 记录每条日志的级别与内容
+type recordLogger struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (l *recordLogger) record(level, msg string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.msgs = append(l.msgs, level+" "+msg)
+}
+
+func (l *recordLogger) Debug(msg string, args ...interface{}) { l.record("DEBUG", msg) }
+func (l *recordLogger) Info(msg string, args ...interface{})  { l.record("INFO", msg) }
+func (l *recordLogger) Warn(msg string, args ...interface{})  { l.record("WARN", msg) }
+func (l *recordLogger) Error(msg string, args ...interface{}) { l.record("ERROR", msg) }
+
+func TestWithLogger(t *testing.T) {
+	l := &recordLogger{}
+	g := NewGroup("logger", 2<<10, GetterFunc(func(key string) (ByteView, error) {
+		return NewByteView([]byte(key)), nil
+	}), WithLogger(l))
+	g.Get("Tom")
+	g.Get("Tom")
+	if !reflect.DeepEqual(l.msgs, []string{"DEBUG cache hit"}) {
+		t.Fatalf("unexpected logs %v", l.msgs)
+	}
+}
@@ -0,0 +1,223 @@
+package geecache
+
+import (
+	pb "GeeCache/geecache/geecachepb"
+	"GeeCache/geecache/placement"
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// handoff 哈希环变化时迁移key
+// 新节点加入后 它负责的key范围一开始是冷的 所有未命中都会打到数据源
+// 开启迁移后 旧owner会把不再属于自己的条目(连同过期时间)通过Handoff流式rpc发给新owner
+// 新owner只接收本地还没有的key 迁移成功的条目从旧owner删除 旧owner仍是副本节点时保留
+// 迁移按handoffRate限速 避免占满网络与新节点的cpu 与其他rpc一样遵循PeerPolicy的重试与熔断
+
+// HandoffStats 迁移的统计信息
+type HandoffStats struct {
+	Sent     int64 // 成功发送给新owner的条目数
+	Received int64 // 从旧owner接收并写入缓存的条目数
+	Skipped  int64 // 接收时因已存在或已过期而丢弃的条目数
+	Failed   int64 // 发送失败的条目数
+}
+
+type handoffCounters struct {
+	sent, received, skipped, failed atomic.Int64
+}
+
+// SetHandoff 开启哈希环变化时的key迁移 rate为每秒最多迁移的条目数 <=0表示关闭
+func (s *server) SetHandoff(rate int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handoffRate = rate
+}
+
+func (s *server) HandoffStats() HandoffStats {
+	return HandoffStats{
+		Sent:     s.handoffStats.sent.Load(),
+		Received: s.handoffStats.received.Load(),
+		Skipped:  s.handoffStats.skipped.Load(),
+		Failed:   s.handoffStats.failed.Load(),
+	}
+}
+
+type handoffEntry struct {
+	group string
+	key   string
+	value ByteView
+}
+
+// handoff 将属于新加入节点的条目迁移过去
+// 只处理diff.Added 离开的节点上的数据已经无法取得
+func (s *server) handoff(diff RingDiff) {
+	s.handoffMu.Lock()
+	defer s.handoffMu.Unlock()
+
+	s.mu.Lock()
+	rate := s.handoffRate
+	s.mu.Unlock()
+
+	byOwner := make(map[string][]handoffEntry)
+	now := time.Now()
+	for _, g := range s.groupList() {
+		g.mainCache.rangeEntries(func(key string, value ByteView) bool {
+			if !value.expire.IsZero() && !now.Before(value.expire) {
+				return true
+			}
+			if owner := s.owner(key); owner != s.addr && slices.Contains(diff.Added, owner) {
+				byOwner[owner] = append(byOwner[owner], handoffEntry{g.name, key, value})
+			}
+			return true
+		})
+	}
+
+	limiter := newRateLimiter(rate)
+	for owner, entries := range byOwner {
+		sent, err := s.sendHandoff(owner, entries, limiter)
+		s.handoffStats.sent.Add(int64(len(sent)))
+		s.handoffStats.failed.Add(int64(len(entries) - len(sent)))
+		if err != nil {
+			s.log().Warn("handoff failed", "addr", s.addr, "owner", owner, "sent", len(sent), "entries", len(entries), "err", err)
+		} else {
+			s.log().Info("handoff done", "addr", s.addr, "owner", owner, "entries", len(sent))
+		}
+		for _, e := range sent {
+			if g := s.group(e.group); g != nil && !s.isReplica(e.key, g.replication) {
+				g.mainCache.remove(e.key)
+			}
+		}
+	}
+}
+
+// isReplica 返回本节点是否是key的n个副本节点(包括owner)之一
+func (s *server) isReplica(key string, n int) bool {
+	if n <= 1 {
+		return s.owner(key) == s.addr
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rp, ok := s.placer.(placement.ReplicaPlacer)
+	if !ok {
+		return false
+	}
+	return slices.Contains(rp.GetN(key, n), s.addr)
+}
+
+// owner 返回key在当前哈希环上的owner
+func (s *server) owner(key string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.placer == nil {
+		return s.addr
+	}
+	return s.placer.Get(key)
+}
+
+// sendHandoff 通过一个流发送entries 返回新owner确认收到的条目
+// 流失败后按PeerPolicy重试整个流 新owner会跳过已经收到的key
+func (s *server) sendHandoff(owner string, entries []handoffEntry, limiter *rateLimiter) ([]handoffEntry, error) {
+	s.mu.Lock()
+	client, ok := s.clients[owner]
+	s.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("peer %s left the ring", owner)
+	}
+
+	// 限速时发送所有条目需要的时间不计入超时
+	ctx, cancel := context.WithTimeout(context.Background(), defaultFetchTimeout+limiter.interval*time.Duration(len(entries)))
+	defer cancel()
+	err := client.call(ctx, func(ctx context.Context, grpcClient pb.GroupCacheClient) error {
+		stream, err := grpcClient.Handoff(ctx)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if err := limiter.wait(ctx); err != nil {
+				return err
+			}
+			if err := stream.Send(setRequest(e.group, e.key, e.value)); err != nil {
+				// 服务端出错时错误由CloseAndRecv返回
+				if err == io.EOF {
+					break
+				}
+				return err
+			}
+		}
+		_, err = stream.CloseAndRecv()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Handoff 接收旧owner迁移来的条目 已存在的key保留本地的值
+func (s *server) Handoff(stream pb.GroupCache_HandoffServer) error {
+	var received int64
+	for {
+		in, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&pb.HandoffResponse{Received: received})
+		}
+		if err != nil {
+			return err
+		}
+		g := s.group(in.GetGroup())
+		if g == nil || in.GetKey() == "" || !g.handoffLocally(in.GetKey(), viewFromSetRequest(in)) {
+			s.handoffStats.skipped.Add(1)
+			continue
+		}
+		s.handoffStats.received.Add(1)
+		received++
+	}
+}
+
+// handoffLocally 只写入本地还没有、且未过期的key
+func (g *Group) handoffLocally(key string, value ByteView) bool {
+	if !value.expire.IsZero() && !time.Now().Before(value.expire) {
+		return false
+	}
+	if _, ok := g.mainCache.peek(key); ok {
+		return false
+	}
+	g.populateCache(key, value, g.mainCache)
+	return true
+}
+
+// rateLimiter 将事件均匀地限制在每秒rate个 rate<=0时不限速
+type rateLimiter struct {
+	interval time.Duration
+	next     time.Time
+}
+
+func newRateLimiter(rate int) *rateLimiter {
+	l := &rateLimiter{}
+	if rate > 0 {
+		l.interval = time.Second / time.Duration(rate)
+	}
+	return l
+}
+
+func (l *rateLimiter) wait(ctx context.Context) error {
+	if l.interval == 0 {
+		return ctx.Err()
+	}
+	now := time.Now()
+	if l.next.After(now) {
+		timer := time.NewTimer(l.next.Sub(now))
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		now = l.next
+	}
+	l.next = now.Add(l.interval)
+	return nil
+}
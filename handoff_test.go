@@ -0,0 +1,271 @@
+package geecache
+
+import (
+	pb "GeeCache/geecache/geecachepb"
+	"context"
+	"fmt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// bufNet 在一个进程内模拟多个节点 节点之间通过内存连接通信
+type bufNet struct {
+	mu      sync.Mutex
+	lis     map[string]*bufconn.Listener
+	servers map[string]*grpc.Server
+}
+
+func newBufNet() *bufNet {
+	return &bufNet{
+		lis:     make(map[string]*bufconn.Listener),
+		servers: make(map[string]*grpc.Server),
+	}
+}
+
+// node 创建addr上的server 它只能看到groups中的Group groups为nil时使用全局的Group
+// setup在rpc服务创建之前调用 可以设置需在Start之前完成的配置
+func (n *bufNet) node(t *testing.T, addr string, groups map[string]*Group, setup ...func(*server)) *server {
+	svr, err := NewServer(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svr.pool.Close()
+	svr.pool = newConnPool(n.dial, 0)
+	if groups != nil {
+		svr.SetGroups(GroupMap(groups))
+	}
+	t.Cleanup(svr.pool.Close)
+	for _, fn := range setup {
+		fn(svr)
+	}
+	n.serve(t, addr, svr, svr.serverOptions()...)
+	return svr
+}
+
+// serve 在addr上启动处理rpc的srv
+func (n *bufNet) serve(t *testing.T, addr string, srv pb.GroupCacheServer, opts ...grpc.ServerOption) {
+	lis := bufconn.Listen(1 << 20)
+	grpcServer := grpc.NewServer(opts...)
+	pb.RegisterGroupCacheServer(grpcServer, srv)
+	go grpcServer.Serve(lis)
+	t.Cleanup(grpcServer.Stop)
+
+	n.mu.Lock()
+	n.lis[addr] = lis
+	n.servers[addr] = grpcServer
+	n.mu.Unlock()
+}
+
+// client 返回连接addr的Client
+func (n *bufNet) client(t *testing.T, addr string) *Client {
+	pool := newConnPool(n.dial, 0)
+	t.Cleanup(pool.Close)
+	return &Client{name: addr, pool: pool}
+}
+
+// down 模拟节点宕机 已有的连接被断开 之后也无法再连接
+func (n *bufNet) down(addr string) {
+	n.mu.Lock()
+	grpcServer := n.servers[addr]
+	delete(n.lis, addr)
+	delete(n.servers, addr)
+	n.mu.Unlock()
+	if grpcServer != nil {
+		grpcServer.Stop()
+	}
+}
+
+func (n *bufNet) dial(ctx context.Context, target string) (*grpc.ClientConn, error) {
+	n.mu.Lock()
+	lis, ok := n.lis[target]
+	n.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown peer %s", target)
+	}
+	return grpc.DialContext(ctx, "passthrough:///"+target,
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithBlock(),
+	)
+}
+
+// countingGetter 模拟数据源 记录被访问的次数
+func countingGetter(loads *int32) Getter {
+	return GetterFunc(func(key string) (ByteView, error) {
+		atomic.AddInt32(loads, 1)
+		return NewByteViewWithTTL([]byte("value-"+key), time.Hour), nil
+	})
+}
+
+func TestHandoffOnJoin(t *testing.T) {
+	const (
+		addrA = "127.0.0.1:9101"
+		addrB = "127.0.0.1:9102"
+		keys  = 200
+	)
+	var originA, originB int32
+	// 两个节点上的Group同名 各节点只能看到自己的Group
+	gA := NewGroup("handoff", 1<<20, countingGetter(&originA))
+	gB := NewGroup("handoff", 1<<20, countingGetter(&originB))
+
+	cluster := newBufNet()
+	a := cluster.node(t, addrA, map[string]*Group{"handoff": gA})
+	b := cluster.node(t, addrB, map[string]*Group{"handoff": gB})
+	a.SetHandoff(100000)
+	a.SetPeers(addrA)
+	gA.RegisterSvr(a)
+	gB.RegisterSvr(b)
+
+	for i := 0; i < keys; i++ {
+		if _, err := gA.Get(fmt.Sprintf("key%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// B加入
+	b.SetPeers(addrA, addrB)
+	a.SetPeers(addrA, addrB)
+	moved := 0
+	for i := 0; i < keys; i++ {
+		if b.owner(fmt.Sprintf("key%d", i)) == addrB {
+			moved++
+		}
+	}
+	if moved == 0 {
+		t.Fatal("B should own some keys")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for a.HandoffStats().Sent+a.HandoffStats().Failed < int64(moved) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if stats := a.HandoffStats(); stats.Sent != int64(moved) || stats.Failed != 0 {
+		t.Fatalf("expect %d entries sent, got %+v", moved, stats)
+	}
+	if stats := b.HandoffStats(); stats.Received != int64(moved) {
+		t.Fatalf("expect %d entries received, got %+v", moved, stats)
+	}
+
+	// 加入后从B读取所有key 数据源不会被再次访问
+	for i := 0; i < keys; i++ {
+		key := fmt.Sprintf("key%d", i)
+		if v, err := gB.Get(key); err != nil || v.String() != "value-"+key {
+			t.Fatalf("get %s from B: %s %v", key, v, err)
+		}
+	}
+	if n := atomic.LoadInt32(&originB); n != 0 {
+		t.Fatalf("origin should not be hit after join, got %d loads on B", n)
+	}
+	if n := atomic.LoadInt32(&originA); n != keys {
+		t.Fatalf("expect %d loads on A, got %d", keys, n)
+	}
+	// 迁移成功的条目从旧owner删除 过期时间随之迁移
+	for i := 0; i < keys; i++ {
+		key := fmt.Sprintf("key%d", i)
+		_, onA := gA.mainCache.peek(key)
+		v, onB := gB.mainCache.peek(key)
+		if b.owner(key) == addrB && (onA || !onB || v.Expire().IsZero()) {
+			t.Fatalf("%s should be moved to B with its ttl", key)
+		}
+	}
+}
+
+func TestHandoffKeepsReplicas(t *testing.T) {
+	const (
+		addrA = "127.0.0.1:9111"
+		addrB = "127.0.0.1:9112"
+		keys  = 100
+	)
+	var originA, originB int32
+	// 两个节点 每个key两个副本 A在B加入后仍是所有key的副本
+	gA := NewGroup("handoff-replica", 1<<20, countingGetter(&originA), WithReplication(2))
+	gB := NewGroup("handoff-replica", 1<<20, countingGetter(&originB), WithReplication(2))
+
+	cluster := newBufNet()
+	a := cluster.node(t, addrA, map[string]*Group{"handoff-replica": gA})
+	b := cluster.node(t, addrB, map[string]*Group{"handoff-replica": gB})
+	a.SetHandoff(100000)
+	a.SetPeers(addrA)
+	gA.RegisterSvr(a)
+	gB.RegisterSvr(b)
+	for i := 0; i < keys; i++ {
+		gA.Get(fmt.Sprintf("key%d", i))
+	}
+
+	b.SetPeers(addrA, addrB)
+	a.SetPeers(addrA, addrB)
+	deadline := time.Now().Add(5 * time.Second)
+	for a.HandoffStats().Sent == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if a.HandoffStats().Sent == 0 {
+		t.Fatal("A should hand off keys owned by B")
+	}
+	for i := 0; i < keys; i++ {
+		key := fmt.Sprintf("key%d", i)
+		if _, ok := gA.mainCache.peek(key); !ok {
+			t.Fatalf("%s should be kept on A as a replica", key)
+		}
+	}
+}
+
+func TestHandoffPeerPolicy(t *testing.T) {
+	const (
+		addrA = "127.0.0.1:9121"
+		addrB = "127.0.0.1:9122"
+	)
+	var origin int32
+	g := NewGroup("handoff-policy", 1<<20, countingGetter(&origin))
+	cluster := newBufNet()
+	a := cluster.node(t, addrA, map[string]*Group{"handoff-policy": g}, func(s *server) {
+		s.SetPeerPolicy(PeerPolicy{BreakerThreshold: 1, BreakerCooldown: time.Hour})
+	})
+	a.SetHandoff(100000)
+	a.SetPeers(addrA)
+	g.RegisterSvr(a)
+	for i := 0; i < 50; i++ {
+		g.Get(fmt.Sprintf("key%d", i))
+	}
+
+	// B不可达 迁移失败计入B的熔断器 条目留在A上
+	a.SetPeers(addrA, addrB)
+	deadline := time.Now().Add(5 * time.Second)
+	for a.HandoffStats().Failed == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if stats := a.HandoffStats(); stats.Failed == 0 || stats.Sent != 0 {
+		t.Fatalf("expect handoff to fail, got %+v", stats)
+	}
+	if state := a.clients[addrB].BreakerState(); state != BreakerOpen {
+		t.Fatalf("expect breaker of B to open, got %s", state)
+	}
+	if n := g.Stats().Main.Entries; n != 50 {
+		t.Fatalf("failed entries should stay on A, got %d", n)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	l := newRateLimiter(100)
+	start := time.Now()
+	for i := 0; i < 11; i++ {
+		if err := l.wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Fatalf("11 events at 100/s should take at least 100ms, took %v", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := l.wait(ctx); err == nil {
+		t.Fatal("wait should return when ctx is done")
+	}
+}
@@ -0,0 +1,155 @@
+package hotkey
+
+import (
+	"GeeCache/geecache/zset"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// hotkey 用于识别远端节点上的热点key
+// 只有热点key才值得在本地hotCache中保留副本 其余远端key每次都走rpc即可
+//
+// 按固定时间窗口计数 计数保存在zset中 只保留访问次数最多的Capacity个key(top-K)
+// 当前窗口内访问次数达到Promote时晋升为热点key
+// 窗口结束时 热点key在该窗口内的访问次数低于Demote则降级
+// 可以通过SampleRate只对1/SampleRate的访问计数 计数结果会按比例放大
+
+const countsZSetKey = ""
+
+type Config struct {
+	Window     time.Duration // 计数窗口
+	Promote    int           // 窗口内访问次数>=Promote时晋升
+	Demote     int           // 窗口结束时访问次数<Demote则降级
+	SampleRate int           // 每SampleRate次访问采样一次 <=1表示全部计数
+	Capacity   int           // 每个窗口最多跟踪的key数量
+}
+
+// DefaultConfig 每秒访问10次以上的key视为热点 低于每秒2次降级
+var DefaultConfig = Config{
+	Window:     time.Second,
+	Promote:    10,
+	Demote:     2,
+	SampleRate: 1,
+	Capacity:   1024,
+}
+
+type Detector struct {
+	mu       sync.Mutex
+	cfg      Config
+	counts   *zset.SortedSet // 当前窗口的采样计数
+	hot      map[string]struct{}
+	start    time.Time // 当前窗口的开始时间
+	onDemote func(key string)
+	now      func() time.Time
+}
+
+// New 创建热点key探测器 onDemote在key降级时被调用 可以为nil
+// cfg中未设置(<=0)的字段使用DefaultConfig中的值
+func New(cfg Config, onDemote func(key string)) *Detector {
+	if cfg.Window <= 0 {
+		cfg.Window = DefaultConfig.Window
+	}
+	if cfg.Promote <= 0 {
+		cfg.Promote = DefaultConfig.Promote
+	}
+	if cfg.Demote <= 0 {
+		cfg.Demote = DefaultConfig.Demote
+	}
+	if cfg.SampleRate <= 1 {
+		cfg.SampleRate = 1
+	}
+	if cfg.Capacity <= 0 {
+		cfg.Capacity = DefaultConfig.Capacity
+	}
+	d := &Detector{
+		cfg:      cfg,
+		counts:   zset.New(),
+		hot:      make(map[string]struct{}),
+		onDemote: onDemote,
+		now:      time.Now,
+	}
+	d.start = d.now()
+	return d
+}
+
+// Record 记录一次对key的访问 返回key当前是否为热点key
+func (d *Detector) Record(key string) bool {
+	d.mu.Lock()
+	demoted := d.rotate()
+	_, hot := d.hot[key]
+	if d.cfg.SampleRate <= 1 || rand.Intn(d.cfg.SampleRate) == 0 {
+		if ok, _ := d.counts.ZScore(countsZSetKey, key); !ok && d.counts.ZCard(countsZSetKey) >= d.cfg.Capacity {
+			// 只保留top-K 先淘汰计数最少的key再加入新key
+			if values := d.counts.ZRange(countsZSetKey, 0, 0); len(values) > 0 {
+				d.counts.ZRem(countsZSetKey, values[0].(string))
+			}
+		}
+		count := d.counts.ZIncrBy(countsZSetKey, 1, key)
+		if !hot && int(count)*d.cfg.SampleRate >= d.cfg.Promote {
+			d.hot[key] = struct{}{}
+			hot = true
+		}
+	}
+	d.mu.Unlock()
+
+	d.demote(demoted)
+	return hot
+}
+
+// IsHot 返回key当前是否为热点key 不计数
+func (d *Detector) IsHot(key string) bool {
+	d.mu.Lock()
+	demoted := d.rotate()
+	_, hot := d.hot[key]
+	d.mu.Unlock()
+
+	d.demote(demoted)
+	return hot
+}
+
+// Forget 忘记key的热点状态 例如key被删除时
+func (d *Detector) Forget(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.hot, key)
+	d.counts.ZRem(countsZSetKey, key)
+}
+
+// rotate 窗口结束时开启新窗口 并返回需要降级的key
+// 调用方需持有锁
+func (d *Detector) rotate() []string {
+	now := d.now()
+	if now.Sub(d.start) < d.cfg.Window {
+		return nil
+	}
+	// 中间可能空过了多个窗口 此时所有key的计数都视为0
+	idle := now.Sub(d.start) >= 2*d.cfg.Window
+	var demoted []string
+	for key := range d.hot {
+		_, count := d.counts.ZScore(countsZSetKey, key)
+		if idle || int(count)*d.cfg.SampleRate < d.cfg.Demote {
+			delete(d.hot, key)
+			demoted = append(demoted, key)
+		}
+	}
+	d.counts.ZClear(countsZSetKey)
+	d.start = now
+	return demoted
+}
+
+func (d *Detector) demote(keys []string) {
+	if d.onDemote == nil {
+		return
+	}
+	for _, key := range keys {
+		d.onDemote(key)
+	}
+}
+
+// Len 返回当前热点key的数量
+func (d *Detector) Len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.hot)
+}
@@ -0,0 +1,110 @@
+package hotkey
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// fakeClock 手动推进的时钟
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func newTestDetector(cfg Config) (*Detector, *fakeClock, *[]string) {
+	var demoted []string
+	d := New(cfg, func(key string) {
+		demoted = append(demoted, key)
+	})
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	d.now = clock.now
+	d.start = clock.t
+	return d, clock, &demoted
+}
+
+func TestPromoteDemote(t *testing.T) {
+	d, clock, demoted := newTestDetector(Config{Window: time.Second, Promote: 3, Demote: 2})
+	for i := 1; i <= 3; i++ {
+		if hot := d.Record("Tom"); hot != (i == 3) {
+			t.Fatalf("access %d: expect hot=%v", i, i == 3)
+		}
+	}
+	if d.Record("Jack") || d.IsHot("Jack") {
+		t.Fatal("Jack should not be hot")
+	}
+
+	// 下一个窗口仍有2次访问 保持热点
+	clock.t = clock.t.Add(time.Second)
+	d.Record("Tom")
+	d.Record("Tom")
+	clock.t = clock.t.Add(time.Second)
+	if !d.IsHot("Tom") || len(*demoted) != 0 {
+		t.Fatal("Tom should stay hot")
+	}
+
+	// 访问次数低于Demote 降级
+	d.Record("Tom")
+	clock.t = clock.t.Add(time.Second)
+	if d.IsHot("Tom") {
+		t.Fatal("Tom should be demoted")
+	}
+	if len(*demoted) != 1 || (*demoted)[0] != "Tom" {
+		t.Fatalf("expect Tom demoted, got %v", *demoted)
+	}
+}
+
+func TestIdleDemote(t *testing.T) {
+	d, clock, demoted := newTestDetector(Config{Window: time.Second, Promote: 1, Demote: 1})
+	d.Record("Tom")
+	d.Record("Tom")
+	// 空过多个窗口 上一窗口的计数不再有效
+	clock.t = clock.t.Add(5 * time.Second)
+	if d.IsHot("Tom") || len(*demoted) != 1 {
+		t.Fatal("Tom should be demoted after idle windows")
+	}
+}
+
+func TestCapacity(t *testing.T) {
+	d, _, _ := newTestDetector(Config{Promote: 100, Capacity: 10})
+	for i := 0; i < 5; i++ {
+		d.Record("Tom")
+	}
+	for i := 0; i < 100; i++ {
+		d.Record(fmt.Sprintf("cold%d", i))
+	}
+	if n := d.counts.ZCard(countsZSetKey); n != 10 {
+		t.Fatalf("expect to track exactly 10 keys, got %d", n)
+	}
+	if ok, count := d.counts.ZScore(countsZSetKey, "Tom"); !ok || count != 5 {
+		t.Fatalf("Tom should stay in top-K with count 5, got %v %d", ok, count)
+	}
+}
+
+func TestCapacityNewKeyIsMin(t *testing.T) {
+	d, _, _ := newTestDetector(Config{Promote: 100, Capacity: 2})
+	// 计数相同时新加入的key可能恰好是计数最少的 也不能超出容量
+	for _, key := range []string{"b", "c", "a", "0"} {
+		d.Record(key)
+		if n := d.counts.ZCard(countsZSetKey); n > 2 {
+			t.Fatalf("tracked %d keys after %s, exceeds capacity 2", n, key)
+		}
+	}
+	if ok, _ := d.counts.ZScore(countsZSetKey, "0"); !ok {
+		t.Fatal("the latest key should be tracked")
+	}
+}
+
+func TestSampling(t *testing.T) {
+	d, _, _ := newTestDetector(Config{Promote: 1000, SampleRate: 10})
+	hot := false
+	for i := 0; i < 3000 && !hot; i++ {
+		hot = d.Record("Tom")
+	}
+	if !hot {
+		t.Fatal("Tom should be promoted with sampled counting")
+	}
+}
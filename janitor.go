@@ -0,0 +1,106 @@
+package geecache
+
+import (
+	"GeeCache/geecache/policy"
+	"sync"
+	"time"
+)
+
+// janitor 后台定期清理过期键
+// 过期键默认只在Get或Add时被惰性删除 一个不再有写入的cache会一直占用过期键的内存
+// 仿照Redis的active expire cycle: 每个周期按批(budget)从过期时间最早的key开始删除
+// 若一批删满说明可能还有大量过期键 继续下一批 直到没有过期键或用完本周期的时间配额
+
+const (
+	defaultJanitorBudget = 20
+	// 每个周期最多使用interval的25%用于清理 与Redis的ACTIVE_EXPIRE_CYCLE_SLOW_TIME_PERC一致
+	janitorTimePercent = 25
+)
+
+type janitor struct {
+	interval time.Duration
+	budget   int // 每批最多删除的过期键数量
+	next     int // 下个周期从哪个shard开始 时间配额用完时保证各shard轮流被清理
+	stop     chan struct{}
+	done     chan struct{}
+	once     sync.Once
+}
+
+// startJanitor 启动后台清理协程 interval<=0时不启动
+func (c *cache) startJanitor(interval time.Duration, budget int) {
+	if interval <= 0 {
+		return
+	}
+	if budget <= 0 {
+		budget = defaultJanitorBudget
+	}
+	j := &janitor{
+		interval: interval,
+		budget:   budget,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	c.janitor = j
+	go j.run(c)
+}
+
+func (j *janitor) run(c *cache) {
+	defer close(j.done)
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-j.stop:
+			return
+		case <-ticker.C:
+			j.activeExpire(c)
+		}
+	}
+}
+
+// activeExpire 执行一个清理周期 返回删除的过期键数量
+func (j *janitor) activeExpire(c *cache) int {
+	deadline := time.Now().Add(j.interval * janitorTimePercent / 100)
+	removed := 0
+	for i := 0; i < len(c.shards); i++ {
+		idx := (j.next + i) % len(c.shards)
+		for {
+			n := c.shards[idx].removeExpired(j.budget)
+			removed += n
+			if n < j.budget || time.Now().After(deadline) {
+				break
+			}
+		}
+		if time.Now().After(deadline) {
+			j.next = idx + 1
+			return removed
+		}
+	}
+	return removed
+}
+
+// Close 停止后台清理协程 可以重复调用
+func (c *cache) Close() {
+	if c.janitor == nil {
+		return
+	}
+	c.janitor.once.Do(func() {
+		close(c.janitor.stop)
+	})
+	<-c.janitor.done
+}
+
+// removeExpired 每批只持有一次锁 避免长时间阻塞读写
+func (s *shard) removeExpired(n int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.policy == nil {
+		return 0
+	}
+	if e, ok := s.policy.(policy.Expirer); ok {
+		removed := e.RemoveExpired(n)
+		s.sync()
+		return removed
+	}
+	return 0
+}
@@ -0,0 +1,111 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"strings"
+)
+
+// Logger 分级的结构化日志 args为键值对 如 "group", "scores", "key", "Tom"
+// 方法签名与*slog.Logger一致 因此*slog.Logger可以直接作为Logger使用
+// 热路径(缓存命中、选择节点、接收rpc)只输出Debug日志 默认的Logger不输出Debug
+// 热路径先以Enabled判断 避免在日志被丢弃时仍构造参数
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// Level 日志级别 取值与slog.Level相同
+type Level int
+
+const (
+	LevelDebug Level = -4
+	LevelInfo  Level = 0
+	LevelWarn  Level = 4
+	LevelError Level = 8
+)
+
+func (l Level) String() string {
+	return slog.Level(l).String()
+}
+
+// std 将不低于level的日志以 "LEVEL msg k=v ..." 的格式输出到标准库的log.Logger
+type std struct {
+	l     *log.Logger
+	level Level
+}
+
+// New 返回输出到l的Logger 低于level的日志被丢弃 l为nil时使用log.Default()
+func New(l *log.Logger, level Level) Logger {
+	if l == nil {
+		l = log.Default()
+	}
+	return &std{l: l, level: level}
+}
+
+var defaultLogger = New(nil, LevelInfo)
+
+// Default 通过log.Default()输出Info及以上级别的日志
+func Default() Logger {
+	return defaultLogger
+}
+
+// Enabled 报告l是否输出level级别的日志 l无法判断时返回true
+// 调用方在构造args之前判断 可变参数在Debug被调用前就已分配
+func Enabled(l Logger, level Level) bool {
+	switch l := l.(type) {
+	case interface{ Enabled(Level) bool }:
+		return l.Enabled(level)
+	case interface {
+		Enabled(context.Context, slog.Level) bool
+	}:
+		return l.Enabled(context.Background(), slog.Level(level))
+	}
+	return true
+}
+
+func (s *std) Enabled(level Level) bool { return level >= s.level }
+
+func (s *std) Debug(msg string, args ...interface{}) { s.log(LevelDebug, msg, args) }
+func (s *std) Info(msg string, args ...interface{})  { s.log(LevelInfo, msg, args) }
+func (s *std) Warn(msg string, args ...interface{})  { s.log(LevelWarn, msg, args) }
+func (s *std) Error(msg string, args ...interface{}) { s.log(LevelError, msg, args) }
+
+func (s *std) log(level Level, msg string, args []interface{}) {
+	if !s.Enabled(level) {
+		return
+	}
+	var b strings.Builder
+	b.WriteString(level.String())
+	b.WriteByte(' ')
+	b.WriteString(msg)
+	for i := 0; i < len(args); i += 2 {
+		// 与slog一致 落单的值使用!BADKEY作为key
+		if i+1 == len(args) {
+			fmt.Fprintf(&b, " !BADKEY=%v", args[i])
+			break
+		}
+		fmt.Fprintf(&b, " %v=%v", args[i], args[i+1])
+	}
+	s.l.Output(3, b.String())
+}
+
+type nop struct{}
+
+func (nop) Enabled(Level) bool { return false }
+
+func (nop) Debug(msg string, args ...interface{}) {}
+func (nop) Info(msg string, args ...interface{})  {}
+func (nop) Warn(msg string, args ...interface{})  {}
+func (nop) Error(msg string, args ...interface{}) {}
+
+// Nop 丢弃所有日志
+func Nop() Logger {
+	return nop{}
+}
+
+var _ Logger = (*slog.Logger)(nil)
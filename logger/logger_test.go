@@ -0,0 +1,53 @@
+package logger
+
+import (
+	"bytes"
+	"log"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestStd(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(log.New(&buf, "", 0), LevelInfo)
+	l.Debug("cache hit", "key", "Tom")
+	l.Info("ring changed", "peers", 3, "addr")
+	l.Error("watch peers failed", "err", "closed")
+
+	expect := "INFO ring changed peers=3 !BADKEY=addr\nERROR watch peers failed err=closed\n"
+	if buf.String() != expect {
+		t.Fatalf("expect %q, got %q", expect, buf.String())
+	}
+}
+
+func TestEnabled(t *testing.T) {
+	info := New(nil, LevelInfo)
+	if Enabled(info, LevelDebug) || !Enabled(info, LevelInfo) || Enabled(Nop(), LevelError) {
+		t.Fatal("unexpected Enabled of std or nop")
+	}
+	debug := slog.New(slog.NewTextHandler(&bytes.Buffer{}, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	if !Enabled(debug, LevelDebug) || Enabled(slog.Default(), LevelDebug) {
+		t.Fatal("unexpected Enabled of slog")
+	}
+
+	// 日志被丢弃时不构造参数
+	key := "Tom"
+	allocs := testing.AllocsPerRun(100, func() {
+		if Enabled(info, LevelDebug) {
+			info.Debug("cache hit", "group", "scores", "key", key)
+		}
+	})
+	if allocs != 0 {
+		t.Fatalf("expect no allocation, got %v", allocs)
+	}
+}
+
+func TestSlog(t *testing.T) {
+	var buf bytes.Buffer
+	var l Logger = slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	l.Debug("pick peer", "peer", "127.0.0.1:9002")
+	if !strings.Contains(buf.String(), "level=DEBUG msg=\"pick peer\" peer=127.0.0.1:9002") {
+		t.Fatalf("unexpected output %q", buf.String())
+	}
+}
@@ -11,7 +11,7 @@ import (
 // LFU：最不经常使用。它根据访问次数来决定是否被淘汰，可能会存在某个一段时间很热的key在另外一段时间不那么热，却由于积累的访问次数过大而无法被淘汰。它的实现使用两个map+双向链表。https://juejin.cn/post/6987260805888606245#heading-2
 
 // Warning: lru包不提供并发一致机制
-// TODO: 实现lru-k
+// LFU/LRU-K/2Q/ARC 等其他淘汰算法见policy包
 const (
 	expiresZSetKey = ""
 	// 每次移除过期键数量
@@ -77,17 +77,20 @@ func (c *Cache) removeElement(e *list.Element) {
 
 // 移除最近最少访问的节点
 // 缓存淘汰
+// 最近访问的节点在链表尾部 因此淘汰链表头部
 func (c *Cache) RemoveOldest() {
-	ele := c.ll.Back()
+	ele := c.ll.Front()
 	if ele != nil {
-		c.ll.Remove(ele)
-		kv := ele.Value.(*entry)
-		delete(c.cache, kv.key)
-		c.nbytes -= int(len(kv.key)) + int(kv.value.Len())
-		if c.onEvicted != nil {
-			c.onEvicted(kv.key, kv.value)
-		}
+		c.removeElement(ele)
+	}
+}
+
+// Victim 返回下一个将被淘汰的key
+func (c *Cache) Victim() (string, bool) {
+	if ele := c.ll.Front(); ele != nil {
+		return ele.Value.(*entry).key, true
 	}
+	return "", false
 }
 
 func (c *Cache) Add(key string, value Value) {
@@ -139,6 +142,22 @@ func (c *Cache) removeExpire(n int) int {
 	return n
 }
 
+// RemoveExpired 移除最多n个过期的键 返回移除的数量
+// 供后台定期清理使用 避免长期没有写入的缓存一直占用过期键的内存
+func (c *Cache) RemoveExpired(n int) int {
+	return n - c.removeExpire(n)
+}
+
+// Range 从最久未访问的key开始遍历 不改变访问顺序
+func (c *Cache) Range(fn func(key string, value Value) bool) {
+	for e := c.ll.Front(); e != nil; e = e.Next() {
+		kv := e.Value.(*entry)
+		if !fn(kv.key, kv.value) {
+			return
+		}
+	}
+}
+
 // Remove 移除某个键
 func (c *Cache) Remove(key string) {
 	if element, ok := c.cache[key]; ok {
@@ -148,3 +167,8 @@ func (c *Cache) Remove(key string) {
 func (c *Cache) Len() int {
 	return c.ll.Len()
 }
+
+// Bytes 返回已使用的内存
+func (c *Cache) Bytes() int {
+	return c.nbytes
+}
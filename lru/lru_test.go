@@ -3,6 +3,7 @@ package lru
 import (
 	"reflect"
 	"testing"
+	"time"
 )
 
 type String string
@@ -10,8 +11,11 @@ type String string
 func (d String) Len() int {
 	return len(d)
 }
+func (d String) Expire() time.Time {
+	return time.Time{}
+}
 func TestGet(t *testing.T) {
-	lru := New(int64(0), nil)
+	lru := New(0, nil)
 	lru.Add("key1", String("1234"))
 	if v, ok := lru.Get("key1"); !ok || string(v.(String)) != "1234" {
 		t.Fatal("cache hit key1 = 1234 failed")
@@ -25,7 +29,7 @@ func TestRemoveOldest(t *testing.T) {
 	k1, k2, k3 := "key1", "key2", "key3"
 	v1, v2, v3 := "value1", "value2", "value3"
 	cap := len(k1 + k2 + v1 + v2)
-	lru := New(int64(cap), nil)
+	lru := New(cap, nil)
 	lru.Add(k1, String(v1))
 	lru.Add(k2, String(v2))
 	lru.Add(k3, String(v3))
@@ -40,7 +44,7 @@ func TestOnEvicted(t *testing.T) {
 	callback := func(key string, value Value) {
 		keys = append(keys, key)
 	}
-	lru := New(int64(10), callback)
+	lru := New(10, callback)
 	lru.Add("key1", String("123456"))
 	lru.Add("k2", String("k2"))
 	lru.Add("k3", String("k3"))
@@ -52,3 +56,28 @@ func TestOnEvicted(t *testing.T) {
 		t.Fatalf("call onevicted failed, expect equals to %s", expect)
 	}
 }
+
+type expiring struct {
+	String
+	expire time.Time
+}
+
+func (e expiring) Expire() time.Time {
+	return e.expire
+}
+
+func TestRemoveExpired(t *testing.T) {
+	lru := New(0, nil)
+	for _, k := range []string{"k1", "k2", "k3"} {
+		lru.Add(k, expiring{String(k), time.Now().Add(-time.Second)})
+	}
+	lru.Add("k4", expiring{String("k4"), time.Now().Add(time.Hour)})
+	lru.Add("k5", String("k5"))
+
+	if n := lru.RemoveExpired(2); n != 2 || lru.Len() != 3 {
+		t.Fatalf("expect 2 removed and 3 left, got %d/%d", n, lru.Len())
+	}
+	if n := lru.RemoveExpired(10); n != 1 || lru.Len() != 2 {
+		t.Fatalf("expect 1 removed and 2 left, got %d/%d", n, lru.Len())
+	}
+}
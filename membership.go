@@ -0,0 +1,188 @@
+package geecache
+
+import (
+	"GeeCache/geecache/discovery"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// 哈希环成员关系随服务发现实时变化
+// 节点加入或离开时 在锁内增量地更新Placer与clients
+// 短时间内的多次变化(如节点抖动)会被合并 只应用debounce时间内最后一次的节点列表
+
+const (
+	defaultRingDebounce = 500 * time.Millisecond
+	// 持续抖动时 最多推迟maxDebounceFactor个debounce后强制应用
+	maxDebounceFactor = 4
+	watchRetryDelay   = time.Second
+)
+
+// RingDiff 描述一次哈希环成员变化
+type RingDiff struct {
+	Added   []string
+	Removed []string
+}
+
+func (d RingDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0
+}
+
+func (d RingDiff) String() string {
+	return fmt.Sprintf("+%v -%v", d.Added, d.Removed)
+}
+
+// SetRingDebounce 设置合并成员变化的时间窗口 需在Start之前调用
+func (s *server) SetRingDebounce(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.debounce = d
+}
+
+// OnRingChange 哈希环变化后调用fn 需在Start之前调用
+func (s *server) OnRingChange(fn func(RingDiff)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onRingChange = fn
+}
+
+// watchPeers 监听服务发现直到ctx结束 出错时每隔watchRetryDelay重试
+func (s *server) watchPeers(ctx context.Context, d discovery.Discovery) {
+	for {
+		ch, err := d.Watch(ctx)
+		if err == nil {
+			s.applyWatch(ctx, ch)
+		} else {
+			s.log().Error("watch peers failed", "addr", s.addr, "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(watchRetryDelay):
+		}
+	}
+}
+
+// applyWatch 第一次的节点列表立即应用 之后的变化经过debounce再应用
+func (s *server) applyWatch(ctx context.Context, ch <-chan []string) {
+	s.mu.Lock()
+	debounce := s.debounce
+	s.mu.Unlock()
+	if debounce <= 0 {
+		debounce = defaultRingDebounce
+	}
+
+	var (
+		pending  []string
+		timer    *time.Timer
+		timeout  <-chan time.Time
+		deadline time.Time
+		first    = true
+	)
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case peers, ok := <-ch:
+			if !ok {
+				return
+			}
+			if first {
+				first = false
+				s.updatePeers(peers)
+				continue
+			}
+			pending = peers
+			now := time.Now()
+			if timer == nil {
+				deadline = now.Add(maxDebounceFactor * debounce)
+				timer = time.NewTimer(debounce)
+			} else {
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(min(debounce, time.Until(deadline)))
+			}
+			timeout = timer.C
+		case <-timeout:
+			s.updatePeers(pending)
+			pending, timer, timeout = nil, nil, nil
+		}
+	}
+}
+
+// updatePeers 应用节点列表 并记录哈希环的变化
+func (s *server) updatePeers(peers []string) RingDiff {
+	s.mu.Lock()
+	diff := s.setPeersLocked(peers)
+	fn := s.onRingChange
+	n := len(s.clients)
+	handoff := s.handoffRate > 0 && len(diff.Added) > 0
+	s.mu.Unlock()
+
+	if diff.Empty() {
+		return diff
+	}
+	s.log().Info("ring changed", "addr", s.addr, "diff", diff, "peers", n)
+	if handoff {
+		go s.handoff(diff)
+	}
+	if fn != nil {
+		fn(diff)
+	}
+	return diff
+}
+
+// setPeersLocked 增量地更新哈希环与clients 自身总是在环中 非法的地址会被忽略
+// 调用方需持有锁
+func (s *server) setPeersLocked(peers []string) RingDiff {
+	var diff RingDiff
+	if s.placer == nil {
+		s.placer = s.makePlacer()
+		s.clients = make(map[string]*Client)
+	}
+	next := map[string]struct{}{s.addr: {}}
+	for _, addr := range peers {
+		if !validPeerAddr(addr) {
+			s.log().Warn("invalid address format, it should be x.x.x.x:port", "peer", addr)
+			continue
+		}
+		next[addr] = struct{}{}
+	}
+	for addr := range next {
+		if _, ok := s.clients[addr]; !ok {
+			diff.Added = append(diff.Added, addr)
+		}
+	}
+	for addr := range s.clients {
+		if _, ok := next[addr]; !ok {
+			diff.Removed = append(diff.Removed, addr)
+		}
+	}
+	slices.Sort(diff.Added)
+	slices.Sort(diff.Removed)
+
+	if len(diff.Removed) > 0 {
+		s.placer.Remove(diff.Removed...)
+		for _, addr := range diff.Removed {
+			s.pool.remove(s.clients[addr].name)
+			delete(s.clients, addr)
+		}
+	}
+	if len(diff.Added) > 0 {
+		s.register(diff.Added...)
+		for _, addr := range diff.Added {
+			s.clients[addr] = s.newClient(addr)
+		}
+	}
+	return diff
+}
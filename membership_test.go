@@ -0,0 +1,185 @@
+package geecache
+
+import (
+	"GeeCache/geecache/discovery"
+	"GeeCache/geecache/placement"
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestUpdatePeers(t *testing.T) {
+	svr, _ := NewServer("127.0.0.1:9001")
+	defer svr.pool.Close()
+
+	diff := svr.updatePeers([]string{"127.0.0.1:9002", "invalid"})
+	if !reflect.DeepEqual(diff.Added, []string{"127.0.0.1:9001", "127.0.0.1:9002"}) || len(diff.Removed) != 0 {
+		t.Fatalf("unexpected diff %s", diff)
+	}
+	client := svr.clients["127.0.0.1:9002"]
+
+	diff = svr.updatePeers([]string{"127.0.0.1:9002", "127.0.0.1:9003"})
+	if !reflect.DeepEqual(diff.Added, []string{"127.0.0.1:9003"}) || len(diff.Removed) != 0 {
+		t.Fatalf("unexpected diff %s", diff)
+	}
+	// 已有的节点保持不变
+	if svr.clients["127.0.0.1:9002"] != client {
+		t.Fatal("existing client should be kept")
+	}
+
+	diff = svr.updatePeers([]string{"127.0.0.1:9003"})
+	if len(diff.Added) != 0 || !reflect.DeepEqual(diff.Removed, []string{"127.0.0.1:9002"}) {
+		t.Fatalf("unexpected diff %s", diff)
+	}
+	for i := 0; i < 100; i++ {
+		if peer, ok := svr.PickPeer(string(rune('a' + i%26))); ok && peer.(*Client).name == "127.0.0.1:9002" {
+			t.Fatal("removed peer should not be picked")
+		}
+	}
+	if diff := svr.updatePeers([]string{"127.0.0.1:9003"}); !diff.Empty() {
+		t.Fatalf("expect empty diff, got %s", diff)
+	}
+}
+
+func TestSetPeersWithoutSelf(t *testing.T) {
+	svr, _ := NewServer("127.0.0.1:9001")
+	defer svr.pool.Close()
+
+	// 节点列表中没有自己时 自己仍在环中
+	svr.SetPeers("127.0.0.1:9002", "127.0.0.1:9003")
+	if _, ok := svr.clients["127.0.0.1:9001"]; !ok {
+		t.Fatal("self should always be in the ring")
+	}
+	local := 0
+	for i := 0; i < 100; i++ {
+		if _, ok := svr.PickPeer(string(rune('a' + i%26))); !ok {
+			local++
+		}
+	}
+	if local == 0 {
+		t.Fatal("self should own some keys")
+	}
+}
+
+func TestSetPlacement(t *testing.T) {
+	svr, _ := NewServer("127.0.0.1:9001")
+	defer svr.pool.Close()
+	peers := []string{"127.0.0.1:9002", "127.0.0.1:9003"}
+	svr.updatePeers(peers)
+
+	// 切换算法后 已有的节点按新算法放置
+	svr.SetPlacement(placement.Rendezvous)
+	expect := placement.NewRendezvous(nil)
+	expect.Register(append(peers, "127.0.0.1:9001")...)
+	for i := 0; i < 100; i++ {
+		key := string(rune('a' + i%26))
+		if got := svr.owner(key); got != expect.Get(key) {
+			t.Fatalf("%s: expect owner %s, got %s", key, expect.Get(key), got)
+		}
+	}
+}
+
+func TestPeerWeights(t *testing.T) {
+	svr, _ := NewServer("127.0.0.1:9001")
+	defer svr.pool.Close()
+	svr.updatePeers([]string{"127.0.0.1:9002"})
+
+	// 权重为3的节点大约负责3/4的key
+	svr.SetPeerWeights(map[string]int{"127.0.0.1:9002": 3})
+	for _, peer := range svr.RingStats() {
+		if peer.Addr == "127.0.0.1:9002" && (peer.Ownership < 0.65 || peer.Ownership > 0.85) {
+			t.Fatalf("expect weighted peer to own ~3/4 of keys, got %.3f", peer.Ownership)
+		}
+	}
+	// 之后加入的节点同样按权重放置
+	svr.SetPeerWeights(map[string]int{"127.0.0.1:9003": 8})
+	svr.updatePeers([]string{"127.0.0.1:9002", "127.0.0.1:9003"})
+	ownership := make(map[string]float64)
+	for _, peer := range svr.RingStats() {
+		ownership[peer.Addr] = peer.Ownership
+	}
+	// crc32的环分布不均 只检查权重大的节点明显多于其他节点
+	if ownership["127.0.0.1:9003"] < 3*max(ownership["127.0.0.1:9001"], ownership["127.0.0.1:9002"]) {
+		t.Fatalf("expect weighted peer to own most keys, got %v", ownership)
+	}
+}
+
+func TestBoundedLoad(t *testing.T) {
+	svr, _ := NewServer("127.0.0.1:9001")
+	defer svr.pool.Close()
+	svr.SetPlacement(placement.BoundedRing(defaultReplicas, 0.25))
+	svr.updatePeers([]string{"127.0.0.1:9002", "127.0.0.1:9003"})
+	if svr.clients["127.0.0.1:9002"].track == nil {
+		t.Fatal("clients should report their load to the placer")
+	}
+
+	var key string
+	for i := 0; svr.owner(key) != "127.0.0.1:9002"; i++ {
+		key = string(rune('a' + i))
+	}
+	// 节点上有过多正在进行的rpc时 key溢出到其他节点
+	var dones []func()
+	for i := 0; i < 3; i++ {
+		dones = append(dones, svr.trackLoad("127.0.0.1:9002"))
+	}
+	if owner := svr.owner(key); owner == "127.0.0.1:9002" {
+		t.Fatalf("%s should overflow from the loaded peer", key)
+	}
+	for _, done := range dones {
+		done()
+	}
+	if owner := svr.owner(key); owner != "127.0.0.1:9002" {
+		t.Fatalf("%s should return to its owner, got %s", key, owner)
+	}
+}
+
+func TestWatchPeers(t *testing.T) {
+	d := discovery.NewMemory()
+	d.Add("127.0.0.1:9002")
+	svr, _ := NewServer("127.0.0.1:9001")
+	defer svr.pool.Close()
+	svr.SetRingDebounce(50 * time.Millisecond)
+
+	var (
+		mu    sync.Mutex
+		diffs []RingDiff
+	)
+	changed := make(chan struct{}, 10)
+	svr.OnRingChange(func(diff RingDiff) {
+		mu.Lock()
+		diffs = append(diffs, diff)
+		mu.Unlock()
+		changed <- struct{}{}
+	})
+	wait := func() {
+		t.Helper()
+		select {
+		case <-changed:
+		case <-time.After(2 * time.Second):
+			t.Fatal("timeout waiting for ring change")
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go svr.watchPeers(ctx, d)
+	wait() // 第一次的节点列表立即应用
+
+	// 节点抖动: debounce窗口内加入又离开 哈希环不变
+	d.Add("127.0.0.1:9003")
+	d.Remove("127.0.0.1:9003")
+	// 之后真正加入一个节点
+	d.Add("127.0.0.1:9004")
+	wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(diffs) != 2 {
+		t.Fatalf("expect 2 ring changes, got %v", diffs)
+	}
+	if !reflect.DeepEqual(diffs[1].Added, []string{"127.0.0.1:9004"}) || len(diffs[1].Removed) != 0 {
+		t.Fatalf("flapping peer should be debounced, got %s", diffs[1])
+	}
+}
@@ -0,0 +1,305 @@
+package geecache
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"io"
+	"math"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MetricsSink 接收geecache的指标 可以对接Prometheus、StatsD等
+// labels为键值对 如 "group", "scores", "cache", "main"
+// 实现需要支持并发调用 Registry是不依赖第三方库的内置实现
+type MetricsSink interface {
+	// Counter 累加计数器
+	Counter(name string, delta float64, labels ...string)
+	// Gauge 设置当前值
+	Gauge(name string, value float64, labels ...string)
+	// Histogram 记录一次观测值 耗时以秒为单位
+	Histogram(name string, value float64, labels ...string)
+}
+
+// 指标名 与Prometheus的命名习惯一致
+const (
+	MetricCacheHits        = "geecache_cache_hits_total"        // group, cache
+	MetricCacheMisses      = "geecache_cache_misses_total"      // group, cache
+	MetricCacheEvictions   = "geecache_cache_evictions_total"   // group, cache
+	MetricCacheExpirations = "geecache_cache_expirations_total" // group, cache
+	MetricCacheBytes       = "geecache_cache_bytes"             // group, cache
+	MetricCacheEntries     = "geecache_cache_entries"           // group, cache
+
+	MetricLoads        = "geecache_loads_total"         // group 缓存未命中而需要加载的次数
+	MetricLoadsDeduped = "geecache_loads_deduped_total" // group 被singleflight合并的加载
+
+	MetricGetterDuration = "geecache_getter_duration_seconds" // group
+	MetricGetterErrors   = "geecache_getter_errors_total"     // group
+
+	MetricPeerDuration = "geecache_peer_fetch_duration_seconds" // group, peer
+	MetricPeerErrors   = "geecache_peer_fetch_errors_total"     // group, peer
+
+	MetricRPCRequests = "geecache_rpc_requests_total"   // method, code
+	MetricRPCDuration = "geecache_rpc_duration_seconds" // method
+)
+
+// DefaultBuckets Registry中直方图的默认分桶 单位为秒
+var DefaultBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type metricType int
+
+const (
+	counterType metricType = iota
+	gaugeType
+	histogramType
+)
+
+func (t metricType) String() string {
+	return [...]string{"counter", "gauge", "histogram"}[t]
+}
+
+type series struct {
+	labels  string // 已格式化的 {k="v",...}
+	value   float64
+	buckets []uint64 // 直方图各桶的计数(不累加)
+	count   uint64
+}
+
+type family struct {
+	typ    metricType
+	series map[string]*series
+}
+
+// Registry 在内存中汇总指标 并以Prometheus文本格式输出
+// 实现了http.Handler 可以直接挂载到/metrics
+type Registry struct {
+	mu       sync.Mutex
+	buckets  []float64
+	families map[string]*family
+}
+
+// NewRegistry buckets为空时使用DefaultBuckets
+func NewRegistry(buckets ...float64) *Registry {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &Registry{buckets: buckets, families: make(map[string]*family)}
+}
+
+func (r *Registry) Counter(name string, delta float64, labels ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.series(name, counterType, labels).value += delta
+}
+
+func (r *Registry) Gauge(name string, value float64, labels ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.series(name, gaugeType, labels).value = value
+}
+
+func (r *Registry) Histogram(name string, value float64, labels ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.series(name, histogramType, labels)
+	if s.buckets == nil {
+		s.buckets = make([]uint64, len(r.buckets))
+	}
+	if i := sort.SearchFloat64s(r.buckets, value); i < len(r.buckets) {
+		s.buckets[i]++
+	}
+	s.value += value
+	s.count++
+}
+
+// series 调用方需持有锁 同名指标的类型以第一次使用时为准
+func (r *Registry) series(name string, typ metricType, labels []string) *series {
+	f, ok := r.families[name]
+	if !ok {
+		f = &family{typ: typ, series: make(map[string]*series)}
+		r.families[name] = f
+	}
+	key := formatLabels(labels)
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labels: key}
+		f.series[key] = s
+	}
+	return s
+}
+
+// Value 返回计数器或gauge的当前值 直方图返回观测值之和 用于测试与调试
+func (r *Registry) Value(name string, labels ...string) float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if f, ok := r.families[name]; ok {
+		if s, ok := f.series[formatLabels(labels)]; ok {
+			return s.value
+		}
+	}
+	return 0
+}
+
+// formatLabels 按键排序后格式化为{k="v",...} 奇数个参数时忽略最后一个
+func formatLabels(labels []string) string {
+	if len(labels) < 2 {
+		return ""
+	}
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, labels[i]+"="+strconv.Quote(labels[i+1]))
+	}
+	sort.Strings(pairs)
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// withLabel 在已格式化的labels中追加一个标签
+func withLabel(labels, key, value string) string {
+	pair := key + "=" + strconv.Quote(value)
+	if labels == "" {
+		return "{" + pair + "}"
+	}
+	return labels[:len(labels)-1] + "," + pair + "}"
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// WriteText 以Prometheus文本格式(0.0.4)输出所有指标
+func (r *Registry) WriteText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	r.mu.Lock()
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := r.families[name]
+		fmt.Fprintf(bw, "# TYPE %s %s\n", name, f.typ)
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			s := f.series[key]
+			if f.typ != histogramType {
+				fmt.Fprintf(bw, "%s%s %s\n", name, s.labels, formatFloat(s.value))
+				continue
+			}
+			var cumulative uint64
+			for i, upper := range r.buckets {
+				cumulative += s.buckets[i]
+				fmt.Fprintf(bw, "%s_bucket%s %d\n", name, withLabel(s.labels, "le", formatFloat(upper)), cumulative)
+			}
+			fmt.Fprintf(bw, "%s_bucket%s %d\n", name, withLabel(s.labels, "le", "+Inf"), s.count)
+			fmt.Fprintf(bw, "%s_sum%s %s\n", name, s.labels, formatFloat(s.value))
+			fmt.Fprintf(bw, "%s_count%s %d\n", name, s.labels, s.count)
+		}
+	}
+	r.mu.Unlock()
+	return bw.Flush()
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteText(w)
+}
+
+var _ MetricsSink = (*Registry)(nil)
+var _ http.Handler = (*Registry)(nil)
+
+// count 累加Group的计数器 未设置sink时不做任何事
+func (g *Group) count(name string, labels ...string) {
+	g.countN(name, 1, labels...)
+}
+
+// countN 将Group的计数器累加n
+func (g *Group) countN(name string, n int64, labels ...string) {
+	if g.metrics == nil || n == 0 {
+		return
+	}
+	g.metrics.Counter(name, float64(n), append([]string{"group", g.name}, labels...)...)
+}
+
+// observe 记录从start开始的耗时
+func (g *Group) observe(name string, start time.Time, labels ...string) {
+	if g.metrics == nil {
+		return
+	}
+	g.metrics.Histogram(name, time.Since(start).Seconds(), append([]string{"group", g.name}, labels...)...)
+}
+
+// observeGetter 记录一次Getter调用
+func (g *Group) observeGetter(start time.Time, err error) {
+	g.observe(MetricGetterDuration, start)
+	if err != nil {
+		g.count(MetricGetterErrors)
+	}
+}
+
+// observePeer 记录一次远端请求 peer以其地址作为label
+func (g *Group) observePeer(peer Fetcher, start time.Time, err error) {
+	if g.metrics == nil {
+		return
+	}
+	name := peerName(peer)
+	g.observe(MetricPeerDuration, start, "peer", name)
+	if err != nil {
+		g.count(MetricPeerErrors, "peer", name)
+	}
+}
+
+// peerName 返回peer的名字 不是*Client时使用类型名
+func peerName(peer Fetcher) string {
+	if named, ok := peer.(interface{ Name() string }); ok {
+		return named.Name()
+	}
+	return fmt.Sprintf("%T", peer)
+}
+
+// SetMetrics 记录每个rpc的请求数(按返回码)与耗时 需在Start之前调用
+func (s *server) SetMetrics(sink MetricsSink) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.metrics = sink
+}
+
+// observeRPC 记录一次rpc method为不带服务名的方法名
+func (s *server) observeRPC(fullMethod string, start time.Time, err error) {
+	method := path.Base(fullMethod)
+	s.metrics.Counter(MetricRPCRequests, 1, "method", method, "code", status.Code(err).String())
+	s.metrics.Histogram(MetricRPCDuration, time.Since(start).Seconds(), "method", method)
+}
+
+func (s *server) metricsUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	s.observeRPC(info.FullMethod, start, err)
+	return resp, err
+}
+
+func (s *server) metricsStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	s.observeRPC(info.FullMethod, start, err)
+	return err
+}
@@ -0,0 +1,149 @@
+package geecache
+
+import (
+	"context"
+	"fmt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRegistryText(t *testing.T) {
+	r := NewRegistry(0.1, 1)
+	r.Counter("requests_total", 1, "method", "Get")
+	r.Counter("requests_total", 2, "method", "Get")
+	r.Gauge("bytes", 42)
+	r.Histogram("duration_seconds", 0.05)
+	r.Histogram("duration_seconds", 0.5)
+	r.Histogram("duration_seconds", 5)
+
+	var b strings.Builder
+	if err := r.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"# TYPE requests_total counter",
+		`requests_total{method="Get"} 3`,
+		"# TYPE bytes gauge",
+		"bytes 42",
+		"# TYPE duration_seconds histogram",
+		`duration_seconds_bucket{le="0.1"} 1`,
+		`duration_seconds_bucket{le="1"} 2`,
+		`duration_seconds_bucket{le="+Inf"} 3`,
+		"duration_seconds_sum 5.55",
+		"duration_seconds_count 3",
+	} {
+		if !strings.Contains(b.String(), line+"\n") {
+			t.Fatalf("missing %q in\n%s", line, b.String())
+		}
+	}
+}
+
+func TestGroupMetrics(t *testing.T) {
+	r := NewRegistry()
+	release := make(chan struct{})
+	g := NewGroup("metrics", 64, GetterFunc(func(key string) (ByteView, error) {
+		switch key {
+		case "bad":
+			return ByteView{}, fmt.Errorf("%s not exist", key)
+		case "slow":
+			<-release
+		case "short":
+			return NewByteViewWithTTL([]byte("v"), time.Millisecond), nil
+		}
+		return NewByteView([]byte("0123456789")), nil
+	}), WithShards(1), WithMetrics(r))
+
+	labels := []string{"group", "metrics", "cache", "main"}
+	g.Get("k0")
+	g.Get("k0")
+	if r.Value(MetricCacheHits, labels...) != 1 || r.Value(MetricCacheMisses, labels...) != 1 {
+		t.Fatalf("expect 1 hit and 1 miss, got %v and %v",
+			r.Value(MetricCacheHits, labels...), r.Value(MetricCacheMisses, labels...))
+	}
+
+	// 64字节最多容纳5个条目 之后的条目触发淘汰
+	for i := 1; i < 10; i++ {
+		g.Get(fmt.Sprintf("k%d", i))
+	}
+	if r.Value(MetricCacheEvictions, labels...) == 0 {
+		t.Fatal("expect evictions")
+	}
+	if bytes := r.Value(MetricCacheBytes, labels...); bytes == 0 || bytes > 64 {
+		t.Fatalf("unexpected bytes gauge %v", bytes)
+	}
+	if entries := r.Value(MetricCacheEntries, labels...); int(entries) != g.mainCache.shards[0].policy.Len() {
+		t.Fatalf("entries gauge %v does not match cache", entries)
+	}
+
+	// 过期的键单独计数 不算作淘汰
+	g.Get("short")
+	evictions := r.Value(MetricCacheEvictions, labels...)
+	time.Sleep(5 * time.Millisecond)
+	g.mainCache.peek("short")
+	if r.Value(MetricCacheExpirations, labels...) != 1 || r.Value(MetricCacheEvictions, labels...) != evictions {
+		t.Fatalf("expect 1 expiration, got %v", r.Value(MetricCacheExpirations, labels...))
+	}
+	// 显式删除既不是淘汰也不是过期
+	g.Get("k9")
+	evictions = r.Value(MetricCacheEvictions, labels...)
+	g.removeLocally("k9")
+	if r.Value(MetricCacheEvictions, labels...) != evictions {
+		t.Fatal("remove should not count as eviction")
+	}
+
+	if _, err := g.Get("bad"); err == nil {
+		t.Fatal("expect error")
+	}
+	if r.Value(MetricGetterErrors, "group", "metrics") != 1 {
+		t.Fatalf("expect 1 getter error, got %v", r.Value(MetricGetterErrors, "group", "metrics"))
+	}
+
+	// 并发的请求只有一个执行加载 其余被合并
+	loads := r.Value(MetricLoads, "group", "metrics")
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g.Get("slow")
+		}()
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for r.Value(MetricLoads, "group", "metrics") < loads+5 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	if n := r.Value(MetricLoadsDeduped, "group", "metrics"); n != 4 {
+		t.Fatalf("expect 4 deduped loads, got %v", n)
+	}
+}
+
+func TestRPCMetrics(t *testing.T) {
+	r := NewRegistry()
+	svr, _ := NewServer("127.0.0.1:9001")
+	defer svr.pool.Close()
+	svr.SetMetrics(r)
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/geecachepb.GroupCache/Get"}
+	svr.metricsUnary(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	})
+	svr.metricsUnary(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.PermissionDenied, "denied")
+	})
+	if r.Value(MetricRPCRequests, "method", "Get", "code", "OK") != 1 ||
+		r.Value(MetricRPCRequests, "method", "Get", "code", "PermissionDenied") != 1 {
+		t.Fatal("expect requests counted by code")
+	}
+	var b strings.Builder
+	r.WriteText(&b)
+	if !strings.Contains(b.String(), MetricRPCDuration+`_count{method="Get"} 2`) {
+		t.Fatalf("expect 2 durations recorded, got\n%s", b.String())
+	}
+}
@@ -0,0 +1,225 @@
+package geecache
+
+import (
+	"GeeCache/geecache/logger"
+	"context"
+	"errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"math/rand"
+	"slices"
+	"sync"
+	"time"
+)
+
+// PeerPolicy 访问单个远端节点时的重试、对冲与熔断策略
+type PeerPolicy struct {
+	Retries     int           // 失败后的最大重试次数 0表示不重试
+	BackoffBase time.Duration // 第i次重试前等待[0, min(BackoffMax, BackoffBase*2^i))的随机时长
+	BackoffMax  time.Duration
+
+	// Hedge 为true时 若owner在其p95延迟内没有返回 则同时向副本发出请求 先返回的结果胜出
+	// 需要Group开启WithReplication
+	Hedge bool
+
+	BreakerThreshold int           // 连续失败多少次后熔断 0表示不熔断
+	BreakerCooldown  time.Duration // 熔断后经过多久放行一个探测请求
+}
+
+// DefaultPeerPolicy server默认使用的策略
+var DefaultPeerPolicy = PeerPolicy{
+	Retries:          2,
+	BackoffBase:      20 * time.Millisecond,
+	BackoffMax:       200 * time.Millisecond,
+	Hedge:            true,
+	BreakerThreshold: 5,
+	BreakerCooldown:  5 * time.Second,
+}
+
+// ErrBreakerOpen 节点已熔断 请求没有发出
+var ErrBreakerOpen = errors.New("peer circuit breaker is open")
+
+// errUnreachable 无法与节点建立连接
+var errUnreachable = errors.New("peer unreachable")
+
+// backoff 第attempt次重试前的等待时长(full jitter)
+func (p PeerPolicy) backoff(attempt int) time.Duration {
+	if p.BackoffBase <= 0 {
+		return 0
+	}
+	d := p.BackoffBase << attempt
+	if d <= 0 || (p.BackoffMax > 0 && d > p.BackoffMax) {
+		d = p.BackoffMax
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+// retryable 连接失败、超时、过载等与节点状态有关的错误才值得重试 也计入熔断
+// Getter返回的错误(codes.Unknown)说明节点工作正常
+func retryable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted:
+		return true
+	}
+	return errors.Is(err, errUnreachable) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// canceled 调用方主动取消(如对冲请求中落败的一方) 不能说明节点的好坏
+func canceled(err error) bool {
+	return status.Code(err) == codes.Canceled || errors.Is(err, context.Canceled)
+}
+
+// BreakerState 熔断器的状态
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota // 正常放行
+	BreakerOpen                         // 拒绝所有请求
+	BreakerHalfOpen                     // 冷却结束 只放行一个探测请求
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// breaker 每个节点一个的熔断器
+// closed: 连续失败threshold次后进入open
+// open: cooldown结束后进入half-open
+// half-open: 探测成功回到closed 失败重新open
+type breaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool // half-open时是否已有探测请求
+	now      func() time.Time
+	logger   logger.Logger
+}
+
+func newBreaker(name string, threshold int, cooldown time.Duration) *breaker {
+	return &breaker{name: name, threshold: threshold, cooldown: cooldown, now: time.Now, logger: logger.Default()}
+}
+
+// allow 返回请求能否发出 放行的请求必须调用record
+func (b *breaker) allow() bool {
+	if b == nil || b.threshold <= 0 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.setState(BreakerHalfOpen)
+		fallthrough
+	case BreakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+	}
+	return true
+}
+
+// record 记录一次请求的结果 只有retryable的错误计为失败
+func (b *breaker) record(err error) {
+	if b == nil || b.threshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if canceled(err) {
+		b.probing = false
+		return
+	}
+	failed := err != nil && retryable(err)
+	if b.state == BreakerHalfOpen {
+		b.probing = false
+		if failed {
+			b.openedAt = b.now()
+			b.setState(BreakerOpen)
+		} else {
+			b.failures = 0
+			b.setState(BreakerClosed)
+		}
+		return
+	}
+	if !failed {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == BreakerClosed && b.failures >= b.threshold {
+		b.openedAt = b.now()
+		b.setState(BreakerOpen)
+	}
+}
+
+// setState 调用方需持有锁
+func (b *breaker) setState(state BreakerState) {
+	if b.state != state {
+		b.logger.Warn("circuit breaker state changed", "peer", b.name, "from", b.state, "to", state)
+		b.state = state
+	}
+}
+
+func (b *breaker) State() BreakerState {
+	if b == nil {
+		return BreakerClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen && b.now().Sub(b.openedAt) >= b.cooldown {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+const (
+	latencySamples    = 128 // 计算p95使用的最近样本数
+	minLatencySamples = 20  // 样本不足时不对冲
+)
+
+// latency 记录最近若干次成功请求的延迟
+type latency struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+}
+
+func (l *latency) add(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.samples) < latencySamples {
+		l.samples = append(l.samples, d)
+		return
+	}
+	l.samples[l.next] = d
+	l.next = (l.next + 1) % latencySamples
+}
+
+// p95 样本不足时返回false
+func (l *latency) p95() (time.Duration, bool) {
+	l.mu.Lock()
+	samples := slices.Clone(l.samples)
+	l.mu.Unlock()
+	if len(samples) < minLatencySamples {
+		return 0, false
+	}
+	slices.Sort(samples)
+	return samples[len(samples)*95/100], true
+}
@@ -0,0 +1,184 @@
+package geecache
+
+import (
+	pb "GeeCache/geecache/geecachepb"
+	"context"
+	"errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	now := time.Now()
+	b := newBreaker("peer", 3, time.Second)
+	b.now = func() time.Time { return now }
+	unavailable := status.Error(codes.Unavailable, "down")
+
+	// Getter返回的错误不计入失败
+	for i := 0; i < 5; i++ {
+		b.allow()
+		b.record(status.Error(codes.Unknown, "not found"))
+	}
+	if b.State() != BreakerClosed {
+		t.Fatalf("application errors should not open the breaker, got %s", b.State())
+	}
+
+	for i := 0; i < 3; i++ {
+		if !b.allow() {
+			t.Fatal("closed breaker should allow requests")
+		}
+		b.record(unavailable)
+	}
+	if b.State() != BreakerOpen || b.allow() {
+		t.Fatalf("expect open breaker to reject requests, got %s", b.State())
+	}
+
+	// 冷却结束后只放行一个探测请求 探测失败重新熔断
+	now = now.Add(time.Second)
+	if b.State() != BreakerHalfOpen || !b.allow() || b.allow() {
+		t.Fatal("half-open breaker should allow exactly one probe")
+	}
+	b.record(unavailable)
+	if b.State() != BreakerOpen {
+		t.Fatalf("failed probe should reopen the breaker, got %s", b.State())
+	}
+
+	// 取消的探测不改变状态 之后可以再次探测
+	now = now.Add(time.Second)
+	b.allow()
+	b.record(context.Canceled)
+	if !b.allow() {
+		t.Fatal("canceled probe should release the half-open slot")
+	}
+	b.record(nil)
+	if b.State() != BreakerClosed {
+		t.Fatalf("successful probe should close the breaker, got %s", b.State())
+	}
+}
+
+// flakyServer 前failures次Get返回err
+type flakyServer struct {
+	pb.UnimplementedGroupCacheServer
+	calls    int32
+	failures int32
+	err      error
+}
+
+func (s *flakyServer) Get(ctx context.Context, in *pb.Request) (*pb.Response, error) {
+	if atomic.AddInt32(&s.calls, 1) <= s.failures {
+		return nil, s.err
+	}
+	return &pb.Response{Value: []byte("value-" + in.GetKey())}, nil
+}
+
+func flakyClient(t *testing.T, svr *flakyServer, policy PeerPolicy) *Client {
+	cluster := newBufNet()
+	cluster.serve(t, "flaky", svr)
+	client := cluster.client(t, "flaky")
+	client.policy = policy
+	client.breaker = newBreaker("flaky", policy.BreakerThreshold, policy.BreakerCooldown)
+	return client
+}
+
+func TestClientRetry(t *testing.T) {
+	policy := PeerPolicy{Retries: 2, BackoffBase: time.Millisecond, BackoffMax: 5 * time.Millisecond}
+
+	svr := &flakyServer{failures: 2, err: status.Error(codes.Unavailable, "busy")}
+	client := flakyClient(t, svr, policy)
+	if v, err := client.Fetch("g", "key"); err != nil || v.String() != "value-key" {
+		t.Fatalf("expect retries to succeed, got %s %v", v, err)
+	}
+	if n := atomic.LoadInt32(&svr.calls); n != 3 {
+		t.Fatalf("expect 3 attempts, got %d", n)
+	}
+
+	// Getter的错误不重试
+	svr = &flakyServer{failures: 1, err: errors.New("no such key")}
+	client = flakyClient(t, svr, policy)
+	if _, err := client.Fetch("g", "key"); err == nil {
+		t.Fatal("application error should be returned")
+	}
+	if n := atomic.LoadInt32(&svr.calls); n != 1 {
+		t.Fatalf("application error should not be retried, got %d attempts", n)
+	}
+}
+
+func TestClientBreaker(t *testing.T) {
+	svr := &flakyServer{failures: 1 << 30, err: status.Error(codes.Unavailable, "down")}
+	client := flakyClient(t, svr, PeerPolicy{BreakerThreshold: 2, BreakerCooldown: time.Hour})
+	for i := 0; i < 2; i++ {
+		if _, err := client.Fetch("g", "key"); err == nil {
+			t.Fatal("expect failure")
+		}
+	}
+	if client.BreakerState() != BreakerOpen {
+		t.Fatalf("expect open breaker, got %s", client.BreakerState())
+	}
+	if _, err := client.Fetch("g", "key"); !errors.Is(err, ErrBreakerOpen) {
+		t.Fatalf("expect ErrBreakerOpen, got %v", err)
+	}
+	if n := atomic.LoadInt32(&svr.calls); n != 2 {
+		t.Fatalf("open breaker should not reach the peer, got %d calls", n)
+	}
+}
+
+// slowPeer 直到ctx结束都不返回 模拟卡住的节点
+type slowPeer struct {
+	canceled chan struct{}
+}
+
+func (p *slowPeer) Fetch(group string, key string) (ByteView, error) {
+	return p.FetchContext(context.Background(), group, key)
+}
+
+func (p *slowPeer) FetchContext(ctx context.Context, group string, key string) (ByteView, error) {
+	<-ctx.Done()
+	close(p.canceled)
+	return ByteView{}, ctx.Err()
+}
+
+func (p *slowPeer) HedgeDelay() (time.Duration, bool) {
+	return 10 * time.Millisecond, true
+}
+
+// hedgePicker key的owner为slow 副本为replica
+type hedgePicker struct {
+	slow    *slowPeer
+	replica *fakePeer
+}
+
+func (p *hedgePicker) PickPeer(key string) (Fetcher, bool) {
+	return p.slow, true
+}
+
+func (p *hedgePicker) PickReplicas(key string, n int) []Fetcher {
+	return []Fetcher{p.replica}
+}
+
+func TestHedgedFetch(t *testing.T) {
+	var loads int32
+	remote := NewGroup("hedge-remote", 2<<10, countingGetter(&loads))
+	local := NewGroup("hedge", 2<<10, GetterFunc(func(key string) (ByteView, error) {
+		t.Error("local getter should not be called")
+		return ByteView{}, nil
+	}), WithReplication(2))
+	slow := &slowPeer{canceled: make(chan struct{})}
+	local.RegisterSvr(&hedgePicker{slow: slow, replica: &fakePeer{g: remote}})
+
+	start := time.Now()
+	v, err := local.Get("key")
+	if err != nil || v.String() != "value-key" {
+		t.Fatalf("expect value from replica, got %s %v", v, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("hedged fetch should not wait for the slow owner, took %v", elapsed)
+	}
+	select {
+	case <-slow.canceled:
+	case <-time.After(time.Second):
+		t.Fatal("request to the slow owner should be canceled")
+	}
+}
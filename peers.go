@@ -1,5 +1,10 @@
 package geecache
 
+import (
+	"context"
+	"time"
+)
+
 // PeerPicker 定义了获取分布式节点的能力
 type PeerPicker interface {
 	PickPeer(key string) (Fetcher, bool)
@@ -11,110 +16,39 @@ type Fetcher interface {
 	Fetch(group string, key string) (ByteView, error)
 }
 
-/*
-type ClientPicker struct {
-	self        string
-	serviceName string
-	mu          sync.RWMutex
-	consHash    *consistenthash.Map
-	clients     map[string]*Client
+// ContextFetcher 是支持context的Fetcher
+// 若Peer实现了该接口 Group会优先调用FetchContext 使调用方的deadline/取消能传递到远端
+type ContextFetcher interface {
+	FetchContext(ctx context.Context, group string, key string) (ByteView, error)
 }
 
-func (p *ClientPicker) PickPeer(key string) (peer PeerGetter, ok bool) {
-	p.mu.RLock()
-	defer p.mu.RUnlock()
-	if peer := p.consHash.Get(key); peer != "" {
-		log.Println("Picker peer %s", peer)
-		return p.clients[peer], true
-	}
-	return nil, false
+// BatchFetcher 定义了一次从远端获取多个key的能力
+// 返回的结果与keys一一对应 error不为nil表示整个请求失败
+type BatchFetcher interface {
+	FetchMany(ctx context.Context, group string, keys []string) ([]Result, error)
 }
 
-func NewClientPicker(self string, opts ...PickerOptions) *ClientPicker {
-	picker := ClientPicker{
-		self:        self,
-		serviceName: defaultServiceName,
-		clients:     make(map[string]*Client),
-		mu:          sync.RWMutex{},
-		consHash:    consistenthash.New(),
-	}
-	picker.mu.Lock()
-	//增量更新
-	picker.set(picker.self)
-	go func() {
-		cli, err := clientv3.New(*register_node.GlobalClientConfig)
-		if err != nil {
-			log.Fatal(err)
-			return
-		}
-		defer cli.Close()
-		watcher := clientv3.NewWatcher(cli)
-		watchch := watcher.Watch(context.Background(), picker.serviceName, clientv3.WithPrefix())
-		for {
-			a := <-watchch
-			go func() {
-				picker.mu.Lock()
-				defer picker.mu.Unlock()
-				for _, x := range a.Events {
-					key := string(x.Kv.Key)
-					idx := strings.Index(key, picker.serviceName)
-					addr := key[idx+len(picker.serviceName)+1:]
-					if addr == picker.self {
-						continue
-					}
-					if x.IsCreate() {
-						if _, ok := picker.clients[addr]; !ok {
-							picker.set(addr)
-						}
-					} else if x.Type == clientv3.EventTypeDelete {
-						if _, ok := picker.clients[addr]; ok {
-							picker.remove(addr)
-						}
-					}
-				}
-			}()
-		}
-	}()
-
-	//全量更新
-	go func() {
-		picker.mu.Lock()
-		cli, err := clientv3.New(*register_node.GlobalClientConfig)
-		if err != nil {
-			log.Fatal(err)
-			return
-		}
-		defer cli.Close()
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-		resp, err := cli.Get(ctx, picker.serviceName, clientv3.WithPrefix())
-		if err != nil {
-			log.Panic("[Event] full copy request failed")
-		}
-		kvs := resp.OpResponse().Get().Kvs
-		defer picker.mu.Unlock()
-		for _, kv := range kvs {
-			key := string(kv.Key)
-			idx := strings.Index(key, picker.serviceName)
-			addr := key[idx+len(picker.serviceName)+1:]
-
-			if _, ok := picker.clients[addr]; !ok {
-				picker.set(addr)
-			}
-		}
-	}()
-
-	return &picker
-
+// PeerWriter 定义了修改远端缓存的能力
+// Group.Set/Remove/Invalidate 通过它把写操作路由到owner节点
+type PeerWriter interface {
+	Set(ctx context.Context, group string, key string, value ByteView) error
+	Delete(ctx context.Context, group string, key string, hotOnly bool) error
 }
-func (p *ClientPicker) set(addr string) {
-	p.consHash.Register(addr)
-	p.clients[addr] = NewClient(addr, p.serviceName)
+
+// PeerLister 定义了列出所有远端节点(不包括自己)的能力
+// 用于广播清理各节点hotCache中的副本
+type PeerLister interface {
+	ListPeers() []Fetcher
 }
-func (p *ClientPicker) remove(addr string) {
-	p.consHash.Remove(addr)
-	delete(p.clients, addr)
+
+// ReplicaPicker 定义了为key选出副本节点的能力
+// 返回owner之后的副本节点(不包括自己) 最多n-1个 按接管的先后排列
+type ReplicaPicker interface {
+	PickReplicas(key string, n int) []Fetcher
 }
 
-type PickerOptions func(picker *ClientPicker)
-*/
+// Hedger 是Fetcher的可选接口 返回向副本发出对冲请求前应等待的时长
+// 返回false表示不对冲
+type Hedger interface {
+	HedgeDelay() (time.Duration, bool)
+}
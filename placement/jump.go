@@ -0,0 +1,74 @@
+package placement
+
+import "sort"
+
+// JumpHash jump consistent hash(Lamping & Veach)
+// 不占用额外内存 分布非常均匀 Get的复杂度为O(log n)
+// jump hash只能把key映射到编号[0,n) 这里按节点名排序后编号 保证所有节点得到相同的结果
+// 因此只有在末尾加入或移除节点时迁移量最小 在中间加入节点会迁移更多的key
+type JumpHash struct {
+	hash  Hash64
+	nodes []string // sorted
+}
+
+func NewJump(fn Hash64) *JumpHash {
+	if fn == nil {
+		fn = fnv64a
+	}
+	return &JumpHash{hash: fn}
+}
+
+func (j *JumpHash) Register(nodes ...string) {
+	for _, node := range nodes {
+		i := sort.SearchStrings(j.nodes, node)
+		if i < len(j.nodes) && j.nodes[i] == node {
+			continue
+		}
+		j.nodes = append(j.nodes, "")
+		copy(j.nodes[i+1:], j.nodes[i:])
+		j.nodes[i] = node
+	}
+}
+
+func (j *JumpHash) Remove(nodes ...string) {
+	for _, node := range nodes {
+		i := sort.SearchStrings(j.nodes, node)
+		if i < len(j.nodes) && j.nodes[i] == node {
+			j.nodes = append(j.nodes[:i], j.nodes[i+1:]...)
+		}
+	}
+}
+
+func (j *JumpHash) Get(key string) string {
+	if len(j.nodes) == 0 {
+		return ""
+	}
+	return j.nodes[jump(j.hash([]byte(key)), len(j.nodes))]
+}
+
+// jump 将key映射到[0,buckets)
+func jump(key uint64, buckets int) int {
+	var b, i int64 = -1, 0
+	for i < int64(buckets) {
+		b = i
+		key = key*2862933555777941757 + 1
+		i = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
+
+// GetN 返回编号从Get的结果开始依次递增的n个节点
+func (j *JumpHash) GetN(key string, n int) []string {
+	if n > len(j.nodes) {
+		n = len(j.nodes)
+	}
+	if n <= 0 {
+		return nil
+	}
+	b := jump(j.hash([]byte(key)), len(j.nodes))
+	nodes := make([]string, n)
+	for i := range nodes {
+		nodes[i] = j.nodes[(b+i)%len(j.nodes)]
+	}
+	return nodes
+}
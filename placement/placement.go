@@ -0,0 +1,94 @@
+package placement
+
+import (
+	"GeeCache/geecache/consistenthash"
+	"hash/fnv"
+)
+
+// placement 包定义了key放置算法的统一接口
+// geecache 的 server 只依赖 Placer 因此可以按部署选择放置算法
+// consistenthash.Map 本身就满足该接口 这里额外提供 rendezvous(HRW) 与 jump hash 的实现
+//
+// Warning: 与consistenthash包一样 所有实现都不提供并发保护 由调用方加锁
+
+type Placer interface {
+	// Register 加入节点 已存在的节点会被忽略
+	Register(nodes ...string)
+	// Remove 移除节点 不存在的节点会被忽略
+	Remove(nodes ...string)
+	// Get 返回key所属的节点 没有节点时返回空字符串
+	Get(key string) string
+}
+
+// ReplicaPlacer 是Placer的可选接口 为key选出多个不同的节点用于复制
+// 所有内置实现都满足该接口 第一个节点与Get的结果相同 节点数不足n时返回所有节点
+type ReplicaPlacer interface {
+	GetN(key string, n int) []string
+}
+
+// WeightedPlacer 是Placer的可选接口 权重越大的节点分到的key越多
+// 已存在的节点会以新的权重重新注册 consistenthash.Map满足该接口
+type WeightedPlacer interface {
+	RegisterWeighted(node string, weight int)
+}
+
+// LoadTracker 是Placer的可选接口 用于有界负载 Get会避开负载过高的节点
+// 调用方在向节点发出请求前调用Inc 请求结束后调用Done
+// geecache的server会在每个rpc前后调用 使用BoundedRing时无需手动调用
+type LoadTracker interface {
+	Inc(node string)
+	Done(node string)
+}
+
+// Factory 创建一个空的 Placer
+type Factory func() Placer
+
+// Hash64 64位散列函数 rendezvous与jump hash需要比crc32更宽的散列值
+type Hash64 func(data []byte) uint64
+
+// Ring 返回每个节点有replicas个虚拟节点的一致性哈希环工厂
+func Ring(replicas int) Factory {
+	return func() Placer {
+		return consistenthash.New(replicas, nil)
+	}
+}
+
+// BoundedRing 返回开启有界负载的一致性哈希环工厂
+// 每个节点的负载不超过(1+epsilon)倍的平均负载 超过时key溢出到环上的下一个节点
+func BoundedRing(replicas int, epsilon float64) Factory {
+	return func() Placer {
+		return consistenthash.New(replicas, nil, consistenthash.WithBoundedLoad(epsilon))
+	}
+}
+
+func Rendezvous() Placer {
+	return NewRendezvous(nil)
+}
+
+func Jump() Placer {
+	return NewJump(nil)
+}
+
+// fnv64a 默认的64位散列函数
+func fnv64a(data []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(data)
+	return h.Sum64()
+}
+
+// mix splitmix64的终结步骤 使相近的输入得到分散的输出
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+var _ Placer = (*consistenthash.Map)(nil)
+var _ ReplicaPlacer = (*consistenthash.Map)(nil)
+var _ WeightedPlacer = (*consistenthash.Map)(nil)
+var _ LoadTracker = (*consistenthash.Map)(nil)
+var _ ReplicaPlacer = (*HRW)(nil)
+var _ ReplicaPlacer = (*JumpHash)(nil)
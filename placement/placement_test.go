@@ -0,0 +1,206 @@
+package placement
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+var factories = map[string]Factory{
+	"ring":       Ring(50),
+	"bounded":    BoundedRing(50, 0.25),
+	"rendezvous": Rendezvous,
+	"jump":       Jump,
+}
+
+func nodes(n int) []string {
+	list := make([]string, n)
+	for i := range list {
+		list[i] = "10.0.0." + strconv.Itoa(i+1) + ":6324"
+	}
+	return list
+}
+
+// owners 记录n个key所属的节点
+func owners(p Placer, n int) []string {
+	list := make([]string, n)
+	for i := range list {
+		list[i] = p.Get("key" + strconv.Itoa(i))
+	}
+	return list
+}
+
+// 所有Placer都必须满足的行为
+func TestConformance(t *testing.T) {
+	for name, factory := range factories {
+		t.Run(name, func(t *testing.T) {
+			p := factory()
+			if p.Get("key") != "" {
+				t.Fatal("empty placer should return no node")
+			}
+			p.Register(nodes(5)...)
+			p.Register(nodes(5)...) // 重复注册不影响结果
+			before := owners(p, 1000)
+
+			// 与注册顺序无关 保证所有节点得到相同的结果
+			q := factory()
+			list := nodes(5)
+			for i := len(list) - 1; i >= 0; i-- {
+				q.Register(list[i])
+			}
+			for i, owner := range owners(q, 1000) {
+				if owner != before[i] {
+					t.Fatalf("key%d: %s vs %s, placement depends on register order", i, owner, before[i])
+				}
+			}
+
+			removed := list[2]
+			p.Remove(removed, "unknown")
+			for i, owner := range owners(p, 1000) {
+				if owner == removed {
+					t.Fatalf("key%d still on removed node", i)
+				}
+				if owner == "" {
+					t.Fatalf("key%d has no owner", i)
+				}
+			}
+			p.Register(removed)
+			for i, owner := range owners(p, 1000) {
+				if owner != before[i] {
+					t.Fatalf("key%d: %s vs %s after re-register", i, owner, before[i])
+				}
+			}
+		})
+	}
+}
+
+func TestGetN(t *testing.T) {
+	for name, factory := range factories {
+		t.Run(name, func(t *testing.T) {
+			p := factory()
+			p.Register(nodes(5)...)
+			r := p.(ReplicaPlacer)
+			for i := 0; i < 1000; i++ {
+				key := "key" + strconv.Itoa(i)
+				replicas := r.GetN(key, 3)
+				if len(replicas) != 3 || replicas[0] != p.Get(key) {
+					t.Fatalf("%s: unexpected replicas %v", key, replicas)
+				}
+				seen := make(map[string]bool)
+				for _, node := range replicas {
+					if seen[node] {
+						t.Fatalf("%s: replicas should be distinct, got %v", key, replicas)
+					}
+					seen[node] = true
+				}
+			}
+			if got := r.GetN("key", 10); len(got) != 5 {
+				t.Fatalf("expect all 5 nodes, got %v", got)
+			}
+		})
+	}
+}
+
+// balance 返回最大负载与平均负载之比
+func balance(p Placer, nodes, keys int) float64 {
+	counts := make(map[string]int)
+	for _, owner := range owners(p, keys) {
+		counts[owner]++
+	}
+	max := 0
+	for _, c := range counts {
+		if c > max {
+			max = c
+		}
+	}
+	return float64(max) / (float64(keys) / float64(nodes))
+}
+
+// remapped 返回加入一个节点后改变owner的key的比例 以及是否所有迁移的key都去了新节点
+func remapped(factory Factory, n, keys int) (float64, bool) {
+	const joined = "10.0.1.1:6324" // 排序后位于末尾
+	p := factory()
+	p.Register(nodes(n)...)
+	before := owners(p, keys)
+	p.Register(joined)
+	moved, minimal := 0, true
+	for i, owner := range owners(p, keys) {
+		if owner != before[i] {
+			moved++
+			minimal = minimal && owner == joined
+		}
+	}
+	return float64(moved) / float64(keys), minimal
+}
+
+func TestBalance(t *testing.T) {
+	const n, keys = 10, 100000
+	for name, limit := range map[string]float64{"rendezvous": 1.05, "jump": 1.05} {
+		p := factories[name]()
+		p.Register(nodes(n)...)
+		if got := balance(p, n, keys); got > limit {
+			t.Fatalf("%s: max/avg load %.3f exceeds %.2f", name, got, limit)
+		}
+	}
+}
+
+func TestRemap(t *testing.T) {
+	const n, keys = 10, 100000
+	ideal := 1.0 / (n + 1)
+	for name, factory := range factories {
+		got, minimal := remapped(factory, n, keys)
+		if !minimal {
+			t.Fatalf("%s: keys moved between existing nodes", name)
+		}
+		// crc32与50个虚拟节点的环分布不均 只检查rendezvous与jump的迁移比例
+		if name != "ring" && name != "bounded" && math.Abs(got-ideal) > 0.02 {
+			t.Fatalf("%s: %.3f of keys moved, expect ~%.3f", name, got, ideal)
+		}
+	}
+}
+
+func BenchmarkGet(b *testing.B) {
+	for name, factory := range factories {
+		for _, n := range []int{10, 100} {
+			p := factory()
+			p.Register(nodes(n)...)
+			keys := make([]string, 1024)
+			for i := range keys {
+				keys[i] = "key" + strconv.Itoa(i)
+			}
+			b.Run(name+"/"+strconv.Itoa(n), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					p.Get(keys[i%len(keys)])
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkBalance 报告最大负载与平均负载之比 越接近1越均匀
+func BenchmarkBalance(b *testing.B) {
+	for name, factory := range factories {
+		b.Run(name, func(b *testing.B) {
+			var ratio float64
+			for i := 0; i < b.N; i++ {
+				p := factory()
+				p.Register(nodes(10)...)
+				ratio = balance(p, 10, 10000)
+			}
+			b.ReportMetric(ratio, "max/avg")
+		})
+	}
+}
+
+// BenchmarkRemap 报告加入一个节点后迁移的key的比例 理想值为1/(n+1)
+func BenchmarkRemap(b *testing.B) {
+	for name, factory := range factories {
+		b.Run(name, func(b *testing.B) {
+			var fraction float64
+			for i := 0; i < b.N; i++ {
+				fraction, _ = remapped(factory, 10, 10000)
+			}
+			b.ReportMetric(fraction, "moved")
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package placement
+
+import (
+	"slices"
+	"sort"
+)
+
+// HRW rendezvous hashing(Highest Random Weight)
+// 对每个节点计算 score(node, key) 分数最高的节点拥有key
+// 节点变化时只有属于变化节点的key会被重新分配 且不需要维护哈希环
+// Get的复杂度为O(n) 适合节点数不多的集群
+type HRW struct {
+	hash  Hash64
+	nodes []string          // sorted
+	seeds map[string]uint64 // 节点 -> 节点名的散列值
+}
+
+func NewRendezvous(fn Hash64) *HRW {
+	if fn == nil {
+		fn = fnv64a
+	}
+	return &HRW{
+		hash:  fn,
+		seeds: make(map[string]uint64),
+	}
+}
+
+func (r *HRW) Register(nodes ...string) {
+	for _, node := range nodes {
+		if _, ok := r.seeds[node]; ok {
+			continue
+		}
+		r.seeds[node] = r.hash([]byte(node))
+		r.nodes = append(r.nodes, node)
+	}
+	sort.Strings(r.nodes)
+}
+
+func (r *HRW) Remove(nodes ...string) {
+	for _, node := range nodes {
+		if _, ok := r.seeds[node]; !ok {
+			continue
+		}
+		delete(r.seeds, node)
+		i := sort.SearchStrings(r.nodes, node)
+		r.nodes = append(r.nodes[:i], r.nodes[i+1:]...)
+	}
+}
+
+func (r *HRW) Get(key string) string {
+	h := r.hash([]byte(key))
+	var (
+		owner string
+		best  uint64
+	)
+	// nodes有序 分数相同时总是选择名字较小的节点
+	for _, node := range r.nodes {
+		if score := mix(h ^ r.seeds[node]); owner == "" || score > best {
+			owner, best = node, score
+		}
+	}
+	return owner
+}
+
+// GetN 返回分数最高的n个节点 某个节点移除后 它的key由分数第二高的节点接管
+func (r *HRW) GetN(key string, n int) []string {
+	if n > len(r.nodes) {
+		n = len(r.nodes)
+	}
+	if n <= 0 {
+		return nil
+	}
+	h := r.hash([]byte(key))
+	scores := make(map[string]uint64, len(r.nodes))
+	nodes := slices.Clone(r.nodes) // 已按名字排序 稳定排序保证分数相同时顺序与Get一致
+	for _, node := range nodes {
+		scores[node] = mix(h ^ r.seeds[node])
+	}
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return scores[nodes[i]] > scores[nodes[j]]
+	})
+	return nodes[:n]
+}
@@ -0,0 +1,217 @@
+package policy
+
+import "container/list"
+
+// ARC：自适应替换缓存(Megiddo & Modha)
+// t1保存只访问过一次的key t2保存至少访问过两次的key 均为LRU
+// b1/b2是t1/t2的幽灵队列 只记录被淘汰的key
+// 命中b1说明t1太小 增大目标值p 命中b2说明t2太小 减小p
+// 这里按字节而不是按条目计算容量 c=maxBytes 幽灵队列记录被淘汰key的大小
+
+type arcEntry struct {
+	key   string
+	value Value
+	ll    *list.List // 所在的队列 t1或t2
+}
+
+type arcGhost struct {
+	key  string
+	size int
+	ll   *list.List // 所在的队列 b1或b2
+}
+
+type ARCCache struct {
+	maxBytes  int
+	p         int // t1的目标大小
+	cache     map[string]*list.Element
+	ghosts    map[string]*list.Element
+	t1, t2    *list.List // 队头最久未访问
+	b1, b2    *list.List
+	sizes     map[*list.List]int // 各队列占用的字节数
+	onEvicted func(key string, value Value)
+	expiry
+}
+
+func NewARC(maxBytes int, onEvicted func(string, Value)) *ARCCache {
+	c := &ARCCache{
+		maxBytes:  maxBytes,
+		cache:     make(map[string]*list.Element),
+		ghosts:    make(map[string]*list.Element),
+		t1:        list.New(),
+		t2:        list.New(),
+		b1:        list.New(),
+		b2:        list.New(),
+		sizes:     make(map[*list.List]int, 4),
+		onEvicted: onEvicted,
+		expiry:    newExpiry(),
+	}
+	return c
+}
+
+func (c *ARCCache) Get(key string) (value Value, ok bool) {
+	e, ok := c.cache[key]
+	if !ok {
+		return nil, false
+	}
+	ent := e.Value.(*arcEntry)
+	if isExpired(ent.value) {
+		c.removeElement(e)
+		return nil, false
+	}
+	c.moveTo(e, c.t2)
+	return ent.value, true
+}
+
+// moveTo 将e移动到ll的队尾(MRU)
+func (c *ARCCache) moveTo(e *list.Element, ll *list.List) {
+	ent := e.Value.(*arcEntry)
+	if ent.ll == ll {
+		ll.MoveToBack(e)
+		return
+	}
+	size := len(ent.key) + ent.value.Len()
+	ent.ll.Remove(e)
+	c.sizes[ent.ll] -= size
+	ent.ll = ll
+	c.cache[ent.key] = ll.PushBack(ent)
+	c.sizes[ll] += size
+}
+
+func (c *ARCCache) Add(key string, value Value) {
+	if e, ok := c.cache[key]; ok {
+		ent := e.Value.(*arcEntry)
+		c.sizes[ent.ll] += value.Len() - ent.value.Len()
+		ent.value = value
+		c.moveTo(e, c.t2)
+		c.track(key, value)
+		c.replace(false)
+		return
+	}
+
+	size := len(key) + value.Len()
+	ent := &arcEntry{key: key, value: value, ll: c.t1}
+	hitB2 := false
+	if e, ok := c.ghosts[key]; ok {
+		g := e.Value.(*arcGhost)
+		b1, b2 := c.sizes[c.b1], c.sizes[c.b2]
+		if g.ll == c.b1 {
+			// 命中b1 增大p
+			c.p = min(c.maxBytes, c.p+size*max(1, b2/max(b1, 1)))
+		} else {
+			// 命中b2 减小p
+			c.p = max(0, c.p-size*max(1, b1/max(b2, 1)))
+			hitB2 = true
+		}
+		c.removeGhost(e)
+		ent.ll = c.t2
+	}
+	c.cache[key] = ent.ll.PushBack(ent)
+	c.sizes[ent.ll] += size
+	c.track(key, value)
+
+	if c.maxBytes != 0 {
+		c.RemoveExpired(removeExpireN)
+	}
+	c.replace(hitB2)
+}
+
+// replace 淘汰key直到不超过maxBytes 并限制幽灵队列的大小
+func (c *ARCCache) replace(hitB2 bool) {
+	if c.maxBytes == 0 {
+		return
+	}
+	for c.sizes[c.t1]+c.sizes[c.t2] > c.maxBytes {
+		if c.fromT1(hitB2) {
+			c.evict(c.t1.Front(), c.b1)
+		} else {
+			c.evict(c.t2.Front(), c.b2)
+		}
+	}
+	// |t1|+|b1| <= c, |t1|+|t2|+|b1|+|b2| <= 2c
+	for c.sizes[c.t1]+c.sizes[c.b1] > c.maxBytes && c.b1.Len() > 0 {
+		c.removeGhost(c.b1.Front())
+	}
+	for c.sizes[c.t1]+c.sizes[c.t2]+c.sizes[c.b1]+c.sizes[c.b2] > 2*c.maxBytes && c.b2.Len() > 0 {
+		c.removeGhost(c.b2.Front())
+	}
+}
+
+// fromT1 判断下一次应淘汰t1还是t2
+func (c *ARCCache) fromT1(hitB2 bool) bool {
+	t1 := c.sizes[c.t1]
+	return c.t1.Len() > 0 && (t1 > c.p || (hitB2 && t1 == c.p) || c.t2.Len() == 0)
+}
+
+// Victim 返回下一个将被淘汰的key
+func (c *ARCCache) Victim() (string, bool) {
+	e := c.t2.Front()
+	if c.fromT1(false) {
+		e = c.t1.Front()
+	}
+	if e == nil {
+		return "", false
+	}
+	return e.Value.(*arcEntry).key, true
+}
+
+// evict 淘汰e 并将其记入幽灵队列ghost
+func (c *ARCCache) evict(e *list.Element, ghost *list.List) {
+	ent := e.Value.(*arcEntry)
+	c.removeElement(e)
+	size := len(ent.key) + ent.value.Len()
+	c.ghosts[ent.key] = ghost.PushBack(&arcGhost{key: ent.key, size: size, ll: ghost})
+	c.sizes[ghost] += size
+}
+
+func (c *ARCCache) removeGhost(e *list.Element) {
+	g := e.Value.(*arcGhost)
+	g.ll.Remove(e)
+	c.sizes[g.ll] -= g.size
+	delete(c.ghosts, g.key)
+}
+
+// RemoveExpired 移除最多n个过期的键 返回移除的数量
+func (c *ARCCache) RemoveExpired(n int) int {
+	keys := c.expired(n)
+	for _, key := range keys {
+		c.Remove(key)
+	}
+	return len(keys)
+}
+
+func (c *ARCCache) removeElement(e *list.Element) {
+	ent := e.Value.(*arcEntry)
+	ent.ll.Remove(e)
+	c.sizes[ent.ll] -= len(ent.key) + ent.value.Len()
+	delete(c.cache, ent.key)
+	c.untrack(ent.key)
+	if c.onEvicted != nil {
+		c.onEvicted(ent.key, ent.value)
+	}
+}
+
+// Remove 移除某个键 同时忘记它的淘汰记录
+func (c *ARCCache) Remove(key string) {
+	if e, ok := c.cache[key]; ok {
+		c.removeElement(e)
+	}
+	if e, ok := c.ghosts[key]; ok {
+		c.removeGhost(e)
+	}
+}
+
+func (c *ARCCache) Range(fn func(key string, value Value) bool) {
+	for key, e := range c.cache {
+		if !fn(key, e.Value.(*arcEntry).value) {
+			return
+		}
+	}
+}
+
+func (c *ARCCache) Len() int {
+	return len(c.cache)
+}
+
+func (c *ARCCache) Bytes() int {
+	return c.sizes[c.t1] + c.sizes[c.t2]
+}
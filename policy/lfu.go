@@ -0,0 +1,126 @@
+package policy
+
+import "GeeCache/geecache/zset"
+
+// LFU：最不经常使用。用 zset 按访问次数排序 淘汰访问次数最少的key
+// 访问次数相同时按key的字典序淘汰
+
+const freqZSetKey = ""
+
+type lfuEntry struct {
+	key   string
+	value Value
+}
+
+type LFUCache struct {
+	maxBytes  int
+	nbytes    int
+	cache     map[string]*lfuEntry
+	freqs     *zset.SortedSet // member为key score为访问次数
+	onEvicted func(key string, value Value)
+	expiry
+}
+
+func NewLFU(maxBytes int, onEvicted func(string, Value)) *LFUCache {
+	return &LFUCache{
+		maxBytes:  maxBytes,
+		cache:     make(map[string]*lfuEntry),
+		freqs:     zset.New(),
+		onEvicted: onEvicted,
+		expiry:    newExpiry(),
+	}
+}
+
+func (c *LFUCache) Get(key string) (value Value, ok bool) {
+	ent, ok := c.cache[key]
+	if !ok {
+		return nil, false
+	}
+	if isExpired(ent.value) {
+		c.removeEntry(ent)
+		return nil, false
+	}
+	c.freqs.ZIncrBy(freqZSetKey, 1, key)
+	return ent.value, true
+}
+
+func (c *LFUCache) Add(key string, value Value) {
+	if ent, ok := c.cache[key]; ok {
+		c.nbytes += value.Len() - ent.value.Len()
+		ent.value = value
+		c.freqs.ZIncrBy(freqZSetKey, 1, key)
+	} else {
+		// 先腾出空间 避免访问次数为1的新key被立即淘汰
+		if c.maxBytes != 0 {
+			c.RemoveExpired(removeExpireN)
+		}
+		for c.maxBytes != 0 && c.nbytes+len(key)+value.Len() > c.maxBytes && len(c.cache) > 0 {
+			c.RemoveLeast()
+		}
+		c.cache[key] = &lfuEntry{key: key, value: value}
+		c.nbytes += len(key) + value.Len()
+		c.freqs.ZAdd(freqZSetKey, 1, key)
+	}
+	c.track(key, value)
+
+	for c.maxBytes != 0 && c.nbytes > c.maxBytes {
+		c.RemoveLeast()
+	}
+}
+
+// RemoveLeast 淘汰访问次数最少的key
+func (c *LFUCache) RemoveLeast() {
+	if key, ok := c.Victim(); ok {
+		c.Remove(key)
+	}
+}
+
+// Victim 返回访问次数最少的key
+func (c *LFUCache) Victim() (string, bool) {
+	values := c.freqs.ZRange(freqZSetKey, 0, 0)
+	if len(values) == 0 {
+		return "", false
+	}
+	return values[0].(string), true
+}
+
+// RemoveExpired 移除最多n个过期的键 返回移除的数量
+func (c *LFUCache) RemoveExpired(n int) int {
+	keys := c.expired(n)
+	for _, key := range keys {
+		c.Remove(key)
+	}
+	return len(keys)
+}
+
+func (c *LFUCache) removeEntry(ent *lfuEntry) {
+	delete(c.cache, ent.key)
+	c.nbytes -= len(ent.key) + ent.value.Len()
+	c.freqs.ZRem(freqZSetKey, ent.key)
+	c.untrack(ent.key)
+	if c.onEvicted != nil {
+		c.onEvicted(ent.key, ent.value)
+	}
+}
+
+func (c *LFUCache) Remove(key string) {
+	if ent, ok := c.cache[key]; ok {
+		c.removeEntry(ent)
+	}
+}
+
+func (c *LFUCache) Range(fn func(key string, value Value) bool) {
+	for key, ent := range c.cache {
+		if !fn(key, ent.value) {
+			return
+		}
+	}
+}
+
+func (c *LFUCache) Len() int {
+	return len(c.cache)
+}
+
+func (c *LFUCache) Bytes() int {
+	return c.nbytes
+}
@@ -0,0 +1,197 @@
+package policy
+
+import (
+	"GeeCache/geecache/zset"
+	"container/list"
+)
+
+// LRU-K：按第K次最近访问的时间淘汰 而不是最近一次访问的时间
+// 访问次数不足K次的key视为"倒数第K次访问"无穷远 会被优先淘汰(它们之间按LRU淘汰)
+// 因此一次性扫描进来的key无法挤掉被反复访问的热key
+// 被淘汰的key的访问历史会保留一段时间(最多与驻留的key一样多) 再次加入时恢复
+// 否则热key都达到K次访问后 新key在加入时就会被淘汰 永远无法积累到K次访问
+
+const (
+	defaultK         = 2
+	kthAccessZSetKey = ""
+)
+
+type lrukEntry struct {
+	key   string
+	value Value
+	times []int64       // 最近K次访问的逻辑时间 从旧到新
+	elem  *list.Element // 访问次数不足K次时位于history中
+}
+
+// lrukHistory 已淘汰的key的访问历史
+type lrukHistory struct {
+	key   string
+	times []int64
+}
+
+type LRUKCache struct {
+	maxBytes  int
+	nbytes    int
+	k         int
+	tick      int64 // 逻辑时钟 每次访问加一
+	cache     map[string]*lrukEntry
+	history   *list.List      // 访问次数不足K次的key 按最近访问时间排序
+	kth       *zset.SortedSet // 访问次数达到K次的key score为倒数第K次访问时间
+	retained  map[string]*list.Element
+	ghosts    *list.List // 已淘汰的key的访问历史 队头最早淘汰
+	onEvicted func(key string, value Value)
+	expiry
+}
+
+// NewLRUK k<=0时使用默认值2
+func NewLRUK(maxBytes int, k int, onEvicted func(string, Value)) *LRUKCache {
+	if k <= 0 {
+		k = defaultK
+	}
+	return &LRUKCache{
+		maxBytes:  maxBytes,
+		k:         k,
+		cache:     make(map[string]*lrukEntry),
+		history:   list.New(),
+		kth:       zset.New(),
+		retained:  make(map[string]*list.Element),
+		ghosts:    list.New(),
+		onEvicted: onEvicted,
+		expiry:    newExpiry(),
+	}
+}
+
+func (c *LRUKCache) Get(key string) (value Value, ok bool) {
+	ent, ok := c.cache[key]
+	if !ok {
+		return nil, false
+	}
+	if isExpired(ent.value) {
+		c.removeEntry(ent)
+		return nil, false
+	}
+	c.access(ent)
+	return ent.value, true
+}
+
+// access 记录一次访问 访问次数达到K次后从history移入kth
+func (c *LRUKCache) access(ent *lrukEntry) {
+	c.tick++
+	ent.times = append(ent.times, c.tick)
+	if len(ent.times) > c.k {
+		ent.times = ent.times[1:]
+	}
+	if len(ent.times) < c.k {
+		c.history.MoveToBack(ent.elem)
+		return
+	}
+	if ent.elem != nil {
+		c.history.Remove(ent.elem)
+		ent.elem = nil
+	}
+	c.kth.ZAdd(kthAccessZSetKey, ent.times[0], ent.key)
+}
+
+func (c *LRUKCache) Add(key string, value Value) {
+	if ent, ok := c.cache[key]; ok {
+		c.nbytes += value.Len() - ent.value.Len()
+		ent.value = value
+		c.access(ent)
+	} else {
+		ent := &lrukEntry{key: key, value: value}
+		if e, ok := c.retained[key]; ok {
+			ent.times = e.Value.(*lrukHistory).times
+			c.removeGhost(e)
+		}
+		ent.elem = c.history.PushBack(ent)
+		c.cache[key] = ent
+		c.nbytes += len(key) + value.Len()
+		c.access(ent)
+	}
+	c.track(key, value)
+
+	if c.maxBytes != 0 {
+		c.RemoveExpired(removeExpireN)
+	}
+	for c.maxBytes != 0 && c.nbytes > c.maxBytes {
+		c.RemoveOldest()
+	}
+}
+
+// RemoveOldest 优先淘汰访问次数不足K次的key 其次淘汰倒数第K次访问最早的key
+func (c *LRUKCache) RemoveOldest() {
+	if key, ok := c.Victim(); ok {
+		c.Remove(key)
+	}
+}
+
+// Victim 返回下一个将被淘汰的key 规则同RemoveOldest
+func (c *LRUKCache) Victim() (string, bool) {
+	if e := c.history.Front(); e != nil {
+		return e.Value.(*lrukEntry).key, true
+	}
+	values := c.kth.ZRange(kthAccessZSetKey, 0, 0)
+	if len(values) == 0 {
+		return "", false
+	}
+	return values[0].(string), true
+}
+
+// RemoveExpired 移除最多n个过期的键 返回移除的数量
+func (c *LRUKCache) RemoveExpired(n int) int {
+	keys := c.expired(n)
+	for _, key := range keys {
+		c.Remove(key)
+	}
+	return len(keys)
+}
+
+func (c *LRUKCache) removeEntry(ent *lrukEntry) {
+	if ent.elem != nil {
+		c.history.Remove(ent.elem)
+	} else {
+		c.kth.ZRem(kthAccessZSetKey, ent.key)
+	}
+	delete(c.cache, ent.key)
+	c.nbytes -= len(ent.key) + ent.value.Len()
+	c.untrack(ent.key)
+	c.addGhost(ent.key, ent.times)
+	if c.onEvicted != nil {
+		c.onEvicted(ent.key, ent.value)
+	}
+}
+
+// addGhost 保留被淘汰的key的访问历史 最多与驻留的key一样多(至少一个)
+func (c *LRUKCache) addGhost(key string, times []int64) {
+	c.retained[key] = c.ghosts.PushBack(&lrukHistory{key: key, times: times})
+	for c.ghosts.Len() > 1 && c.ghosts.Len() > len(c.cache) {
+		c.removeGhost(c.ghosts.Front())
+	}
+}
+
+func (c *LRUKCache) removeGhost(e *list.Element) {
+	c.ghosts.Remove(e)
+	delete(c.retained, e.Value.(*lrukHistory).key)
+}
+
+func (c *LRUKCache) Remove(key string) {
+	if ent, ok := c.cache[key]; ok {
+		c.removeEntry(ent)
+	}
+}
+
+func (c *LRUKCache) Range(fn func(key string, value Value) bool) {
+	for key, ent := range c.cache {
+		if !fn(key, ent.value) {
+			return
+		}
+	}
+}
+
+func (c *LRUKCache) Len() int {
+	return len(c.cache)
+}
+
+func (c *LRUKCache) Bytes() int {
+	return c.nbytes
+}
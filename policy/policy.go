@@ -0,0 +1,138 @@
+package policy
+
+import (
+	"GeeCache/geecache/lru"
+	"GeeCache/geecache/zset"
+	"time"
+)
+
+// policy 包定义了缓存淘汰算法的统一接口
+// geecache 的 cache 只依赖 Policy 因此可以按 Group 切换淘汰算法
+// lru.Cache 本身就满足该接口 这里额外提供 LFU / LRU-K / 2Q / ARC 的实现
+//
+// Warning: 与lru包一样 所有实现都不提供并发一致机制
+
+// Value 与 lru.Value 相同 使 lru.Cache 可以直接作为 Policy 使用
+type Value = lru.Value
+
+type Policy interface {
+	Add(key string, value Value)
+	Get(key string) (value Value, ok bool)
+	Remove(key string)
+	Len() int
+	// Bytes 返回已使用的内存
+	Bytes() int
+}
+
+// Victimer 是Policy的可选接口 报告下一个将被淘汰的key
+// 准入过滤器(如tinylfu)用它判断新key是否值得替换掉这个victim
+type Victimer interface {
+	Victim() (key string, ok bool)
+}
+
+// Expirer 是Policy的可选接口 主动移除过期键
+// 所有内置实现都满足该接口 geecache的后台清理协程依赖它
+type Expirer interface {
+	// RemoveExpired 移除最多n个过期的键 返回移除的数量
+	RemoveExpired(n int) int
+}
+
+// Ranger 是Policy的可选接口 遍历所有键值 不改变淘汰顺序
+// 所有内置实现都满足该接口 哈希环变化时geecache用它找出需要迁移给新owner的key
+type Ranger interface {
+	// Range 对每个键值调用fn 直到fn返回false 遍历过程中不能修改Policy
+	Range(fn func(key string, value Value) bool)
+}
+
+// Factory 根据最大内存与淘汰回调创建 Policy
+// maxBytes 为0表示不限制内存
+type Factory func(maxBytes int, onEvicted func(key string, value Value)) Policy
+
+func LRU(maxBytes int, onEvicted func(key string, value Value)) Policy {
+	return lru.New(maxBytes, onEvicted)
+}
+
+func LFU(maxBytes int, onEvicted func(key string, value Value)) Policy {
+	return NewLFU(maxBytes, onEvicted)
+}
+
+// LRUK 返回K次访问阈值为k的 LRU-K 工厂
+func LRUK(k int) Factory {
+	return func(maxBytes int, onEvicted func(key string, value Value)) Policy {
+		return NewLRUK(maxBytes, k, onEvicted)
+	}
+}
+
+func TwoQ(maxBytes int, onEvicted func(key string, value Value)) Policy {
+	return NewTwoQ(maxBytes, onEvicted)
+}
+
+func ARC(maxBytes int, onEvicted func(key string, value Value)) Policy {
+	return NewARC(maxBytes, onEvicted)
+}
+
+const (
+	expiresZSetKey = ""
+	// 每次Add时移除过期键的数量 与lru保持一致
+	removeExpireN = 10
+)
+
+// expiry 用 zset 按过期时间记录key 供各实现淘汰过期键
+type expiry struct {
+	expires *zset.SortedSet
+}
+
+func newExpiry() expiry {
+	return expiry{expires: zset.New()}
+}
+
+// track 记录value的过期时间 没有过期时间则删除记录
+func (e expiry) track(key string, value Value) {
+	if !value.Expire().IsZero() {
+		e.expires.ZAdd(expiresZSetKey, value.Expire().UnixNano(), key)
+	} else {
+		e.expires.ZRem(expiresZSetKey, key)
+	}
+}
+
+func (e expiry) untrack(key string) {
+	e.expires.ZRem(expiresZSetKey, key)
+}
+
+// expired 返回最多n个已经过期的key
+func (e expiry) expired(n int) []string {
+	var keys []string
+	now := time.Now().UnixNano()
+	values := e.expires.ZRangeWithScores(expiresZSetKey, 0, n-1)
+	for i := 0; i+1 < len(values); i += 2 {
+		if values[i+1].(int64) > now {
+			break
+		}
+		keys = append(keys, values[i].(string))
+	}
+	return keys
+}
+
+func isExpired(value Value) bool {
+	return !value.Expire().IsZero() && value.Expire().Before(time.Now())
+}
+
+var (
+	_ Expirer = (*lru.Cache)(nil)
+	_ Expirer = (*LFUCache)(nil)
+	_ Expirer = (*LRUKCache)(nil)
+	_ Expirer = (*TwoQCache)(nil)
+	_ Expirer = (*ARCCache)(nil)
+
+	_ Victimer = (*lru.Cache)(nil)
+	_ Victimer = (*LFUCache)(nil)
+	_ Victimer = (*LRUKCache)(nil)
+	_ Victimer = (*TwoQCache)(nil)
+	_ Victimer = (*ARCCache)(nil)
+
+	_ Policy = (*lru.Cache)(nil)
+	_ Policy = (*LFUCache)(nil)
+	_ Policy = (*LRUKCache)(nil)
+	_ Policy = (*TwoQCache)(nil)
+	_ Policy = (*ARCCache)(nil)
+)
@@ -0,0 +1,289 @@
+package policy
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+func (d String) Expire() time.Time {
+	return time.Time{}
+}
+
+type expiring struct {
+	String
+	expire time.Time
+}
+
+func (e expiring) Expire() time.Time {
+	return e.expire
+}
+
+var factories = map[string]Factory{
+	"lru":  LRU,
+	"lfu":  LFU,
+	"lru2": LRUK(2),
+	"2q":   TwoQ,
+	"arc":  ARC,
+}
+
+// 所有Policy都必须满足的行为
+func TestConformance(t *testing.T) {
+	for name, factory := range factories {
+		t.Run(name, func(t *testing.T) {
+			t.Run("get", func(t *testing.T) { testGet(t, factory) })
+			t.Run("update", func(t *testing.T) { testUpdate(t, factory) })
+			t.Run("remove", func(t *testing.T) { testRemove(t, factory) })
+			t.Run("maxBytes", func(t *testing.T) { testMaxBytes(t, factory) })
+			t.Run("expire", func(t *testing.T) { testExpire(t, factory) })
+			t.Run("removeExpired", func(t *testing.T) { testRemoveExpired(t, factory) })
+			t.Run("range", func(t *testing.T) { testRange(t, factory) })
+			t.Run("admission", func(t *testing.T) { testAdmission(t, factory) })
+		})
+	}
+}
+
+func testGet(t *testing.T, factory Factory) {
+	p := factory(0, nil)
+	p.Add("key1", String("1234"))
+	if v, ok := p.Get("key1"); !ok || string(v.(String)) != "1234" {
+		t.Fatal("cache hit key1 = 1234 failed")
+	}
+	if _, ok := p.Get("key2"); ok {
+		t.Fatal("cache miss key2 failed")
+	}
+}
+
+func testUpdate(t *testing.T, factory Factory) {
+	p := factory(0, nil)
+	p.Add("key1", String("1234"))
+	p.Add("key1", String("123456"))
+	if v, ok := p.Get("key1"); !ok || string(v.(String)) != "123456" {
+		t.Fatal("update key1 failed")
+	}
+	if p.Len() != 1 || p.Bytes() != len("key1")+len("123456") {
+		t.Fatalf("expect 1 entry with %d bytes, got %d/%d", len("key1")+len("123456"), p.Len(), p.Bytes())
+	}
+}
+
+func testRemove(t *testing.T, factory Factory) {
+	var evicted []string
+	p := factory(0, func(key string, value Value) {
+		evicted = append(evicted, key)
+	})
+	p.Add("key1", String("1234"))
+	p.Add("key2", String("1234"))
+	p.Remove("key1")
+	p.Remove("unknown")
+	if _, ok := p.Get("key1"); ok || p.Len() != 1 || p.Bytes() != len("key2")+len("1234") {
+		t.Fatal("remove key1 failed")
+	}
+	if len(evicted) != 1 || evicted[0] != "key1" {
+		t.Fatalf("onEvicted should be called for key1, got %v", evicted)
+	}
+}
+
+func testMaxBytes(t *testing.T, factory Factory) {
+	const maxBytes = 100
+	evicted := 0
+	p := factory(maxBytes, func(key string, value Value) {
+		evicted++
+	})
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key%d", i%30)
+		p.Add(key, String("value"))
+		p.Get(fmt.Sprintf("key%d", i%7))
+		if p.Bytes() > maxBytes {
+			t.Fatalf("used %d bytes, exceeds %d", p.Bytes(), maxBytes)
+		}
+	}
+	if evicted == 0 {
+		t.Fatal("onEvicted should be called")
+	}
+	if p.Len() == 0 {
+		t.Fatal("cache should not be emptied")
+	}
+}
+
+func testExpire(t *testing.T, factory Factory) {
+	p := factory(0, nil)
+	p.Add("key1", expiring{String("1234"), time.Now().Add(-time.Second)})
+	p.Add("key2", expiring{String("1234"), time.Now().Add(time.Hour)})
+	if _, ok := p.Get("key1"); ok {
+		t.Fatal("expired key1 should miss")
+	}
+	if _, ok := p.Get("key2"); !ok {
+		t.Fatal("key2 should hit")
+	}
+	if p.Len() != 1 {
+		t.Fatalf("expired key1 should be removed, len=%d", p.Len())
+	}
+}
+
+func testRemoveExpired(t *testing.T, factory Factory) {
+	p := factory(0, nil)
+	for _, k := range []string{"k1", "k2", "k3"} {
+		p.Add(k, expiring{String(k), time.Now().Add(-time.Second)})
+	}
+	p.Add("k4", String("k4"))
+	e, ok := p.(Expirer)
+	if !ok {
+		t.Fatal("policy should implement Expirer")
+	}
+	if n := e.RemoveExpired(2); n != 2 || p.Len() != 2 {
+		t.Fatalf("expect 2 removed and 2 left, got %d/%d", n, p.Len())
+	}
+	if n := e.RemoveExpired(10); n != 1 || p.Len() != 1 {
+		t.Fatalf("expect 1 removed and 1 left, got %d/%d", n, p.Len())
+	}
+}
+
+func testRange(t *testing.T, factory Factory) {
+	p := factory(0, nil)
+	for _, k := range []string{"k1", "k2", "k3"} {
+		p.Add(k, String(k))
+	}
+	r, ok := p.(Ranger)
+	if !ok {
+		t.Fatal("policy should implement Ranger")
+	}
+	seen := make(map[string]bool)
+	r.Range(func(key string, value Value) bool {
+		if string(value.(String)) != key {
+			t.Fatalf("unexpected value %v for %s", value, key)
+		}
+		seen[key] = true
+		return true
+	})
+	if len(seen) != 3 {
+		t.Fatalf("expect 3 keys, got %v", seen)
+	}
+	n := 0
+	r.Range(func(key string, value Value) bool {
+		n++
+		return false
+	})
+	if n != 1 {
+		t.Fatalf("range should stop when fn returns false, got %d calls", n)
+	}
+}
+
+// 缓存已满且所有key都被访问过多次时 反复加入的新key最终也能被接纳
+func testAdmission(t *testing.T, factory Factory) {
+	p := factory(len("hot0value")*10, nil)
+	for i := 0; i < 10; i++ {
+		p.Add(fmt.Sprintf("hot%d", i), String("value"))
+	}
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 10; i++ {
+			p.Get(fmt.Sprintf("hot%d", i))
+		}
+	}
+	for i := 0; i < 100; i++ {
+		if _, ok := p.Get("new"); ok {
+			return
+		}
+		p.Add("new", String("value"))
+	}
+	t.Fatal("new key is never admitted")
+}
+
+// 扫描抵抗: 被反复访问的热key不应被一次性扫描冲刷掉
+func TestScanResistance(t *testing.T) {
+	for _, name := range []string{"lfu", "lru2", "2q", "arc"} {
+		t.Run(name, func(t *testing.T) {
+			p := factories[name](200, nil)
+			getOrAdd := func(key string) {
+				if _, ok := p.Get(key); !ok {
+					p.Add(key, String("value"))
+				}
+			}
+			// 预热: 热key被反复访问 期间夹杂着只访问一次的key
+			for round := 0; round < 10; round++ {
+				for i := 0; i < 5; i++ {
+					getOrAdd(fmt.Sprintf("hot%d", i))
+				}
+				for i := 0; i < 5; i++ {
+					getOrAdd(fmt.Sprintf("once%d-%d", round, i))
+				}
+			}
+			for i := 0; i < 100; i++ {
+				getOrAdd(fmt.Sprintf("scan%d", i))
+			}
+			for i := 0; i < 5; i++ {
+				if _, ok := p.Get(fmt.Sprintf("hot%d", i)); !ok {
+					t.Fatalf("hot%d was flushed by scan", i)
+				}
+			}
+		})
+	}
+}
+
+func TestLFURemoveLeast(t *testing.T) {
+	p := NewLFU(len("k1v1k2v2"), nil)
+	p.Add("k1", String("v1"))
+	p.Add("k2", String("v2"))
+	p.Get("k1")
+	p.Add("k3", String("v3"))
+	if _, ok := p.Get("k2"); ok {
+		t.Fatal("least frequently used k2 should be evicted")
+	}
+	if _, ok := p.Get("k1"); !ok {
+		t.Fatal("k1 should stay")
+	}
+}
+
+func TestLRUKRemoveOldest(t *testing.T) {
+	p := NewLRUK(len("k1v1k2v2"), 2, nil)
+	p.Add("k1", String("v1"))
+	p.Get("k1") // k1访问两次
+	p.Add("k2", String("v2"))
+	p.Add("k3", String("v3")) // 淘汰只访问过一次的k2 而不是最久未访问的k1
+	if _, ok := p.Get("k2"); ok {
+		t.Fatal("k2 with less than K accesses should be evicted first")
+	}
+	if _, ok := p.Get("k1"); !ok {
+		t.Fatal("k1 should stay")
+	}
+}
+
+func TestTwoQPromoteGhost(t *testing.T) {
+	p := NewTwoQ(40, nil)
+	p.Add("k1", String("v1"))
+	for i := 0; i < 10; i++ {
+		p.Add(fmt.Sprintf("s%02d", i), String("v"))
+	}
+	if _, ok := p.Get("k1"); ok {
+		t.Fatal("k1 should be evicted from a1in")
+	}
+	p.Add("k1", String("v1")) // 命中a1out 进入am
+	if e, ok := p.cache["k1"]; !ok || !e.Value.(*twoQEntry).hot {
+		t.Fatal("k1 should be promoted to am")
+	}
+}
+
+func TestARCAdapt(t *testing.T) {
+	p := NewARC(40, nil)
+	p.Add("h1", String("v1"))
+	p.Get("h1") // 进入t2
+	p.Add("k1", String("v1"))
+	for i := 0; i < 9; i++ {
+		p.Add(fmt.Sprintf("s%02d", i), String("v"))
+	}
+	if _, ok := p.ghosts["k1"]; !ok {
+		t.Fatal("k1 should be remembered in b1")
+	}
+	before := p.p
+	p.Add("k1", String("v1"))
+	if p.p <= before {
+		t.Fatalf("hit in b1 should grow p, %d -> %d", before, p.p)
+	}
+	if e, ok := p.cache["k1"]; !ok || e.Value.(*arcEntry).ll != p.t2 {
+		t.Fatal("k1 should be placed in t2")
+	}
+}
@@ -0,0 +1,199 @@
+package policy
+
+import "container/list"
+
+// 2Q：新key先进入FIFO队列a1in 若它在被淘汰后(记录于幽灵队列a1out)再次被加载
+// 说明它不是一次性访问 此时才进入LRU队列am
+// 一次性扫描只会冲刷a1in 不会影响am中的热key
+// 按字节计算容量: a1in最多占maxBytes的1/4 a1out最多记录maxBytes/2字节的已淘汰key
+
+const (
+	twoQInRatio  = 0.25
+	twoQOutRatio = 0.5
+)
+
+type twoQEntry struct {
+	key   string
+	value Value
+	hot   bool // 位于am中
+}
+
+// 幽灵队列中只记录key及其大小 不保存value
+type twoQGhost struct {
+	key  string
+	size int
+}
+
+type TwoQCache struct {
+	maxBytes  int
+	nbytes    int
+	inBytes   int // a1in已使用的内存
+	outBytes  int // a1out记录的已淘汰key的大小之和
+	cache     map[string]*list.Element
+	ghosts    map[string]*list.Element
+	a1in      *list.List // FIFO 队头最早进入
+	a1out     *list.List // FIFO 队头最早被淘汰
+	am        *list.List // LRU 队尾最近访问
+	onEvicted func(key string, value Value)
+	expiry
+}
+
+func NewTwoQ(maxBytes int, onEvicted func(string, Value)) *TwoQCache {
+	return &TwoQCache{
+		maxBytes:  maxBytes,
+		cache:     make(map[string]*list.Element),
+		ghosts:    make(map[string]*list.Element),
+		a1in:      list.New(),
+		a1out:     list.New(),
+		am:        list.New(),
+		onEvicted: onEvicted,
+		expiry:    newExpiry(),
+	}
+}
+
+func (c *TwoQCache) Get(key string) (value Value, ok bool) {
+	e, ok := c.cache[key]
+	if !ok {
+		return nil, false
+	}
+	ent := e.Value.(*twoQEntry)
+	if isExpired(ent.value) {
+		c.removeElement(e)
+		return nil, false
+	}
+	// a1in是FIFO 命中不调整位置
+	if ent.hot {
+		c.am.MoveToBack(e)
+	}
+	return ent.value, true
+}
+
+func (c *TwoQCache) Add(key string, value Value) {
+	if e, ok := c.cache[key]; ok {
+		ent := e.Value.(*twoQEntry)
+		delta := value.Len() - ent.value.Len()
+		c.nbytes += delta
+		if ent.hot {
+			c.am.MoveToBack(e)
+		} else {
+			c.inBytes += delta
+		}
+		ent.value = value
+	} else {
+		ent := &twoQEntry{key: key, value: value}
+		size := len(key) + value.Len()
+		if g, ok := c.ghosts[key]; ok {
+			// 淘汰后又被加载 晋升为热key
+			c.removeGhost(g)
+			ent.hot = true
+			c.cache[key] = c.am.PushBack(ent)
+		} else {
+			c.cache[key] = c.a1in.PushBack(ent)
+			c.inBytes += size
+		}
+		c.nbytes += size
+	}
+	c.track(key, value)
+
+	if c.maxBytes != 0 {
+		c.RemoveExpired(removeExpireN)
+	}
+	for c.maxBytes != 0 && c.nbytes > c.maxBytes {
+		c.reclaim()
+	}
+}
+
+// reclaim 淘汰一个key a1in超出配额时淘汰a1in队头并记入a1out 否则淘汰am中最久未访问的key
+func (c *TwoQCache) reclaim() {
+	e := c.victim()
+	if e == nil {
+		return
+	}
+	ent := e.Value.(*twoQEntry)
+	c.removeElement(e)
+	if !ent.hot {
+		c.addGhost(ent.key, len(ent.key)+ent.value.Len())
+	}
+}
+
+func (c *TwoQCache) victim() *list.Element {
+	if e := c.a1in.Front(); e != nil && (float64(c.inBytes) > twoQInRatio*float64(c.maxBytes) || c.am.Len() == 0) {
+		return e
+	}
+	return c.am.Front()
+}
+
+// Victim 返回下一个将被淘汰的key 规则同reclaim
+func (c *TwoQCache) Victim() (string, bool) {
+	if e := c.victim(); e != nil {
+		return e.Value.(*twoQEntry).key, true
+	}
+	return "", false
+}
+
+func (c *TwoQCache) addGhost(key string, size int) {
+	c.ghosts[key] = c.a1out.PushBack(&twoQGhost{key: key, size: size})
+	c.outBytes += size
+	for float64(c.outBytes) > twoQOutRatio*float64(c.maxBytes) && c.a1out.Len() > 0 {
+		c.removeGhost(c.a1out.Front())
+	}
+}
+
+func (c *TwoQCache) removeGhost(e *list.Element) {
+	g := e.Value.(*twoQGhost)
+	c.a1out.Remove(e)
+	delete(c.ghosts, g.key)
+	c.outBytes -= g.size
+}
+
+// RemoveExpired 移除最多n个过期的键 返回移除的数量
+func (c *TwoQCache) RemoveExpired(n int) int {
+	keys := c.expired(n)
+	for _, key := range keys {
+		c.Remove(key)
+	}
+	return len(keys)
+}
+
+func (c *TwoQCache) removeElement(e *list.Element) {
+	ent := e.Value.(*twoQEntry)
+	size := len(ent.key) + ent.value.Len()
+	if ent.hot {
+		c.am.Remove(e)
+	} else {
+		c.a1in.Remove(e)
+		c.inBytes -= size
+	}
+	delete(c.cache, ent.key)
+	c.nbytes -= size
+	c.untrack(ent.key)
+	if c.onEvicted != nil {
+		c.onEvicted(ent.key, ent.value)
+	}
+}
+
+// Remove 移除某个键 同时忘记它的淘汰记录
+func (c *TwoQCache) Remove(key string) {
+	if e, ok := c.cache[key]; ok {
+		c.removeElement(e)
+	}
+	if g, ok := c.ghosts[key]; ok {
+		c.removeGhost(g)
+	}
+}
+
+func (c *TwoQCache) Range(fn func(key string, value Value) bool) {
+	for key, e := range c.cache {
+		if !fn(key, e.Value.(*twoQEntry).value) {
+			return
+		}
+	}
+}
+
+func (c *TwoQCache) Len() int {
+	return len(c.cache)
+}
+
+func (c *TwoQCache) Bytes() int {
+	return c.nbytes
+}
@@ -0,0 +1,235 @@
+package geecache
+
+import (
+	"GeeCache/geecache/register_node"
+	"GeeCache/geecache/singleflight"
+	"context"
+	"errors"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// connPool 为每个peer维护一条长期复用的grpc.ClientConn
+// 之前每次Fetch都会新建etcd client、解析、阻塞Dial、执行一次rpc后全部关闭
+// 现在连接在第一次使用时才建立(lazy) 之后由同一个peer的所有请求共享
+//
+// - 取连接时若连接已处于TransientFailure/Shutdown 则丢弃并重新Dial(重新解析地址)
+// - rpc返回Unavailable时 调用方通过markBad丢弃该连接
+// - 超过idleTimeout未使用的连接由后台协程关闭
+// - Close关闭所有连接 之后的请求返回errPoolClosed
+
+const defaultIdleTimeout = 5 * time.Minute
+
+var errPoolClosed = errors.New("connection pool is closed")
+
+type dialFunc func(ctx context.Context, target string) (*grpc.ClientConn, error)
+
+type pooledConn struct {
+	conn     *grpc.ClientConn
+	lastUsed atomic.Int64 // UnixNano
+}
+
+type connPool struct {
+	mu          sync.Mutex
+	conns       map[string]*pooledConn
+	dial        dialFunc
+	dialing     singleflight.Flight // 同一个target同时只Dial一次
+	idleTimeout time.Duration
+	closed      bool
+	stop        chan struct{}
+	done        chan struct{}
+
+	creds func() credentials.TransportCredentials // 不为nil时etcdDial使用TLS
+
+	etcdOnce sync.Once
+	etcdCli  *clientv3.Client // 默认dial共享的etcd client
+	etcdErr  error
+}
+
+// newConnPool dial为nil时通过etcd解析target idleTimeout<=0时使用默认值
+func newConnPool(dial dialFunc, idleTimeout time.Duration) *connPool {
+	if idleTimeout <= 0 {
+		idleTimeout = defaultIdleTimeout
+	}
+	p := &connPool{
+		conns:       make(map[string]*pooledConn),
+		idleTimeout: idleTimeout,
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	p.dial = dial
+	if p.dial == nil {
+		p.dial = p.etcdDial
+	}
+	go p.evictIdle()
+	return p
+}
+
+// get 返回target的连接 不存在或不健康时重新建立
+func (p *connPool) get(ctx context.Context, target string) (*grpc.ClientConn, error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, errPoolClosed
+	}
+	if pc, ok := p.conns[target]; ok {
+		if healthy(pc.conn) {
+			pc.lastUsed.Store(time.Now().UnixNano())
+			p.mu.Unlock()
+			return pc.conn, nil
+		}
+		delete(p.conns, target)
+		pc.conn.Close()
+	}
+	p.mu.Unlock()
+
+	conn, err := p.dialing.FlyContext(ctx, target, func(ctx context.Context) (interface{}, error) {
+		return p.connect(ctx, target)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return conn.(*grpc.ClientConn), nil
+}
+
+// connect 建立连接并放入池中
+func (p *connPool) connect(ctx context.Context, target string) (*grpc.ClientConn, error) {
+	conn, err := p.dial(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		conn.Close()
+		return nil, errPoolClosed
+	}
+	pc := &pooledConn{conn: conn}
+	pc.lastUsed.Store(time.Now().UnixNano())
+	p.conns[target] = pc
+	return conn, nil
+}
+
+func healthy(conn *grpc.ClientConn) bool {
+	switch conn.GetState() {
+	case connectivity.TransientFailure, connectivity.Shutdown:
+		return false
+	}
+	return true
+}
+
+// markBad 丢弃出错的连接 下次get时重新建立
+// conn不是当前池中的连接(已被替换)时不做任何事
+func (p *connPool) markBad(target string, conn *grpc.ClientConn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if pc, ok := p.conns[target]; ok && pc.conn == conn {
+		delete(p.conns, target)
+		pc.conn.Close()
+	}
+}
+
+// remove 关闭不再需要的peer的连接
+func (p *connPool) remove(targets ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, target := range targets {
+		if pc, ok := p.conns[target]; ok {
+			delete(p.conns, target)
+			pc.conn.Close()
+		}
+	}
+}
+
+func (p *connPool) evictIdle() {
+	defer close(p.done)
+	ticker := time.NewTicker(p.idleTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.closeIdle(time.Now().Add(-p.idleTimeout))
+		}
+	}
+}
+
+// closeIdle 关闭before之后没有被使用过的连接
+func (p *connPool) closeIdle(before time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for target, pc := range p.conns {
+		if pc.lastUsed.Load() < before.UnixNano() {
+			delete(p.conns, target)
+			pc.conn.Close()
+		}
+	}
+}
+
+// Close 关闭所有连接 可以重复调用
+func (p *connPool) Close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	for target, pc := range p.conns {
+		delete(p.conns, target)
+		pc.conn.Close()
+	}
+	p.mu.Unlock()
+
+	close(p.stop)
+	<-p.done
+	// 等待可能正在创建的etcd client 并阻止之后再创建
+	p.etcdOnce.Do(func() {
+		p.etcdErr = errPoolClosed
+	})
+	if p.etcdCli != nil {
+		p.etcdCli.Close()
+	}
+}
+
+// isClosed 返回是否已经Close
+func (p *connPool) isClosed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.closed
+}
+
+// len 返回当前持有的连接数
+func (p *connPool) len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.conns)
+}
+
+// directDial 直接连接target 节点地址由Discovery提供时使用
+func directDial(ctx context.Context, target string) (*grpc.ClientConn, error) {
+	return grpc.DialContext(ctx, target,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithBlock(),
+	)
+}
+
+// etcdDial 通过etcd解析target 所有连接共享一个etcd client
+func (p *connPool) etcdDial(ctx context.Context, target string) (*grpc.ClientConn, error) {
+	p.etcdOnce.Do(func() {
+		p.etcdCli, p.etcdErr = clientv3.New(defaultEtcdConfig)
+	})
+	if p.etcdErr != nil {
+		return nil, p.etcdErr
+	}
+	if p.creds != nil {
+		return register_node.EtcdDialContext(ctx, p.etcdCli, target, grpc.WithTransportCredentials(p.creds()))
+	}
+	return register_node.EtcdDialContext(ctx, p.etcdCli, target)
+}
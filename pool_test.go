@@ -0,0 +1,106 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"google.golang.org/grpc"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// startBufServer 在内存监听上启动rpc服务 返回计数的dialer
+func startBufServer(t *testing.T) (dialFunc, *int32) {
+	cluster := newBufNet()
+	cluster.node(t, "127.0.0.1:9311", nil)
+
+	var dials int32
+	dial := func(ctx context.Context, target string) (*grpc.ClientConn, error) {
+		atomic.AddInt32(&dials, 1)
+		return cluster.dial(ctx, target)
+	}
+	return dial, &dials
+}
+
+func TestConnPool(t *testing.T) {
+	NewGroup("pool", 2<<10, GetterFunc(func(key string) (ByteView, error) {
+		return NewByteView([]byte("value-" + key)), nil
+	}))
+	dial, dials := startBufServer(t)
+	pool := newConnPool(dial, time.Minute)
+	defer pool.Close()
+	client := &Client{name: "127.0.0.1:9311", pool: pool}
+
+	// 第一次使用时才建立连接
+	if n := atomic.LoadInt32(dials); n != 0 {
+		t.Fatalf("pool should dial lazily, got %d dials", n)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprintf("key%d", i)
+			if v, err := client.Fetch("pool", key); err != nil || v.String() != "value-"+key {
+				t.Errorf("fetch %s: %s %v", key, v, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(dials); n != 1 {
+		t.Fatalf("connection should be shared, got %d dials", n)
+	}
+
+	// 连接被关闭(Shutdown)后重新建立
+	conn, _ := pool.get(context.Background(), "127.0.0.1:9311")
+	conn.Close()
+	if _, err := client.Fetch("pool", "Tom"); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(dials); n != 2 {
+		t.Fatalf("unhealthy connection should be redialed, got %d dials", n)
+	}
+
+	// 空闲连接被关闭
+	pool.closeIdle(time.Now().Add(time.Second))
+	if pool.len() != 0 {
+		t.Fatal("idle connection should be evicted")
+	}
+	if _, err := client.Fetch("pool", "Tom"); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(dials); n != 3 {
+		t.Fatalf("evicted connection should be redialed lazily, got %d dials", n)
+	}
+
+	pool.Close()
+	pool.Close()
+	if _, err := client.Fetch("pool", "Tom"); !errors.Is(err, errPoolClosed) {
+		t.Fatalf("expect errPoolClosed after Close, got %v", err)
+	}
+}
+
+func TestConnPoolMarkBad(t *testing.T) {
+	dial, dials := startBufServer(t)
+	pool := newConnPool(dial, time.Minute)
+	defer pool.Close()
+
+	conn, err := pool.get(context.Background(), "127.0.0.1:9311")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 已被替换的连接不会影响当前连接
+	pool.markBad("127.0.0.1:9311", nil)
+	if pool.len() != 1 {
+		t.Fatal("markBad with stale conn should be ignored")
+	}
+	pool.markBad("127.0.0.1:9311", conn)
+	if pool.len() != 0 {
+		t.Fatal("bad connection should be dropped")
+	}
+	if _, err := pool.get(context.Background(), "127.0.0.1:9311"); err != nil || atomic.LoadInt32(dials) != 2 {
+		t.Fatalf("expect redial, got %d dials %v", atomic.LoadInt32(dials), err)
+	}
+}
@@ -1,6 +1,7 @@
 package register_node
 
 import (
+	"context"
 	"fmt"
 	clientv3 "go.etcd.io/etcd/client/v3"
 	"go.etcd.io/etcd/client/v3/naming/resolver"
@@ -8,16 +9,22 @@ import (
 )
 
 func EtcdDial(c *clientv3.Client, service string) (*grpc.ClientConn, error) {
+	return EtcdDialContext(context.Background(), c, service)
+}
+
+// EtcdDialContext 与EtcdDial相同 但阻塞建立连接的过程受ctx控制
+// opts追加在默认选项之后 可以用grpc.WithTransportCredentials替换默认的明文连接
+func EtcdDialContext(ctx context.Context, c *clientv3.Client, service string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
 	etcdResolver, err := resolver.NewBuilder(c)
 	if err != nil {
 		return nil, fmt.Errorf("Build etcd resolve failed:%v\n", err)
 	}
-	conn, err := grpc.Dial(
-		"etcd:///"+service,
+	opts = append([]grpc.DialOption{
 		grpc.WithResolvers(etcdResolver),
 		grpc.WithInsecure(),
 		grpc.WithBlock(),
-	)
+	}, opts...)
+	conn, err := grpc.DialContext(ctx, "etcd:///"+service, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to Dial:%v\n", err)
 	}
@@ -1,10 +1,10 @@
 package register_node
 
 import (
+	"GeeCache/geecache/logger"
 	"context"
 	"fmt"
 	clientv3 "go.etcd.io/etcd/client/v3"
-	"log"
 	"time"
 )
 
@@ -13,63 +13,115 @@ var (
 		Endpoints:   []string{"localhost:2379"},
 		DialTimeout: 5 * time.Second,
 	}
+
+	lg = logger.Default()
 )
 
+// revokeTimeout 注销租约的超时时间 etcd不可用时注销不会一直阻塞
+const revokeTimeout = 3 * time.Second
+
+// SetLogger 设置注册过程默认使用的Logger 需在Register之前调用
+// 需要区分节点时使用RegisterLogger
+func SetLogger(l logger.Logger) {
+	lg = l
+}
+
 // AddEtcd在租赁模式下添加一对键值对至etcd
-func ectdAddKV(c *clientv3.Client, lid clientv3.LeaseID, service string, addr string) error {
+func ectdAddKV(ctx context.Context, c *clientv3.Client, lid clientv3.LeaseID, service string, addr string) error {
 	key := service + "/" + addr
-	_, err := c.Put(context.TODO(), key, addr, clientv3.WithLease(lid))
+	_, err := c.Put(ctx, key, addr, clientv3.WithLease(lid))
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-// Register 注册一个服务至etcd
+// revoke 注销租约 租约下的key随之删除 失败时等待租约自然过期
+func revoke(c *clientv3.Client, lid clientv3.LeaseID, l logger.Logger) {
+	ctx, cancel := context.WithTimeout(context.Background(), revokeTimeout)
+	defer cancel()
+	if _, err := c.Revoke(ctx, lid); err != nil {
+		l.Warn("revoke lease failed", "lease", lid, "err", err)
+	}
+}
+
+// Register 注册一个服务至etcd 直到stop收到信号
 func Register(service string, addr string, stop chan error) error {
-	cli, err := clientv3.New(defaultEtcdConfig)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errc := make(chan error, 1)
+	go func() {
+		errc <- RegisterContext(ctx, defaultEtcdConfig, service, addr)
+	}()
+	select {
+	case err := <-stop:
+		lg.Info("stop signal received", "service", service, "addr", addr, "err", err)
+		cancel()
+		<-errc
+		return err
+	case err := <-errc:
+		return err
+	}
+}
+
+// RegisterContext 使用cfg连接etcd并注册服务 直到ctx结束后注销
+func RegisterContext(ctx context.Context, cfg clientv3.Config, service string, addr string) error {
+	return RegisterLogger(ctx, cfg, service, addr, nil)
+}
+
+// RegisterLogger 与RegisterContext相同 注册过程的日志输出到l l为nil时使用SetLogger设置的Logger
+func RegisterLogger(ctx context.Context, cfg clientv3.Config, service string, addr string, l logger.Logger) error {
+	if l == nil {
+		l = lg
+	}
+	cli, err := clientv3.New(cfg)
 	if err != nil {
 		return fmt.Errorf("create etcd client failed: %v", err)
 	}
 	defer cli.Close()
 
-	resp, err := cli.Grant(context.Background(), 5)
+	resp, err := cli.Grant(ctx, 5)
 	if err != nil {
 		return fmt.Errorf("create lease failed: %v", err)
 	}
 	leaseID := resp.ID
 
-	if err := ectdAddKV(cli, leaseID, service, addr); err != nil {
-		cli.Revoke(context.Background(), leaseID)
+	if err := ectdAddKV(ctx, cli, leaseID, service, addr); err != nil {
+		revoke(cli, leaseID, l)
 		return fmt.Errorf("add etcd record failed: %v", err)
 	}
 
-	ch, err := cli.KeepAlive(context.Background(), leaseID)
+	ch, err := cli.KeepAlive(ctx, leaseID)
 	if err != nil {
-		cli.Revoke(context.Background(), leaseID)
+		revoke(cli, leaseID, l)
 		return fmt.Errorf("set keepalive failed: %v", err)
 	}
-	defer cli.Revoke(context.Background(), leaseID)
+	defer revoke(cli, leaseID, l)
 
-	log.Printf("[%s] register service ok\n", addr)
+	l.Info("register service ok", "service", service, "addr", addr, "lease", leaseID)
 	for {
 		select {
-		case err := <-stop:
-			log.Println("Stop signal received: %v\n", err)
-			return err
+		case <-ctx.Done():
+			l.Info("stop signal received", "service", service, "addr", addr, "err", ctx.Err())
+			return nil
 		case <-cli.Ctx().Done():
-			log.Println("Service closed")
+			l.Info("service closed", "service", service, "addr", addr)
 			return nil
 		case ka, ok := <-ch:
 			if !ok {
-				log.Println("Keep alive channel closed")
+				if ctx.Err() != nil {
+					return nil
+				}
+				l.Error("keep alive channel closed", "service", service, "addr", addr)
 				return fmt.Errorf("keep alive channel closed")
 			}
 			if ka == nil {
-				log.Println("Keep alive failed, lease may have expired")
+				l.Error("keep alive failed, lease may have expired", "service", service, "addr", addr)
 				return fmt.Errorf("keep alive failed")
 			}
-			log.Printf("Keep alive received,lease ID: %v, TTL:%d\n", ka.ID, ka.TTL)
+			if logger.Enabled(l, logger.LevelDebug) {
+				l.Debug("keep alive received", "lease", ka.ID, "ttl", ka.TTL)
+			}
 		}
 
 	}
@@ -0,0 +1,161 @@
+package geecache
+
+import (
+	"GeeCache/geecache/logger"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// peerRequestKey 标记由其他节点转发而来的请求
+type peerRequestKey struct{}
+
+// withPeerRequest server处理远端节点的读请求时调用
+func withPeerRequest(ctx context.Context) context.Context {
+	return context.WithValue(ctx, peerRequestKey{}, true)
+}
+
+// fromPeerRequest 远端节点转发来的请求不再尝试副本
+// 否则两个副本在owner不可用时会互相请求对方
+func fromPeerRequest(ctx context.Context) bool {
+	v, _ := ctx.Value(peerRequestKey{}).(bool)
+	return v
+}
+
+// replicas 返回key的副本节点 未开启复制时返回nil
+func (g *Group) replicas(key string) []Fetcher {
+	if g.replication <= 1 || g.server == nil {
+		return nil
+	}
+	picker, ok := g.server.(ReplicaPicker)
+	if !ok {
+		return nil
+	}
+	return picker.PickReplicas(key, g.replication)
+}
+
+// fetchHedged 从owner读取 若owner在其p95延迟内没有返回 则同时向第一个副本发出请求
+// 先成功的结果胜出 另一个请求被取消 hedged表示第一个副本是否已经尝试过
+func (g *Group) fetchHedged(ctx context.Context, peer Fetcher, key string) (value ByteView, hedged bool, err error) {
+	h, ok := peer.(Hedger)
+	if !ok || fromPeerRequest(ctx) {
+		value, err = g.fetchFromPeer(ctx, peer, key)
+		return value, false, err
+	}
+	delay, ok := h.HedgeDelay()
+	var replicas []Fetcher
+	if ok {
+		replicas = g.replicas(key)
+	}
+	if len(replicas) == 0 {
+		value, err = g.fetchFromPeer(ctx, peer, key)
+		return value, false, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type result struct {
+		value ByteView
+		err   error
+	}
+	results := make(chan result, 2)
+	fetch := func(peer Fetcher) {
+		value, err := g.fetchFromPeer(ctx, peer, key)
+		results <- result{value, err}
+	}
+	go fetch(peer)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	pending := 1
+	for {
+		select {
+		case <-timer.C:
+			if logger.Enabled(g.logger, logger.LevelDebug) {
+				g.logger.Debug("hedge to replica", "group", g.name, "key", key, "delay", delay)
+			}
+			hedged = true
+			pending++
+			go fetch(replicas[0])
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				return r.value, hedged, nil
+			}
+			// owner在对冲前就失败了 交给fetchFromReplicas处理
+			if !hedged || pending == 0 {
+				return ByteView{}, hedged, r.err
+			}
+		}
+	}
+}
+
+// fetchFromReplicas owner不可用时依次从副本读取 skipFirst为true时跳过已对冲过的第一个副本
+func (g *Group) fetchFromReplicas(ctx context.Context, key string, skipFirst bool) (ByteView, bool) {
+	if fromPeerRequest(ctx) {
+		return ByteView{}, false
+	}
+	replicas := g.replicas(key)
+	if skipFirst && len(replicas) > 0 {
+		replicas = replicas[1:]
+	}
+	for _, peer := range replicas {
+		start := time.Now()
+		value, err := g.fetchFromPeer(ctx, peer, key)
+		if err == nil {
+			return g.fromPeer(key, value, start), true
+		}
+		g.logger.Warn("fail to get from replica", "group", g.name, "key", key, "err", err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return ByteView{}, false
+}
+
+// replicate 在后台把本地加载的值写入副本 不影响本次读取的延迟
+func (g *Group) replicate(key string, value ByteView) {
+	replicas := g.replicas(key)
+	if len(replicas) == 0 {
+		return
+	}
+	go func() {
+		err := g.writeTo(replicas, func(w PeerWriter) error {
+			return w.Set(context.Background(), g.name, key, value)
+		})
+		if err != nil {
+			g.logger.Warn("fail to replicate", "group", g.name, "key", key, "err", err)
+		}
+	}()
+}
+
+// writeReplicas 对key的所有副本执行写操作
+func (g *Group) writeReplicas(key string, fn func(w PeerWriter) error) error {
+	return g.writeTo(g.replicas(key), fn)
+}
+
+// writeTo 并发地对peers执行写操作 返回所有失败
+func (g *Group) writeTo(peers []Fetcher, fn func(w PeerWriter) error) error {
+	var (
+		wg    sync.WaitGroup
+		errMu sync.Mutex
+		errs  []error
+	)
+	for _, peer := range peers {
+		w, ok := peer.(PeerWriter)
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func(w PeerWriter) {
+			defer wg.Done()
+			if err := fn(w); err != nil {
+				errMu.Lock()
+				errs = append(errs, err)
+				errMu.Unlock()
+			}
+		}(w)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
@@ -0,0 +1,88 @@
+package geecache
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReplication(t *testing.T) {
+	const (
+		addrA = "127.0.0.1:9201"
+		addrB = "127.0.0.1:9202"
+		addrC = "127.0.0.1:9203"
+	)
+	var originA, originB, originC int32
+	gA := NewGroup("replica", 1<<20, countingGetter(&originA), WithReplication(2))
+	gB := NewGroup("replica", 1<<20, countingGetter(&originB), WithReplication(2))
+	gC := NewGroup("replica", 1<<20, countingGetter(&originC), WithReplication(2))
+
+	cluster := newBufNet()
+	a := cluster.node(t, addrA, map[string]*Group{"replica": gA})
+	b := cluster.node(t, addrB, map[string]*Group{"replica": gB})
+	c := cluster.node(t, addrC, map[string]*Group{"replica": gC})
+	for _, svr := range []*server{a, b, c} {
+		svr.SetPeers(addrA, addrB, addrC)
+	}
+	gA.RegisterSvr(a)
+	gB.RegisterSvr(b)
+	gC.RegisterSvr(c)
+
+	// 找出owner为B 副本为C的key
+	var keys []string
+	for i := 0; len(keys) < 3; i++ {
+		key := fmt.Sprintf("key%d", i)
+		if replicas := a.PickReplicas(key, 2); a.owner(key) == addrB && len(replicas) == 1 && replicas[0].(*Client).name == addrC {
+			keys = append(keys, key)
+		}
+	}
+	replicated, removed, missing := keys[0], keys[1], keys[2]
+
+	// B加载后写入C
+	for _, key := range []string{replicated, removed} {
+		if _, err := gB.Get(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		_, ok1 := gC.mainCache.peek(replicated)
+		_, ok2 := gC.mainCache.peek(removed)
+		if ok1 && ok2 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if v, ok := gC.mainCache.peek(replicated); !ok || v.String() != "value-"+replicated || v.Expire().IsZero() {
+		t.Fatalf("%s should be replicated to C with its ttl", replicated)
+	}
+
+	// Remove同时删除副本
+	if err := gA.Remove(removed); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := gC.mainCache.peek(removed); ok {
+		t.Fatalf("%s should be removed from replica", removed)
+	}
+
+	// B不可用 A从副本C读取
+	cluster.down(addrB)
+	if v, err := gA.Get(replicated); err != nil || v.String() != "value-"+replicated {
+		t.Fatalf("get %s from replica: %s %v", replicated, v, err)
+	}
+	if n := atomic.LoadInt32(&originA) + atomic.LoadInt32(&originC); n != 0 {
+		t.Fatalf("replica read should not hit the origin, got %d loads", n)
+	}
+
+	// 副本也未命中时 由C加载 C不会再请求其他副本
+	if v, err := gA.Get(missing); err != nil || v.String() != "value-"+missing {
+		t.Fatalf("get %s: %s %v", missing, v, err)
+	}
+	if n := atomic.LoadInt32(&originC); n != 1 {
+		t.Fatalf("expect C to load %s once, got %d", missing, n)
+	}
+	if n := atomic.LoadInt32(&originA); n != 0 {
+		t.Fatalf("A should not load from origin, got %d", n)
+	}
+}
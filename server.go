@@ -1,14 +1,16 @@
 package geecache
 
 import (
-	"GeeCache/geecache/consistenthash"
+	"GeeCache/geecache/discovery"
 	pb "GeeCache/geecache/geecachepb"
-	"GeeCache/geecache/register_node"
+	"GeeCache/geecache/logger"
+	"GeeCache/geecache/placement"
 	"context"
 	"fmt"
 	clientv3 "go.etcd.io/etcd/client/v3"
 	"google.golang.org/grpc"
-	"log"
+	"google.golang.org/grpc/credentials"
+	"maps"
 	"net"
 	"strings"
 	"sync"
@@ -33,10 +35,98 @@ type server struct {
 
 	addr       string
 	status     bool
-	stopSignal chan error
+	stop       context.CancelFunc // 从服务发现注销 并停止watch
+	rpc        *grpc.Server       // Start创建 Shutdown时停止
+	registered chan struct{}      // Register返回(已注销)后关闭
+	discovery  discovery.Discovery
 	mu         sync.Mutex
-	consHash   *consistenthash.Map
+	placer     placement.Placer
+	newPlacer  placement.Factory // 为nil时使用defaultReplicas个虚拟节点的一致性哈希环
+	weights    map[string]int    // 节点权重 Placer满足placement.WeightedPlacer时生效
 	clients    map[string]*Client
+	pool       *connPool // 所有Client共享的连接池 Stop时关闭
+
+	debounce     time.Duration  // 合并成员变化的时间窗口
+	onRingChange func(RingDiff) // 哈希环变化后的回调
+
+	peerPolicy PeerPolicy    // 新建Client使用的重试、对冲与熔断策略
+	tls        *certReloader // 不为nil时rpc服务与节点之间的连接都使用TLS
+	auth       Authenticator // 不为nil时rpc需要认证
+	signer     Signer        // 访问其他节点时附加的凭证
+	metrics    MetricsSink   // 不为nil时记录rpc的请求数与耗时
+	logger     logger.Logger
+	tracer     Tracer // 不为nil时从rpc中恢复trace上下文 并传播给其他节点
+
+	handoffRate  int        // 每秒最多迁移的条目数 0表示不迁移
+	handoffMu    sync.Mutex // 同一时间只进行一次迁移
+	handoffStats handoffCounters
+
+	groups GroupRegistry // 本节点提供的Group
+}
+
+// GroupRegistry 节点对外提供的Group 默认为NewGroup注册的全局Group
+// 在一个进程内运行多个节点时 每个节点可以使用各自的GroupRegistry
+type GroupRegistry interface {
+	Group(name string) *Group
+	Groups() []*Group
+}
+
+// globalGroups 由NewGroup注册的全局Group
+type globalGroups struct{}
+
+func (globalGroups) Group(name string) *Group {
+	return GetGroup(name)
+}
+
+func (globalGroups) Groups() []*Group {
+	mu.RLock()
+	defer mu.RUnlock()
+	list := make([]*Group, 0, len(groups))
+	for _, g := range groups {
+		list = append(list, g)
+	}
+	return list
+}
+
+// GroupMap 以固定的一组Group作为GroupRegistry
+type GroupMap map[string]*Group
+
+func (m GroupMap) Group(name string) *Group {
+	return m[name]
+}
+
+func (m GroupMap) Groups() []*Group {
+	list := make([]*Group, 0, len(m))
+	for _, g := range m {
+		list = append(list, g)
+	}
+	return list
+}
+
+// SetGroups 设置本节点提供的Group 默认为NewGroup注册的全局Group
+// 需在SetPeers/Start之前调用
+func (s *server) SetGroups(r GroupRegistry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.groups = r
+}
+
+// registry 返回本节点的GroupRegistry 零值的server使用全局Group
+func (s *server) registry() GroupRegistry {
+	if s.groups == nil {
+		return globalGroups{}
+	}
+	return s.groups
+}
+
+// group 返回名为name的Group
+func (s *server) group(name string) *Group {
+	return s.registry().Group(name)
+}
+
+// groupList 返回本节点的所有Group
+func (s *server) groupList() []*Group {
+	return s.registry().Groups()
 }
 
 /*
@@ -61,12 +151,19 @@ func (s *server) PickPeer(key string) (Fetcher, bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	peerAddr := s.consHash.Get(key)
-	if peerAddr == s.addr {
-		log.Printf("pick local peer: %s\n", s.addr)
+	if s.placer == nil {
 		return nil, false
 	}
-	log.Printf("[cache %s] pick remote peer: %s\n", s.addr, peerAddr)
+	peerAddr := s.placer.Get(key)
+	if peerAddr == s.addr || peerAddr == "" {
+		if logger.Enabled(s.log(), logger.LevelDebug) {
+			s.log().Debug("pick local peer", "addr", s.addr, "key", key)
+		}
+		return nil, false
+	}
+	if logger.Enabled(s.log(), logger.LevelDebug) {
+		s.log().Debug("pick remote peer", "addr", s.addr, "key", key, "peer", peerAddr)
+	}
 	return s.clients[peerAddr], true
 }
 
@@ -78,30 +175,278 @@ func NewServer(addr string) (*server, error) {
 	if !validPeerAddr(addr) {
 		return nil, fmt.Errorf("invalid addr %s", addr)
 	}
-	return &server{addr: addr}, nil
+	return &server{
+		addr:       addr,
+		pool:       newConnPool(directDial, 0),
+		peerPolicy: DefaultPeerPolicy,
+		logger:     logger.Default(),
+		groups:     globalGroups{},
+	}, nil
+}
+
+// SetPeerPolicy 设置访问远端节点的策略 默认为DefaultPeerPolicy
+// 需在SetPeers/Start之前调用 已有节点的Client不受影响
+func (s *server) SetPeerPolicy(policy PeerPolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.peerPolicy = policy
+}
+
+// SetLogger 设置server的Logger 默认只输出Info及以上级别的日志
+// 服务发现实现了discovery.LoggerSetter时(如etcd) 注册过程的日志同样输出到l
+// 需在SetPeers/Start之前调用
+func (s *server) SetLogger(l logger.Logger) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logger = l
+	if s.tls != nil {
+		s.tls.logger = l
+	}
+}
+
+// log 返回server的Logger 零值的server使用默认Logger
+func (s *server) log() logger.Logger {
+	if s.logger == nil {
+		return logger.Default()
+	}
+	return s.logger
+}
+
+// newClient 创建共享连接池的Client 每个节点有独立的熔断器 调用方需持有锁
+func (s *server) newClient(addr string) *Client {
+	b := newBreaker(addr, s.peerPolicy.BreakerThreshold, s.peerPolicy.BreakerCooldown)
+	b.logger = s.log()
+	return &Client{
+		name:    addr,
+		pool:    s.pool,
+		policy:  s.peerPolicy,
+		breaker: b,
+		signer:  s.signer,
+		tracer:  s.tracer,
+		track:   s.trackLoad,
+	}
+}
+
+// resetPoolLocked 换用dial的新连接池 已有节点的Client改用新连接池 调用方需持有锁
+func (s *server) resetPoolLocked(dial dialFunc) {
+	old := s.pool
+	s.pool = newConnPool(dial, old.idleTimeout)
+	for addr := range s.clients {
+		s.clients[addr] = s.newClient(addr)
+	}
+	old.Close()
+}
+
+// BreakerStates 返回各远端节点熔断器的状态
+func (s *server) BreakerStates() map[string]BreakerState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	states := make(map[string]BreakerState, len(s.clients))
+	for addr, client := range s.clients {
+		if addr == s.addr {
+			continue
+		}
+		states[addr] = client.BreakerState()
+	}
+	return states
 }
 
 func (s *server) Get(ctx context.Context, in *pb.Request) (*pb.Response, error) {
 	group, key := in.GetGroup(), in.GetKey()
 	resp := &pb.Response{}
 
-	log.Printf("[geecache_server %s] Recv RPC Request - (%s)/(%s)", s.addr, group, key)
+	if logger.Enabled(s.log(), logger.LevelDebug) {
+		s.log().Debug("recv rpc Get", "addr", s.addr, "group", group, "key", key)
+	}
 	if key == "" {
 		return resp, fmt.Errorf("key require")
 	}
-	g := GetGroup(group)
+	g := s.group(group)
 	if g == nil {
 		return resp, fmt.Errorf("group not found")
 	}
-	view, err := g.Get(key)
+	view, err := g.GetContext(withPeerRequest(g.extractTrace(ctx)), key)
 	if err != nil {
 		return resp, err
 	}
-	resp.Value = view.ByteSlice()
+	return responseFromView(view), nil
+
+}
+
+// responseFromView 将ByteView转换为rpc响应 包括过期时间与Metadata
+func responseFromView(view ByteView) *pb.Response {
+	return &pb.Response{
+		Value:       view.ByteSlice(),
+		Expire:      expireToUnixNano(view.Expire()),
+		Version:     view.meta.Version,
+		Flags:       view.meta.Flags,
+		ContentType: view.meta.ContentType,
+	}
+}
+
+// BatchGet 一次获取多个key 单个key失败不影响其他key
+func (s *server) BatchGet(ctx context.Context, in *pb.BatchRequest) (*pb.BatchResponse, error) {
+	group, keys := in.GetGroup(), in.GetKeys()
+	resp := &pb.BatchResponse{}
+
+	if logger.Enabled(s.log(), logger.LevelDebug) {
+		s.log().Debug("recv rpc BatchGet", "addr", s.addr, "group", group, "keys", len(keys))
+	}
+	g := s.group(group)
+	if g == nil {
+		return resp, fmt.Errorf("group not found")
+	}
+	results := g.GetMulti(withPeerRequest(g.extractTrace(ctx)), keys)
+	resp.Entries = make([]*pb.BatchEntry, len(keys))
+	for i, key := range keys {
+		entry := &pb.BatchEntry{Key: key}
+		if r := results[key]; r.Err != nil {
+			entry.Error = r.Err.Error()
+		} else {
+			entry.Value = responseFromView(r.Value)
+		}
+		resp.Entries[i] = entry
+	}
 	return resp, nil
+}
 
+// Set 由其他节点路由而来的写请求 只写入本地
+func (s *server) Set(ctx context.Context, in *pb.SetRequest) (*pb.SetResponse, error) {
+	group, key := in.GetGroup(), in.GetKey()
+	resp := &pb.SetResponse{}
+
+	if logger.Enabled(s.log(), logger.LevelDebug) {
+		s.log().Debug("recv rpc Set", "addr", s.addr, "group", group, "key", key)
+	}
+	if key == "" {
+		return resp, fmt.Errorf("key require")
+	}
+	g := s.group(group)
+	if g == nil {
+		return resp, fmt.Errorf("group not found")
+	}
+	g.setLocally(key, viewFromSetRequest(in))
+	return resp, nil
+}
+
+func viewFromSetRequest(in *pb.SetRequest) ByteView {
+	return ByteView{
+		b:      in.GetValue(),
+		expire: expireFromUnixNano(in.GetExpire()),
+		meta: Metadata{
+			Version:     in.GetVersion(),
+			Flags:       in.GetFlags(),
+			ContentType: in.GetContentType(),
+		},
+	}
 }
 
+// Delete 由其他节点发来的删除请求 只删除本地
+func (s *server) Delete(ctx context.Context, in *pb.DeleteRequest) (*pb.DeleteResponse, error) {
+	group, key := in.GetGroup(), in.GetKey()
+	resp := &pb.DeleteResponse{}
+
+	if logger.Enabled(s.log(), logger.LevelDebug) {
+		s.log().Debug("recv rpc Delete", "addr", s.addr, "group", group, "key", key)
+	}
+	if key == "" {
+		return resp, fmt.Errorf("key require")
+	}
+	g := s.group(group)
+	if g == nil {
+		return resp, fmt.Errorf("group not found")
+	}
+	if in.GetHotOnly() {
+		g.removeHotLocally(key)
+	} else {
+		g.removeLocally(key)
+	}
+	return resp, nil
+}
+
+// SetPlacement 设置key的放置算法 如placement.Rendezvous
+// 集群中所有节点必须使用相同的算法 已有的节点会按新算法重新放置
+func (s *server) SetPlacement(factory placement.Factory) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.newPlacer = factory
+	s.rebuildPlacer()
+}
+
+// SetPeerWeights 设置节点的权重 未设置的节点权重为1 权重越大的节点分到的key越多
+// 放置算法需满足placement.WeightedPlacer(如默认的一致性哈希环) 否则权重被忽略
+// 集群中所有节点必须使用相同的权重 已有的节点会按新权重重新放置
+func (s *server) SetPeerWeights(weights map[string]int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.weights = maps.Clone(weights)
+	s.rebuildPlacer()
+}
+
+// rebuildPlacer 按当前的算法与权重重新放置已有的节点 调用方需持有锁
+func (s *server) rebuildPlacer() {
+	if s.placer == nil {
+		return
+	}
+	s.placer = s.makePlacer()
+	addrs := make([]string, 0, len(s.clients))
+	for addr := range s.clients {
+		addrs = append(addrs, addr)
+	}
+	s.register(addrs...)
+}
+
+// register 将节点加入Placer 设置了权重的节点按权重注册 调用方需持有锁
+func (s *server) register(addrs ...string) {
+	wp, weighted := s.placer.(placement.WeightedPlacer)
+	for _, addr := range addrs {
+		if w := s.weights[addr]; weighted && w > 0 {
+			wp.RegisterWeighted(addr, w)
+			continue
+		}
+		s.placer.Register(addr)
+	}
+}
+
+// trackLoad Placer满足placement.LoadTracker(如placement.BoundedRing)时
+// 将一次发往addr的rpc计入该节点的负载 返回的函数在rpc结束时调用
+func (s *server) trackLoad(addr string) func() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lt, ok := s.placer.(placement.LoadTracker)
+	if !ok {
+		return func() {}
+	}
+	lt.Inc(addr)
+	placer := s.placer
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		// Placer已被替换 新的Placer没有记录这次负载
+		if s.placer == placer {
+			lt.Done(addr)
+		}
+	}
+}
+
+// makePlacer 创建空的Placer 调用方需持有锁
+func (s *server) makePlacer() placement.Placer {
+	if s.newPlacer == nil {
+		return placement.Ring(defaultReplicas)()
+	}
+	return s.newPlacer()
+}
+
+// SetDiscovery 设置服务发现 需在Start之前调用
+// 未设置时使用defaultEtcdConfig上的etcd
+func (s *server) SetDiscovery(d discovery.Discovery) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.discovery = d
+}
+
+// Start 启动rpc服务并注册到服务发现 阻塞直到server被关闭
+// 注册失败(如与etcd的租约丢失)时停止服务并返回错误
 func (s *server) Start() error {
 	s.mu.Lock()
 
@@ -111,90 +456,233 @@ func (s *server) Start() error {
 	}
 	// -----------------启动服务----------------------
 	// 1. 设置status为true 表示服务器已在运行
-	// 2. 初始化stop channal,这用于通知registry stop keep alive
+	// 2. 初始化stop context,这用于通知registry stop keep alive
 	// 3. 初始化tcp socket并开始监听
 	// 4. 注册rpc服务至grpc 这样grpc收到request可以分发给server处理
-	// 5. 将自己的服务名/Host地址注册至etcd 这样client可以通过etcd
-	//    获取服务Host地址 从而进行通信。这样的好处是client只需知道服务名
-	//    以及etcd的Host即可获取对应服务IP 无需写死至client代码中
+	// 5. 将自己的Host地址注册至服务发现(默认为etcd) 这样其他节点可以通过
+	//    服务发现获取节点地址 从而进行通信。这样的好处是节点地址
+	//    无需写死至client代码中
 	// ----------------------------------------------
-	s.status = true
-	s.stopSignal = make(chan error)
-
 	port := strings.Split(s.addr, ":")[1]
 	lis, err := net.Listen("tcp", ":"+port)
 	if err != nil {
+		s.mu.Unlock()
 		return fmt.Errorf("failed to listen: %v", err)
 	}
-	grpcServer := grpc.NewServer()
+	s.status = true
+	var ctx context.Context
+	ctx, s.stop = context.WithCancel(context.Background())
+	if s.discovery == nil {
+		s.discovery = discovery.NewEtcd(defaultEtcdConfig, defaultServiceName)
+	}
+	d := s.discovery
+	if ls, ok := d.(discovery.LoggerSetter); ok {
+		ls.SetLogger(s.log())
+	}
+	// 上一次Shutdown关闭了连接池 重新启动时换一个新的
+	if s.pool.isClosed() {
+		s.resetPoolLocked(s.pool.dial)
+	}
+	grpcServer := grpc.NewServer(s.serverOptions()...)
 	pb.RegisterGroupCacheServer(grpcServer, s)
+	s.rpc = grpcServer
+	registered := make(chan struct{})
+	s.registered = registered
 
+	var registerErr error
 	go func() {
-		err := register_node.Register("LaurusCache", s.addr, s.stopSignal)
-		if err != nil {
-			log.Fatalf(err.Error())
+		defer close(registered)
+		err := d.Register(ctx, s.addr)
+		// Shutdown/Stop取消ctx时Register可能返回ctx的错误 属于正常注销
+		if err != nil && ctx.Err() == nil {
+			// 其他节点无法再发现本节点 停止服务并由Start返回错误
+			s.log().Error("register service failed", "addr", s.addr, "err", err)
+			registerErr = err
+			s.Stop()
+			return
 		}
-		close(s.stopSignal)
-		err = lis.Close()
-		if err != nil {
-			log.Fatalf(err.Error())
-		}
-		log.Printf("[%s] Revoke service and close tcp socket ok.", s.addr)
+		s.log().Info("revoke service ok", "addr", s.addr)
 	}()
+	// 节点加入或离开时实时更新哈希环
+	go s.watchPeers(ctx, d)
 	s.mu.Unlock()
-	if err := grpcServer.Serve(lis); s.status && err != nil {
+	// Serve之前就被Shutdown时返回ErrServerStopped
+	if err := grpcServer.Serve(lis); err != nil && err != grpc.ErrServerStopped {
 		return fmt.Errorf("failed to serve: %v", err)
 	}
+	<-registered
+	if registerErr != nil {
+		return fmt.Errorf("failed to register: %w", registerErr)
+	}
 	return nil
 }
+
+// serverOptions TLS、指标、trace与认证对应的rpc服务选项 调用方需持有锁
+func (s *server) serverOptions() []grpc.ServerOption {
+	var opts []grpc.ServerOption
+	if s.tls != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(s.tls.serverConfig())))
+	}
+	// 指标在认证之前记录 认证失败的请求同样被统计
+	if s.metrics != nil {
+		opts = append(opts,
+			grpc.ChainUnaryInterceptor(s.metricsUnary),
+			grpc.ChainStreamInterceptor(s.metricsStream),
+		)
+	}
+	if s.tracer != nil {
+		opts = append(opts,
+			grpc.ChainUnaryInterceptor(s.traceUnary),
+			grpc.ChainStreamInterceptor(s.traceStream),
+		)
+	}
+	if s.auth != nil {
+		opts = append(opts,
+			grpc.ChainUnaryInterceptor(s.authUnary),
+			grpc.ChainStreamInterceptor(s.authStream),
+		)
+	}
+	return opts
+}
+
+// Stop 立即关闭server 正在处理的rpc会被中断
 func (s *server) Stop() {
+	s.shutdown(context.Background(), false)
+}
+
+// Shutdown 优雅地关闭server
+// 1. 从服务发现注销 其他节点不再把key路由过来
+// 2. 停止接收新的rpc 等待正在处理的rpc结束(GracefulStop)
+// 3. 关闭到其他节点的连接
+// ctx结束时不再等待 强制关闭并返回ctx.Err() 可以重复调用 关闭后可以再次Start
+func (s *server) Shutdown(ctx context.Context) error {
+	return s.shutdown(ctx, true)
+}
+
+func (s *server) shutdown(ctx context.Context, graceful bool) error {
 	s.mu.Lock()
 	if s.status == false {
 		s.mu.Unlock()
-		return
+		return nil
 	}
-	s.stopSignal <- nil
 	s.status = false
+	grpcServer, registered := s.rpc, s.registered
+	s.rpc, s.registered = nil, nil
+	s.stop()
+	s.mu.Unlock()
+
+	var err error
+	if graceful {
+		select {
+		case <-registered:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+	if graceful && err == nil {
+		drained := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(drained)
+		}()
+		select {
+		case <-drained:
+		case <-ctx.Done():
+			err = ctx.Err()
+			grpcServer.Stop()
+			<-drained
+		}
+	} else {
+		grpcServer.Stop()
+	}
+	s.log().Info("server stopped", "addr", s.addr)
+
+	s.mu.Lock()
 	s.clients = nil //清空一致性哈希 有助于垃圾回收
-	s.consHash = nil
+	s.placer = nil
+	pool := s.pool
 	s.mu.Unlock()
+	pool.Close()
+	return err
 }
 
 // SetPeers 将各个远端主机IP配置到Server里
 // 这样Server就可以Pick他们了
-// 注意: 此操作是*覆写*操作！
+// 注意: 此操作是*覆写*操作！ 只有新增/移除的节点会被更新
+// 注意: 本节点总是在环中 peersAddr中没有本节点时本节点同样负责一部分key
 // 注意: peersIP必须满足 x.x.x.x:port的格式
 func (s *server) SetPeers(peersAddr ...string) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	s.consHash = consistenthash.New(defaultReplicas, nil)
-	s.consHash.Register(peersAddr...)
-	s.clients = make(map[string]*Client)
 	for _, peerAddr := range peersAddr {
 		if !validPeerAddr(peerAddr) {
 			panic(fmt.Sprintf("[peer %s] invalid address format, it should be x.x.x.x:port", peerAddr))
 		}
-		service := fmt.Sprintf("gcache/%s", peerAddr)
-		s.clients[peerAddr] = NewClient(service)
 	}
+	s.updatePeers(peersAddr)
 }
 
-// Pick 根据一致性哈希选举出key应存放在的cache
+// Pick 根据放置算法选举出key应存放在的cache
 // return false 代表从本地获取cache
 func (s *server) Pick(key string) (Fetcher, bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	peerAddr := s.consHash.Get(key)
+	if s.placer == nil {
+		return nil, false
+	}
+	peerAddr := s.placer.Get(key)
 	// Pick itself
-	if peerAddr == s.addr {
-		log.Printf("ooh! pick myself, I am %s\n", s.addr)
+	if peerAddr == s.addr || peerAddr == "" {
+		if logger.Enabled(s.log(), logger.LevelDebug) {
+			s.log().Debug("pick local peer", "addr", s.addr, "key", key)
+		}
 		return nil, false
 	}
-	log.Printf("[cache %s] pick remote peer: %s\n", s.addr, peerAddr)
+	if logger.Enabled(s.log(), logger.LevelDebug) {
+		s.log().Debug("pick remote peer", "addr", s.addr, "key", key, "peer", peerAddr)
+	}
 	return s.clients[peerAddr], true
 }
 
+// PickReplicas 返回key在owner之后的副本节点 不包括自己
+// Placer不支持GetN时返回nil
+func (s *server) PickReplicas(key string, n int) []Fetcher {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rp, ok := s.placer.(placement.ReplicaPlacer)
+	if !ok {
+		return nil
+	}
+	nodes := rp.GetN(key, n)
+	if len(nodes) <= 1 {
+		return nil
+	}
+	replicas := make([]Fetcher, 0, len(nodes)-1)
+	for _, addr := range nodes[1:] {
+		if addr == s.addr {
+			continue
+		}
+		replicas = append(replicas, s.clients[addr])
+	}
+	return replicas
+}
+
+// ListPeers 返回除自己以外的所有节点
+func (s *server) ListPeers() []Fetcher {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	peers := make([]Fetcher, 0, len(s.clients))
+	for addr, client := range s.clients {
+		if addr == s.addr {
+			continue
+		}
+		peers = append(peers, client)
+	}
+	return peers
+}
+
 // 测试Server是否实现了Picker接口
 var _ PeerPicker = (*server)(nil)
+var _ PeerLister = (*server)(nil)
+var _ ReplicaPicker = (*server)(nil)
@@ -0,0 +1,223 @@
+package geecache
+
+import (
+	"GeeCache/geecache/discovery"
+	"GeeCache/geecache/logger"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"testing"
+	"time"
+)
+
+// freeAddr 返回一个当前空闲的本地地址
+func freeAddr(t *testing.T) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	return lis.Addr().String()
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	var (
+		started = make(chan struct{}, 1)
+		release = make(chan struct{})
+		hang    = make(chan struct{})
+	)
+	t.Cleanup(func() { close(hang) })
+	g := NewGroup("shutdown", 2<<10, GetterFunc(func(key string) (ByteView, error) {
+		switch key {
+		case "slow":
+			started <- struct{}{}
+			<-release
+		case "hang":
+			started <- struct{}{}
+			<-hang
+		}
+		return NewByteView([]byte("value-" + key)), nil
+	}))
+	defer DestroyGroup("shutdown")
+
+	addr := freeAddr(t)
+	svr, err := NewServer(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := discovery.NewMemory()
+	svr.SetDiscovery(d)
+	svr.SetGroups(GroupMap{"shutdown": g})
+	registered := func() bool {
+		peers, _ := d.List(context.Background())
+		return slices.Contains(peers, addr)
+	}
+	start := func() chan error {
+		served := make(chan error, 1)
+		go func() { served <- svr.Start() }()
+		waitFor(t, "registration", registered)
+		return served
+	}
+	client := func() *Client {
+		pool := newConnPool(directDial, 0)
+		t.Cleanup(pool.Close)
+		return &Client{name: addr, pool: pool}
+	}
+
+	served := start()
+	inflight := make(chan error, 1)
+	go func() {
+		_, err := client().Fetch("shutdown", "slow")
+		inflight <- err
+	}()
+	<-started
+
+	done := make(chan error, 1)
+	go func() { done <- svr.Shutdown(context.Background()) }()
+	// 先从服务发现注销 再等待正在处理的rpc
+	waitFor(t, "deregistration", func() bool { return !registered() })
+	select {
+	case err := <-done:
+		t.Fatalf("Shutdown should wait for in-flight rpc, returned %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	// 不再接收新的连接
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if _, err := client().FetchContext(ctx, "shutdown", "fast"); err == nil {
+		t.Fatal("new rpc should be rejected while draining")
+	}
+
+	close(release)
+	if err := <-inflight; err != nil {
+		t.Fatalf("in-flight rpc should complete, got %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if err := <-served; err != nil {
+		t.Fatalf("Start should return nil after Shutdown, got %v", err)
+	}
+	if !svr.pool.isClosed() {
+		t.Fatal("Shutdown should close peer connections")
+	}
+
+	// 可以重复调用
+	if err := svr.Shutdown(context.Background()); err != nil {
+		t.Fatalf("second Shutdown: %v", err)
+	}
+	svr.Stop()
+
+	// 关闭后可以再次启动
+	served = start()
+	if v, err := client().Fetch("shutdown", "fast"); err != nil || v.String() != "value-fast" {
+		t.Fatalf("fetch after restart: %s %v", v, err)
+	}
+
+	// ctx结束时强制关闭 正在处理的rpc被中断
+	go func() {
+		_, err := client().Fetch("shutdown", "hang")
+		inflight <- err
+	}()
+	<-started
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := svr.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect DeadlineExceeded, got %v", err)
+	}
+	if err := <-inflight; err == nil {
+		t.Fatal("in-flight rpc should be aborted by forced shutdown")
+	}
+	if err := <-served; err != nil {
+		t.Fatalf("Start should return nil after Shutdown, got %v", err)
+	}
+}
+
+// registerDiscovery Register返回fail的结果 fail为nil时阻塞到ctx结束后返回ctx的错误
+type registerDiscovery struct {
+	*discovery.Memory
+	fail   error
+	logger logger.Logger
+}
+
+func (d *registerDiscovery) SetLogger(l logger.Logger) {
+	d.logger = l
+}
+
+func (d *registerDiscovery) Register(ctx context.Context, addr string) error {
+	if d.fail != nil {
+		return d.fail
+	}
+	<-ctx.Done()
+	// 与etcd在申请租约时被取消一样 返回包装了ctx错误的error
+	return fmt.Errorf("create lease failed: %w", ctx.Err())
+}
+
+func TestRegisterError(t *testing.T) {
+	// Shutdown取消注册时返回的错误属于正常注销
+	svr, _ := NewServer(freeAddr(t))
+	d := &registerDiscovery{Memory: discovery.NewMemory()}
+	svr.SetDiscovery(d)
+	lg := logger.Nop()
+	svr.SetLogger(lg)
+	served := make(chan error, 1)
+	go func() { served <- svr.Start() }()
+	waitFor(t, "start", func() bool {
+		svr.mu.Lock()
+		defer svr.mu.Unlock()
+		return svr.status
+	})
+	// server的Logger同样用于注册过程
+	if d.logger != lg {
+		t.Fatalf("expect the server's logger to be passed to discovery, got %v", d.logger)
+	}
+	if err := svr.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if err := <-served; err != nil {
+		t.Fatalf("Start should return nil after Shutdown, got %v", err)
+	}
+
+	// 注册失败时停止服务 由Start返回错误
+	fail := errors.New("etcd unavailable")
+	svr, _ = NewServer(freeAddr(t))
+	svr.SetDiscovery(&registerDiscovery{Memory: discovery.NewMemory(), fail: fail})
+	go func() { served <- svr.Start() }()
+	select {
+	case err := <-served:
+		if !errors.Is(err, fail) {
+			t.Fatalf("expect register error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start should return when registration fails")
+	}
+}
+
+func TestDestroyGroup(t *testing.T) {
+	noop := GetterFunc(func(key string) (ByteView, error) {
+		return ByteView{}, nil
+	})
+	NewGroup("destroy-nil", 2<<10, noop)
+	g := NewGroup("destroy-picker", 2<<10, noop)
+	g.RegisterSvr(&fakePicker{})
+
+	// 没有注册节点选择器或选择器不是server时不应panic
+	DestroyGroup("destroy-nil")
+	DestroyGroup("destroy-picker")
+	DestroyGroup("destroy-unknown")
+	if GetGroup("destroy-nil") != nil || GetGroup("destroy-picker") != nil {
+		t.Fatal("destroyed groups should be removed")
+	}
+}
@@ -1,6 +1,10 @@
 package singleflight
 
-import "sync"
+import (
+	"context"
+	"sync"
+	"time"
+)
 
 // single flight 为cache提供缓存击穿的保护
 // 当cache并发访问peer获取缓存时 如果peer未缓存该值
@@ -10,9 +14,131 @@ import "sync"
 // flight载有我们要的缓存数据 称为packet
 
 type call struct {
-	wg  sync.WaitGroup
-	val interface{}
-	err error
+	done chan struct{}
+	val  interface{}
+	err  error
+
+	ctx  *flightCtx // 批量加载时同一批的call共享一个ctx
+	refs int        // 仍在等待结果的调用方数量
+}
+
+// flightCtx 是flight自身的context 与任何单个调用方的取消解耦
+// 保留第一个调用方ctx中的value(如trace信息) 但不继承其取消信号
+// deadline为仍在等待的调用方中最晚的deadline 有调用方没有deadline时flight也没有deadline
+// 到达deadline或者所有等待者都放弃后被cancel
+type flightCtx struct {
+	values context.Context
+
+	mu       sync.Mutex
+	done     chan struct{}
+	err      error
+	waiters  map[*waiter]struct{}
+	deadline time.Time
+	timer    *time.Timer
+}
+
+// waiter 一个等待flight的调用方
+type waiter struct {
+	deadline time.Time
+	ok       bool // 是否有deadline
+}
+
+func newFlightCtx(ctx context.Context) *flightCtx {
+	return &flightCtx{
+		values:  context.WithoutCancel(ctx),
+		done:    make(chan struct{}),
+		waiters: make(map[*waiter]struct{}),
+	}
+}
+
+func (f *flightCtx) Deadline() (time.Time, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.deadline, !f.deadline.IsZero()
+}
+
+func (f *flightCtx) Done() <-chan struct{} {
+	return f.done
+}
+
+func (f *flightCtx) Err() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.err
+}
+
+func (f *flightCtx) Value(key interface{}) interface{} {
+	return f.values.Value(key)
+}
+
+// join 调用方开始等待 flight的deadline随之更新
+func (f *flightCtx) join(ctx context.Context) *waiter {
+	w := &waiter{}
+	w.deadline, w.ok = ctx.Deadline()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.waiters[w] = struct{}{}
+	f.updateDeadline()
+	return w
+}
+
+// leave 调用方放弃等待 最后一个等待者离开时cancel
+func (f *flightCtx) leave(w *waiter) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.waiters, w)
+	if len(f.waiters) == 0 {
+		f.cancelLocked(context.Canceled)
+		return
+	}
+	f.updateDeadline()
+}
+
+func (f *flightCtx) cancel(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cancelLocked(err)
+}
+
+func (f *flightCtx) cancelLocked(err error) {
+	if f.err != nil {
+		return
+	}
+	f.err = err
+	close(f.done)
+	if f.timer != nil {
+		f.timer.Stop()
+	}
+}
+
+// updateDeadline 将deadline设置为等待者中最晚的deadline 调用方持有锁
+func (f *flightCtx) updateDeadline() {
+	if f.err != nil {
+		return
+	}
+	var latest time.Time
+	for w := range f.waiters {
+		if !w.ok {
+			latest = time.Time{}
+			break
+		}
+		if w.deadline.After(latest) {
+			latest = w.deadline
+		}
+	}
+	if latest.Equal(f.deadline) {
+		return
+	}
+	f.deadline = latest
+	if f.timer != nil {
+		f.timer.Stop()
+		f.timer = nil
+	}
+	if !latest.IsZero() {
+		f.timer = time.AfterFunc(time.Until(latest), func() {
+			f.cancel(context.DeadlineExceeded)
+		})
+	}
 }
 
 type Flight struct {
@@ -21,26 +147,131 @@ type Flight struct {
 }
 
 func (g *Flight) Fly(key string, fn func() (interface{}, error)) (interface{}, error) {
+	return g.FlyContext(context.Background(), key, func(context.Context) (interface{}, error) {
+		return fn()
+	})
+}
+
+// FlyContext 与Fly相同 但调用方可以通过ctx放弃等待
+// 某个调用方放弃并不会取消正在进行的fn 其他等待者仍然可以拿到结果
+// 只有所有等待者都放弃后 传给fn的ctx才会被cancel
+// 传给fn的ctx带有仍在等待的调用方中最晚的deadline
+func (g *Flight) FlyContext(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
 	g.mu.Lock()
 	if g.m == nil {
 		g.m = make(map[string]*call)
 	}
-	if c, ok := g.m[key]; ok {
-		g.mu.Unlock()
-		c.wg.Wait()
-		return c.val, c.err
+	c, ok := g.m[key]
+	// 已经到达deadline的flight不再接受新的等待者
+	if !ok || c.ctx.Err() != nil {
+		c = &call{done: make(chan struct{}), ctx: newFlightCtx(ctx)}
+		g.m[key] = c
+		go g.doCall(c, key, fn)
+	}
+	c.refs++
+	w := c.ctx.join(ctx)
+	g.mu.Unlock()
+
+	return g.wait(ctx, key, c, w)
+}
+
+func (g *Flight) doCall(c *call, key string, fn func(ctx context.Context) (interface{}, error)) {
+	c.val, c.err = fn(c.ctx)
+	c.ctx.cancel(context.Canceled)
+	close(c.done)
+
+	g.mu.Lock()
+	if g.m[key] == c {
+		delete(g.m, key) //更新g.m
+	}
+	g.mu.Unlock()
+}
+
+// FlyMulti 是批量版本的FlyContext 返回的vals/errs与keys一一对应
+// keys中还没有起飞的key合并为一次fn调用 fn返回的结果需与传入的keys一一对应
+// 已经在飞的key(例如并发的单key请求)直接等待那次flight 不会被重复加载
+func (g *Flight) FlyMulti(ctx context.Context, keys []string, fn func(ctx context.Context, keys []string) ([]interface{}, []error)) ([]interface{}, []error) {
+	calls := make([]*call, len(keys))
+	waiters := make([]*waiter, len(keys))
+	var leaders []string
+	var leaderCalls []*call
+	// 同一批的leader共享一个ctx 所有leader的等待者都放弃后才会被cancel
+	batch := newFlightCtx(ctx)
+
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[string]*call)
+	}
+	for i, key := range keys {
+		c, ok := g.m[key]
+		if !ok || c.ctx.Err() != nil {
+			c = &call{done: make(chan struct{}), ctx: batch}
+			g.m[key] = c
+			leaders = append(leaders, key)
+			leaderCalls = append(leaderCalls, c)
+		}
+		c.refs++
+		waiters[i] = c.ctx.join(ctx)
+		calls[i] = c
 	}
-	c := new(call)
-	c.wg.Add(1)
-	g.m[key] = c
 	g.mu.Unlock()
 
-	c.val, c.err = fn()
-	c.wg.Done()
+	if len(leaders) > 0 {
+		go g.doBatch(batch, leaders, leaderCalls, fn)
+	}
+
+	vals := make([]interface{}, len(keys))
+	errs := make([]error, len(keys))
+	for i, c := range calls {
+		vals[i], errs[i] = g.wait(ctx, keys[i], c, waiters[i])
+	}
+	return vals, errs
+}
+
+func (g *Flight) doBatch(ctx *flightCtx, keys []string, calls []*call, fn func(ctx context.Context, keys []string) ([]interface{}, []error)) {
+	vals, errs := fn(ctx, keys)
+	for i, c := range calls {
+		if i < len(vals) {
+			c.val = vals[i]
+		}
+		if i < len(errs) {
+			c.err = errs[i]
+		}
+		close(c.done)
+	}
+	ctx.cancel(context.Canceled)
 
 	g.mu.Lock()
-	delete(g.m, key) //更新g.m
+	for i, key := range keys {
+		if g.m[key] == calls[i] {
+			delete(g.m, key)
+		}
+	}
 	g.mu.Unlock()
+}
+
+// InFlight 返回正在进行的flight数量
+func (g *Flight) InFlight() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.m)
+}
 
-	return c.val, c.err
+// wait 等待c完成 ctx结束时放弃等待
+func (g *Flight) wait(ctx context.Context, key string, c *call, w *waiter) (interface{}, error) {
+	select {
+	case <-c.done:
+		return c.val, c.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		c.refs--
+		if c.refs == 0 && g.m[key] == c {
+			// 没有人再等待这次flight 让后来者重新起飞
+			delete(g.m, key)
+		}
+		g.mu.Unlock()
+		// 最后一个等待者离开时取消flight
+		c.ctx.leave(w)
+		return nil, ctx.Err()
+	}
 }
@@ -0,0 +1,229 @@
+package singleflight
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFlyDedup(t *testing.T) {
+	var g Flight
+	var calls int32
+	release := make(chan struct{})
+	fn := func(context.Context) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "v", nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := g.FlyContext(context.Background(), "key", fn)
+			if err != nil || v != "v" {
+				t.Errorf("expect v, got %v %v", v, err)
+			}
+		}()
+	}
+	waitInFlight(t, &g, 1)
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatalf("expect fn to be called once, got %d", n)
+	}
+	if n := g.InFlight(); n != 0 {
+		t.Fatalf("expect no flight left, got %d", n)
+	}
+}
+
+func TestFlyLastWaiterCancel(t *testing.T) {
+	var g Flight
+	started := make(chan context.Context, 1)
+	fn := func(ctx context.Context) (interface{}, error) {
+		started <- ctx
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	errs := make(chan error, 2)
+	go func() {
+		_, err := g.FlyContext(ctx1, "key", fn)
+		errs <- err
+	}()
+	flight := <-started
+	go func() {
+		_, err := g.FlyContext(ctx2, "key", fn)
+		errs <- err
+	}()
+	waitRefs(t, &g, "key", 2)
+
+	// 一个等待者放弃不影响flight
+	cancel1()
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expect canceled, got %v", err)
+	}
+	select {
+	case <-flight.Done():
+		t.Fatal("flight should not be canceled while a waiter remains")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// 最后一个等待者放弃 flight被cancel
+	cancel2()
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expect canceled, got %v", err)
+	}
+	select {
+	case <-flight.Done():
+	case <-time.After(time.Second):
+		t.Fatal("flight should be canceled after the last waiter leaves")
+	}
+	if !errors.Is(flight.Err(), context.Canceled) {
+		t.Fatalf("expect canceled, got %v", flight.Err())
+	}
+}
+
+func TestFlyDeadline(t *testing.T) {
+	var g Flight
+	started := make(chan context.Context, 1)
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (interface{}, error) {
+		started <- ctx
+		<-release
+		return "v", nil
+	}
+
+	now := time.Now()
+	ctx1, cancel1 := context.WithDeadline(context.Background(), now.Add(time.Hour))
+	defer cancel1()
+	go g.FlyContext(ctx1, "key", fn)
+	flight := <-started
+	if d, ok := flight.Deadline(); !ok || !d.Equal(now.Add(time.Hour)) {
+		t.Fatalf("expect the caller's deadline, got %v %v", d, ok)
+	}
+
+	// 取仍在等待的调用方中最晚的deadline
+	ctx2, cancel2 := context.WithDeadline(context.Background(), now.Add(2*time.Hour))
+	done2 := make(chan struct{})
+	go func() {
+		g.FlyContext(ctx2, "key", fn)
+		close(done2)
+	}()
+	waitRefs(t, &g, "key", 2)
+	if d, _ := flight.Deadline(); !d.Equal(now.Add(2 * time.Hour)) {
+		t.Fatalf("expect the latest deadline, got %v", d)
+	}
+
+	// 有调用方没有deadline时flight也没有deadline
+	ctx3, cancel3 := context.WithCancel(context.Background())
+	done3 := make(chan struct{})
+	go func() {
+		g.FlyContext(ctx3, "key", fn)
+		close(done3)
+	}()
+	waitRefs(t, &g, "key", 3)
+	if _, ok := flight.Deadline(); ok {
+		t.Fatal("expect no deadline while a waiter has none")
+	}
+
+	// 等待者离开后重新计算
+	cancel3()
+	<-done3
+	if d, _ := flight.Deadline(); !d.Equal(now.Add(2 * time.Hour)) {
+		t.Fatalf("expect the latest remaining deadline, got %v", d)
+	}
+	cancel2()
+	<-done2
+	if d, _ := flight.Deadline(); !d.Equal(now.Add(time.Hour)) {
+		t.Fatalf("expect the remaining deadline, got %v", d)
+	}
+	close(release)
+}
+
+func TestFlyDeadlineExceeded(t *testing.T) {
+	var g Flight
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	// 唯一的调用方到达deadline后 flight的ctx随之结束
+	flightErr := make(chan error, 1)
+	_, err := g.FlyContext(ctx, "key", func(ctx context.Context) (interface{}, error) {
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+		}
+		flightErr <- ctx.Err()
+		return nil, ctx.Err()
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect deadline exceeded, got %v", err)
+	}
+	if err := <-flightErr; err == nil {
+		t.Fatal("expect the flight to be done with the caller's deadline")
+	}
+}
+
+func TestFlyMultiDedup(t *testing.T) {
+	var g Flight
+	release := make(chan struct{})
+	go g.FlyContext(context.Background(), "a", func(context.Context) (interface{}, error) {
+		<-release
+		return "single", nil
+	})
+	waitInFlight(t, &g, 1)
+
+	var batched []string
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(release)
+	}()
+	vals, errs := g.FlyMulti(context.Background(), []string{"a", "b"}, func(ctx context.Context, keys []string) ([]interface{}, []error) {
+		batched = keys
+		return []interface{}{"batch"}, nil
+	})
+	if len(batched) != 1 || batched[0] != "b" {
+		t.Fatalf("expect only b to be batched, got %v", batched)
+	}
+	if vals[0] != "single" || vals[1] != "batch" || errs[0] != nil || errs[1] != nil {
+		t.Fatalf("unexpected result %v %v", vals, errs)
+	}
+}
+
+func waitInFlight(t *testing.T, g *Flight, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for g.InFlight() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expect %d flights, got %d", n, g.InFlight())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func waitRefs(t *testing.T, g *Flight, key string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		g.mu.Lock()
+		c := g.m[key]
+		refs := 0
+		if c != nil {
+			refs = c.refs
+		}
+		g.mu.Unlock()
+		if refs == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expect %d waiters, got %d", n, refs)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,188 @@
+package geecache
+
+import (
+	pb "GeeCache/geecache/geecachepb"
+	"GeeCache/geecache/logger"
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// CacheStats mainCache或hotCache的统计
+type CacheStats struct {
+	Entries     int64
+	Bytes       int64
+	MaxBytes    int64
+	Hits        int64
+	Misses      int64
+	Evictions   int64
+	Expirations int64
+}
+
+// GroupStats Group的统计 Hot为nil表示没有开启hotCache
+type GroupStats struct {
+	Name         string
+	Main         CacheStats
+	Hot          *CacheStats
+	HitRatio     float64 // 命中mainCache或hotCache的查找占全部查找的比例
+	Loads        int64   // 未命中后的加载次数
+	LoadsDeduped int64   // 其中复用了其他请求加载结果的次数
+	InFlight     int     // 正在进行的加载
+}
+
+// snapshot 返回cache当前的统计
+func (c *cache) snapshot() CacheStats {
+	return CacheStats{
+		Entries:     c.stats.entries.Load(),
+		Bytes:       c.stats.bytes.Load(),
+		MaxBytes:    int64(c.cacheBytes),
+		Hits:        c.stats.hits.Load(),
+		Misses:      c.stats.misses.Load(),
+		Evictions:   c.stats.evictions.Load(),
+		Expirations: c.stats.expirations.Load(),
+	}
+}
+
+// Stats 返回Group当前的统计
+func (g *Group) Stats() GroupStats {
+	stats := GroupStats{
+		Name:         g.name,
+		Main:         g.mainCache.snapshot(),
+		Loads:        g.loads.Load(),
+		LoadsDeduped: g.loadsDeduped.Load(),
+		InFlight:     g.loader.InFlight(),
+	}
+	hits := stats.Main.Hits
+	if g.hotCache != nil {
+		hot := g.hotCache.snapshot()
+		stats.Hot = &hot
+		hits += hot.Hits
+	}
+	// 每次查找都先经过mainCache 只有mainCache未命中时才查找hotCache
+	if lookups := stats.Main.Hits + stats.Main.Misses; lookups > 0 {
+		stats.HitRatio = float64(hits) / float64(lookups)
+	}
+	return stats
+}
+
+// PeerStats 哈希环上的一个节点
+type PeerStats struct {
+	Addr      string
+	Self      bool
+	Ownership float64      // 该节点负责的key的比例
+	Breaker   BreakerState // 本节点访问该节点的熔断器状态 Self为true时无意义
+}
+
+// ownershipSamples 估算各节点负责的key的比例时使用的样本数
+// 放置算法各不相同 通过采样统一估算
+const ownershipSamples = 4096
+
+// RingStats 返回哈希环上的所有节点(包括自己) 按地址排序
+func (s *server) RingStats() []PeerStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.placer == nil {
+		return []PeerStats{{Addr: s.addr, Self: true, Ownership: 1}}
+	}
+	owned := make(map[string]int)
+	for i := 0; i < ownershipSamples; i++ {
+		owned[s.placer.Get(strconv.Itoa(i))]++
+	}
+	peers := []PeerStats{{Addr: s.addr, Self: true}}
+	for addr, client := range s.clients {
+		if addr != s.addr {
+			peers = append(peers, PeerStats{Addr: addr, Breaker: client.BreakerState()})
+		}
+	}
+	for i := range peers {
+		peers[i].Ownership = float64(owned[peers[i].Addr]) / ownershipSamples
+	}
+	sort.Slice(peers, func(i, j int) bool {
+		return peers[i].Addr < peers[j].Addr
+	})
+	return peers
+}
+
+// Stats 返回本节点各Group的统计与当前的哈希环
+// 开启认证时 调用方没有读权限的Group不会出现在结果中
+func (s *server) Stats(ctx context.Context, in *pb.StatsRequest) (*pb.StatsResponse, error) {
+	if logger.Enabled(s.log(), logger.LevelDebug) {
+		s.log().Debug("recv rpc Stats", "addr", s.addr, "group", in.GetGroup())
+	}
+	var groups []*Group
+	if name := in.GetGroup(); name != "" {
+		g := s.group(name)
+		if g == nil {
+			return nil, fmt.Errorf("group not found")
+		}
+		groups = []*Group{g}
+	} else {
+		groups = s.groupList()
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].name < groups[j].name
+	})
+
+	resp := &pb.StatsResponse{Addr: s.addr}
+	id, authed := IdentityFromContext(ctx)
+	for _, g := range groups {
+		if authed && g.acl != nil && !g.acl.Allow(id.Name, PermRead) {
+			continue
+		}
+		resp.Groups = append(resp.Groups, groupStatsToPB(g.Stats()))
+	}
+	for _, peer := range s.RingStats() {
+		resp.Peers = append(resp.Peers, peerStatsToPB(peer))
+	}
+	return resp, nil
+}
+
+// Stats 获取peer上的统计 group为空时返回所有Group 用于汇总整个集群的状态
+func (c *Client) Stats(ctx context.Context, group string) (*pb.StatsResponse, error) {
+	var resp *pb.StatsResponse
+	err := c.call(ctx, func(ctx context.Context, grpcClient pb.GroupCacheClient) error {
+		var err error
+		resp, err = grpcClient.Stats(ctx, &pb.StatsRequest{Group: group})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not get stats from peer %s: %w", c.name, err)
+	}
+	return resp, nil
+}
+
+func cacheStatsToPB(c CacheStats) *pb.CacheStats {
+	return &pb.CacheStats{
+		Entries:     c.Entries,
+		Bytes:       c.Bytes,
+		MaxBytes:    c.MaxBytes,
+		Hits:        c.Hits,
+		Misses:      c.Misses,
+		Evictions:   c.Evictions,
+		Expirations: c.Expirations,
+	}
+}
+
+func groupStatsToPB(g GroupStats) *pb.GroupStats {
+	out := &pb.GroupStats{
+		Name:         g.Name,
+		Main:         cacheStatsToPB(g.Main),
+		HitRatio:     g.HitRatio,
+		Loads:        g.Loads,
+		LoadsDeduped: g.LoadsDeduped,
+		InFlight:     int64(g.InFlight),
+	}
+	if g.Hot != nil {
+		out.Hot = cacheStatsToPB(*g.Hot)
+	}
+	return out
+}
+
+func peerStatsToPB(p PeerStats) *pb.PeerStats {
+	out := &pb.PeerStats{Addr: p.Addr, Ownership: p.Ownership}
+	if !p.Self {
+		out.Breaker = p.Breaker.String()
+	}
+	return out
+}
@@ -0,0 +1,105 @@
+package geecache
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGroupStats(t *testing.T) {
+	release := make(chan struct{})
+	g := NewGroup("stats", 1<<10, GetterFunc(func(key string) (ByteView, error) {
+		if key == "slow" {
+			<-release
+		}
+		return NewByteView([]byte("0123456789")), nil
+	}))
+	g.SetHotCache(1 << 9)
+
+	for i := 0; i < 4; i++ {
+		g.Get("k0")
+	}
+	g.Get("k1")
+	g.hotCache.add("k2", NewByteView([]byte("hot")))
+	g.Get("k2")
+
+	stats := g.Stats()
+	if stats.Name != "stats" || stats.Main.Entries != 2 || stats.Main.Bytes != 24 || stats.Main.MaxBytes != 1<<10 {
+		t.Fatalf("unexpected main cache stats %+v", stats.Main)
+	}
+	if stats.Hot == nil || stats.Hot.Entries != 1 || stats.Hot.Hits != 1 || stats.Hot.MaxBytes != 1<<9 {
+		t.Fatalf("unexpected hot cache stats %+v", stats.Hot)
+	}
+	// 6次查找 k0命中3次 k2命中hotCache
+	if stats.Loads != 2 || math.Abs(stats.HitRatio-4.0/6) > 1e-9 {
+		t.Fatalf("expect 2 loads and hit ratio 4/6, got %+v", stats)
+	}
+	// 内部的查找不计入命中率
+	g.handoffLocally("k3", NewByteView([]byte("moved")))
+	g.mainCache.peek("k0")
+	if ratio := g.Stats().HitRatio; ratio != stats.HitRatio {
+		t.Fatalf("internal lookups should not change hit ratio, got %v", ratio)
+	}
+
+	go g.Get("slow")
+	deadline := time.Now().Add(2 * time.Second)
+	for g.Stats().InFlight != 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := g.Stats().InFlight; n != 1 {
+		t.Fatalf("expect 1 in-flight load, got %d", n)
+	}
+	close(release)
+}
+
+func TestStatsRPC(t *testing.T) {
+	const (
+		addrA = "127.0.0.1:9501"
+		addrB = "127.0.0.1:9502"
+	)
+	var originA, originB int32
+	gA := NewGroup("stats-rpc", 1<<20, countingGetter(&originA))
+	gB := NewGroup("stats-rpc", 1<<20, countingGetter(&originB))
+	cluster := newBufNet()
+	a := cluster.node(t, addrA, map[string]*Group{"stats-rpc": gA})
+	b := cluster.node(t, addrB, map[string]*Group{"stats-rpc": gB})
+	a.SetPeers(addrA, addrB)
+	b.SetPeers(addrA, addrB)
+	gA.RegisterSvr(a)
+	gB.RegisterSvr(b)
+	for i := 0; i < 20; i++ {
+		gA.Get(fmt.Sprintf("key%d", i))
+	}
+
+	resp, err := a.clients[addrB].Stats(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.GetAddr() != addrB || len(resp.GetGroups()) != 1 {
+		t.Fatalf("unexpected response %v", resp)
+	}
+	group, loads := resp.GetGroups()[0], int64(atomic.LoadInt32(&originB))
+	if group.GetName() != "stats-rpc" || loads == 0 || group.GetLoads() != loads || group.GetMain().GetEntries() != loads {
+		t.Fatalf("expect %d entries loaded on B, got %v", loads, group)
+	}
+	if group.GetHot() != nil {
+		t.Fatal("hot cache is not enabled")
+	}
+
+	// 哈希环上的所有节点 各自负责的比例之和为1
+	var total float64
+	for _, peer := range resp.GetPeers() {
+		total += peer.GetOwnership()
+	}
+	if len(resp.GetPeers()) != 2 || resp.GetPeers()[0].GetAddr() != addrA || resp.GetPeers()[0].GetBreaker() != "closed" ||
+		math.Abs(total-1) > 1e-9 {
+		t.Fatalf("unexpected peers %v", resp.GetPeers())
+	}
+
+	if _, err := a.clients[addrB].Stats(context.Background(), "unknown"); err == nil {
+		t.Fatal("expect error for unknown group")
+	}
+}
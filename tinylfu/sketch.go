@@ -0,0 +1,115 @@
+package tinylfu
+
+// cmSketch 是count-min sketch 用于以很小的内存估计key的访问频率
+// 共depth行计数器 每个key在每行命中一个计数器 估计值取各行的最小值
+// 计数器上限为15(与Caffeine的4bit计数器一致) 使频率估计更关注"近期是否热"
+
+const (
+	sketchDepth = 4
+	maxCounter  = 15
+)
+
+type cmSketch struct {
+	rows [sketchDepth][]uint8
+	mask uint64
+}
+
+// newCMSketch width会向上取整为2的幂
+func newCMSketch(width int) *cmSketch {
+	width = nextPowerOfTwo(width)
+	s := &cmSketch{mask: uint64(width - 1)}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+// index 使用双重散列 由一个64位hash派生出每行的下标
+func (s *cmSketch) index(hash uint64, row int) uint64 {
+	h1, h2 := hash, hash>>32|hash<<32
+	return (h1 + uint64(row)*h2) & s.mask
+}
+
+func (s *cmSketch) Increment(hash uint64) {
+	for i := range s.rows {
+		idx := s.index(hash, i)
+		if s.rows[i][idx] < maxCounter {
+			s.rows[i][idx]++
+		}
+	}
+}
+
+func (s *cmSketch) Estimate(hash uint64) uint8 {
+	est := uint8(maxCounter)
+	for i := range s.rows {
+		if v := s.rows[i][s.index(hash, i)]; v < est {
+			est = v
+		}
+	}
+	return est
+}
+
+// Reset 将所有计数器减半 让过去的热度随时间衰减(老化)
+func (s *cmSketch) Reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+}
+
+// doorkeeper 是一个布隆过滤器 只出现过一次的key只记录在这里
+// 避免大量一次性key污染sketch
+type doorkeeper struct {
+	bits []uint64
+	mask uint64
+}
+
+const doorkeeperHashes = 3
+
+func newDoorkeeper(nbits int) *doorkeeper {
+	nbits = nextPowerOfTwo(max(nbits, 64))
+	return &doorkeeper{
+		bits: make([]uint64, nbits/64),
+		mask: uint64(nbits - 1),
+	}
+}
+
+// Allow 将hash加入过滤器 返回加入之前是否已经存在
+func (d *doorkeeper) Allow(hash uint64) bool {
+	h1, h2 := hash, hash>>32|hash<<32
+	present := true
+	for i := uint64(0); i < doorkeeperHashes; i++ {
+		bit := (h1 + i*h2) & d.mask
+		if d.bits[bit/64]&(1<<(bit%64)) == 0 {
+			present = false
+			d.bits[bit/64] |= 1 << (bit % 64)
+		}
+	}
+	return present
+}
+
+func (d *doorkeeper) Has(hash uint64) bool {
+	h1, h2 := hash, hash>>32|hash<<32
+	for i := uint64(0); i < doorkeeperHashes; i++ {
+		bit := (h1 + i*h2) & d.mask
+		if d.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *doorkeeper) Reset() {
+	for i := range d.bits {
+		d.bits[i] = 0
+	}
+}
+
+func nextPowerOfTwo(n int) int {
+	p := 1
+	for p < n {
+		p <<= 1
+	}
+	return p
+}
@@ -0,0 +1,222 @@
+package tinylfu
+
+import (
+	"GeeCache/geecache/policy"
+	"time"
+)
+
+// W-TinyLFU 准入策略
+// 新key先进入一个很小的LRU窗口(window) 从窗口淘汰出来的key成为候选者
+// 若主缓存(main)已满 候选者需要与main的victim比较访问频率 只有更"热"才被接纳
+// 否则候选者直接被丢弃 这样批量扫描整个keyspace时 一次性的key无法挤掉热key
+//
+// 访问频率由TinyLFU估计: doorkeeper(布隆过滤器) + count-min sketch
+// 每记录sampleSize次访问 sketch计数器减半、doorkeeper清空 使历史热度逐渐衰减
+//
+// Warning: 与policy包一样 不提供并发一致机制
+
+const (
+	// 窗口占总容量的比例
+	windowRatio = 0.01
+	// 假设的平均条目大小 用于由字节容量推算sketch的宽度
+	avgEntryBytes = 64
+	minCounters   = 1024
+	// 每记录 sampleFactor*counters 次访问后老化一次
+	sampleFactor = 10
+)
+
+// TinyLFU 是近似的访问频率估计器
+type TinyLFU struct {
+	sketch     *cmSketch
+	door       *doorkeeper
+	samples    int
+	sampleSize int
+}
+
+// NewTinyLFU counters为sketch每行计数器的数量 应与缓存的条目数相当
+func NewTinyLFU(counters int) *TinyLFU {
+	counters = max(counters, minCounters)
+	sampleSize := sampleFactor * counters
+	return &TinyLFU{
+		sketch:     newCMSketch(counters),
+		door:       newDoorkeeper(4 * sampleSize),
+		sampleSize: sampleSize,
+	}
+}
+
+// Record 记录一次对key的访问
+// 第一次出现的key只进入doorkeeper 再次出现才计入sketch
+func (t *TinyLFU) Record(key string) {
+	h := hash(key)
+	if t.door.Allow(h) {
+		t.sketch.Increment(h)
+	}
+	t.samples++
+	if t.samples >= t.sampleSize {
+		t.reset()
+	}
+}
+
+// Estimate 返回key的估计访问频率
+func (t *TinyLFU) Estimate(key string) int {
+	h := hash(key)
+	est := int(t.sketch.Estimate(h))
+	if t.door.Has(h) {
+		est++
+	}
+	return est
+}
+
+// Admit 判断candidate是否值得替换掉victim
+func (t *TinyLFU) Admit(candidate, victim string) bool {
+	return t.Estimate(candidate) > t.Estimate(victim)
+}
+
+func (t *TinyLFU) reset() {
+	t.samples /= 2
+	t.sketch.Reset()
+	t.door.Reset()
+}
+
+// Cache 是带有W-TinyLFU准入过滤的policy.Policy
+type Cache struct {
+	window    policy.Policy
+	main      policy.Policy
+	mainBytes int
+	inMain    map[string]struct{}
+	filter    *TinyLFU
+	onEvicted func(key string, value policy.Value)
+	removing  bool // 显式删除时 window淘汰出的key不参与准入
+}
+
+// New 创建W-TinyLFU缓存 newMain为主缓存使用的淘汰算法
+// 主缓存实现了policy.Victimer时才会进行准入比较 否则总是接纳候选者
+func New(maxBytes int, newMain policy.Factory, onEvicted func(string, policy.Value)) *Cache {
+	if newMain == nil {
+		newMain = policy.LRU
+	}
+	windowBytes := 0
+	if maxBytes != 0 {
+		windowBytes = max(1, int(windowRatio*float64(maxBytes)))
+	}
+	c := &Cache{
+		mainBytes: maxBytes - windowBytes,
+		inMain:    make(map[string]struct{}),
+		filter:    NewTinyLFU(maxBytes / avgEntryBytes),
+		onEvicted: onEvicted,
+	}
+	c.window = policy.LRU(windowBytes, c.onWindowEvicted)
+	c.main = newMain(c.mainBytes, c.onMainEvicted)
+	return c
+}
+
+// Wrap 返回在newMain前加上W-TinyLFU准入过滤的工厂
+func Wrap(newMain policy.Factory) policy.Factory {
+	return func(maxBytes int, onEvicted func(key string, value policy.Value)) policy.Policy {
+		return New(maxBytes, newMain, onEvicted)
+	}
+}
+
+func (c *Cache) Get(key string) (value policy.Value, ok bool) {
+	c.filter.Record(key)
+	if _, ok := c.inMain[key]; ok {
+		return c.main.Get(key)
+	}
+	return c.window.Get(key)
+}
+
+func (c *Cache) Add(key string, value policy.Value) {
+	if _, ok := c.inMain[key]; ok {
+		c.main.Add(key, value)
+		return
+	}
+	c.window.Add(key, value)
+}
+
+// onWindowEvicted 从窗口淘汰的key与main的victim竞争
+func (c *Cache) onWindowEvicted(key string, value policy.Value) {
+	if c.removing || isExpired(value) {
+		c.evicted(key, value)
+		return
+	}
+	if c.main.Bytes()+len(key)+value.Len() > c.mainBytes {
+		if v, ok := c.main.(policy.Victimer); ok {
+			if victim, ok := v.Victim(); ok && !c.filter.Admit(key, victim) {
+				c.evicted(key, value)
+				return
+			}
+		}
+	}
+	c.inMain[key] = struct{}{}
+	c.main.Add(key, value)
+}
+
+func (c *Cache) onMainEvicted(key string, value policy.Value) {
+	delete(c.inMain, key)
+	c.evicted(key, value)
+}
+
+func (c *Cache) evicted(key string, value policy.Value) {
+	if c.onEvicted != nil {
+		c.onEvicted(key, value)
+	}
+}
+
+func (c *Cache) Remove(key string) {
+	c.removing = true
+	c.window.Remove(key)
+	c.main.Remove(key)
+	c.removing = false
+}
+
+// RemoveExpired 依次清理窗口与主缓存中的过期键
+func (c *Cache) RemoveExpired(n int) int {
+	removed := 0
+	for _, p := range []policy.Policy{c.window, c.main} {
+		if e, ok := p.(policy.Expirer); ok && removed < n {
+			removed += e.RemoveExpired(n - removed)
+		}
+	}
+	return removed
+}
+
+// Range 依次遍历窗口与主缓存
+func (c *Cache) Range(fn func(key string, value policy.Value) bool) {
+	stopped := false
+	for _, p := range []policy.Policy{c.window, c.main} {
+		r, ok := p.(policy.Ranger)
+		if !ok || stopped {
+			continue
+		}
+		r.Range(func(key string, value policy.Value) bool {
+			stopped = !fn(key, value)
+			return !stopped
+		})
+	}
+}
+
+func (c *Cache) Len() int {
+	return c.window.Len() + c.main.Len()
+}
+
+func (c *Cache) Bytes() int {
+	return c.window.Bytes() + c.main.Bytes()
+}
+
+func isExpired(value policy.Value) bool {
+	return !value.Expire().IsZero() && value.Expire().Before(time.Now())
+}
+
+// hash 为FNV-1a 避免[]byte(key)带来的内存分配
+func hash(key string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= 1099511628211
+	}
+	return h
+}
+
+var _ policy.Policy = (*Cache)(nil)
+var _ policy.Expirer = (*Cache)(nil)
+var _ policy.Ranger = (*Cache)(nil)
@@ -0,0 +1,152 @@
+package tinylfu
+
+import (
+	"GeeCache/geecache/policy"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+func (d String) Expire() time.Time {
+	return time.Time{}
+}
+
+func TestEstimate(t *testing.T) {
+	f := NewTinyLFU(minCounters)
+	f.Record("Tom")
+	if f.Estimate("Tom") != 1 {
+		t.Fatalf("first access should only be recorded by doorkeeper, got %d", f.Estimate("Tom"))
+	}
+	for i := 0; i < 5; i++ {
+		f.Record("Tom")
+	}
+	if f.Estimate("Tom") != 6 || f.Estimate("Jack") != 0 {
+		t.Fatalf("expect Tom=6 Jack=0, got %d %d", f.Estimate("Tom"), f.Estimate("Jack"))
+	}
+	if !f.Admit("Tom", "Jack") || f.Admit("Jack", "Tom") {
+		t.Fatal("Tom should be admitted over Jack")
+	}
+}
+
+func TestAging(t *testing.T) {
+	f := NewTinyLFU(minCounters)
+	for i := 0; i < 9; i++ {
+		f.Record("Tom")
+	}
+	before := f.Estimate("Tom")
+	// 填满一个采样周期触发老化
+	for i := 0; i < f.sampleSize; i++ {
+		f.Record(fmt.Sprintf("cold%d", i))
+	}
+	if after := f.Estimate("Tom"); after >= before || after == 0 {
+		t.Fatalf("estimate should be halved by aging, %d -> %d", before, after)
+	}
+}
+
+func TestAdmission(t *testing.T) {
+	var evicted []string
+	c := New(1000, policy.LRU, func(key string, value policy.Value) {
+		evicted = append(evicted, key)
+	})
+	getOrAdd := func(key string) {
+		if _, ok := c.Get(key); !ok {
+			c.Add(key, String("value"))
+		}
+	}
+	for round := 0; round < 10; round++ {
+		for i := 0; i < 50; i++ {
+			getOrAdd(fmt.Sprintf("hot%02d", i))
+		}
+	}
+	for i := 0; i < 1000; i++ {
+		getOrAdd(fmt.Sprintf("scan%04d", i))
+	}
+	for i := 0; i < 50; i++ {
+		if _, ok := c.Get(fmt.Sprintf("hot%02d", i)); !ok {
+			t.Fatalf("hot%02d was flushed by scan", i)
+		}
+	}
+	if c.Bytes() > 1000 {
+		t.Fatalf("used %d bytes, exceeds 1000", c.Bytes())
+	}
+	if len(evicted) == 0 {
+		t.Fatal("rejected candidates should be reported as evicted")
+	}
+
+	c.Remove("hot00")
+	if _, ok := c.Get("hot00"); ok {
+		t.Fatal("hot00 should be removed")
+	}
+}
+
+// 合成的访问序列
+func zipfTrace(n, keys int) []string {
+	r := rand.New(rand.NewSource(1))
+	z := rand.NewZipf(r, 1.01, 1, uint64(keys-1))
+	trace := make([]string, n)
+	for i := range trace {
+		trace[i] = fmt.Sprintf("key%d", z.Uint64())
+	}
+	return trace
+}
+
+// scanTrace 在zipf访问中周期性地插入对冷数据的顺序扫描
+func scanTrace(n, keys int) []string {
+	zipf := zipfTrace(n, keys)
+	trace := make([]string, 0, 2*n)
+	scan := 0
+	for i, key := range zipf {
+		trace = append(trace, key)
+		if i%1000 == 999 {
+			for j := 0; j < 1000; j++ {
+				trace = append(trace, fmt.Sprintf("scan%d", scan))
+				scan++
+			}
+		}
+	}
+	return trace
+}
+
+func hitRatio(p policy.Policy, trace []string) float64 {
+	hits := 0
+	for _, key := range trace {
+		if _, ok := p.Get(key); ok {
+			hits++
+		} else {
+			p.Add(key, String("value"))
+		}
+	}
+	return float64(hits) / float64(len(trace))
+}
+
+// go test -bench HitRatio -run ^$ ./tinylfu
+func BenchmarkHitRatio(b *testing.B) {
+	const cacheBytes = 1000 * 16 // 约1000个条目
+	traces := map[string][]string{
+		"zipf": zipfTrace(200000, 100000),
+		"scan": scanTrace(200000, 100000),
+	}
+	factories := map[string]policy.Factory{
+		"lru":         policy.LRU,
+		"tinylfu-lru": Wrap(policy.LRU),
+		"lfu":         policy.LFU,
+		"tinylfu-lfu": Wrap(policy.LFU),
+	}
+	for traceName, trace := range traces {
+		for name, factory := range factories {
+			b.Run(traceName+"/"+name, func(b *testing.B) {
+				var ratio float64
+				for i := 0; i < b.N; i++ {
+					ratio = hitRatio(factory(cacheBytes, nil), trace)
+				}
+				b.ReportMetric(100*ratio, "hit%")
+			})
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package geecache
+
+import (
+	"GeeCache/geecache/logger"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TLSConfig 节点之间以及外部客户端与节点之间的TLS配置
+type TLSConfig struct {
+	CertFile string // PEM格式的证书(链)
+	KeyFile  string // PEM格式的私钥
+	CAFile   string // 校验对端证书的CA 为空时使用系统CA
+
+	// Mutual 为true时服务端要求并校验客户端证书(mTLS) 此时CAFile不能为空
+	Mutual bool
+	// AllowedSANs 非空时对端证书的DNS/IP/URI SAN至少有一个在列表中
+	// 支持"*.example.com"形式的通配符 只匹配一级子域名
+	AllowedSANs []string
+
+	// ReloadInterval 每隔多久检查一次证书文件是否被替换 0表示不重新加载
+	ReloadInterval time.Duration
+}
+
+// certReloader 持有当前的证书与CA 文件被替换(mtime变化)后在下一次握手时重新加载
+// 重新加载失败时继续使用旧的证书
+type certReloader struct {
+	cfg TLSConfig
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	roots   *x509.CertPool
+	modTime time.Time // 已加载文件中最新的mtime
+	checked time.Time
+	now     func() time.Time
+	logger  logger.Logger
+}
+
+func newCertReloader(cfg TLSConfig) (*certReloader, error) {
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, errors.New("tls: cert and key files are required")
+	}
+	if cfg.Mutual && cfg.CAFile == "" {
+		return nil, errors.New("tls: mutual TLS requires a CA file")
+	}
+	r := &certReloader{cfg: cfg, now: time.Now, logger: logger.Default()}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// load 读取证书、私钥与CA
+func (r *certReloader) load() error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("tls: load key pair: %w", err)
+	}
+	var roots *x509.CertPool
+	if r.cfg.CAFile != "" {
+		pem, err := os.ReadFile(r.cfg.CAFile)
+		if err != nil {
+			return fmt.Errorf("tls: read CA: %w", err)
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("tls: no certificate found in %s", r.cfg.CAFile)
+		}
+	}
+	r.mu.Lock()
+	r.cert, r.roots, r.modTime = &cert, roots, modTime
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, name := range []string{r.cfg.CertFile, r.cfg.KeyFile, r.cfg.CAFile} {
+		if name == "" {
+			continue
+		}
+		info, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("tls: %w", err)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// current 返回当前的证书与CA 距上次检查超过ReloadInterval且文件有变化时重新加载
+func (r *certReloader) current() (*tls.Certificate, *x509.CertPool) {
+	r.mu.Lock()
+	reload := false
+	if r.cfg.ReloadInterval > 0 && r.now().Sub(r.checked) >= r.cfg.ReloadInterval {
+		r.checked = r.now()
+		modTime, err := r.latestModTime()
+		reload = err == nil && !modTime.Equal(r.modTime)
+	}
+	r.mu.Unlock()
+	if reload {
+		if err := r.load(); err != nil {
+			r.logger.Error("fail to reload certificate, keep the old one", "cert", r.cfg.CertFile, "err", err)
+		} else {
+			r.logger.Info("reload certificate", "cert", r.cfg.CertFile)
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cert, r.roots
+}
+
+// serverConfig 每次握手通过GetConfigForClient取得最新的证书与CA
+func (r *certReloader) serverConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, roots := r.current()
+			cfg := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				NextProtos:   []string{"h2"},
+				Certificates: []tls.Certificate{*cert},
+			}
+			if r.cfg.Mutual {
+				cfg.ClientAuth = tls.RequireAndVerifyClientCert
+				cfg.ClientCAs = roots
+				cfg.VerifyPeerCertificate = r.verifySAN
+			}
+			return cfg, nil
+		},
+	}
+}
+
+// clientConfig 证书通过GetClientCertificate取得 CA在建立连接时确定
+func (r *certReloader) clientConfig() *tls.Config {
+	_, roots := r.current()
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		RootCAs:    roots,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, _ := r.current()
+			return cert, nil
+		},
+		VerifyPeerCertificate: r.verifySAN,
+	}
+}
+
+// creds 每次调用都使用最新的CA 供新建立的连接使用
+func (r *certReloader) creds() credentials.TransportCredentials {
+	return credentials.NewTLS(r.clientConfig())
+}
+
+// dial 以TLS直接连接target
+func (r *certReloader) dial(ctx context.Context, target string) (*grpc.ClientConn, error) {
+	return grpc.DialContext(ctx, target,
+		grpc.WithTransportCredentials(r.creds()),
+		grpc.WithBlock(),
+	)
+}
+
+// verifySAN 在标准的证书链校验之后检查对端证书的SAN
+func (r *certReloader) verifySAN(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+	if len(r.cfg.AllowedSANs) == 0 {
+		return nil
+	}
+	if len(verifiedChains) == 0 || len(verifiedChains[0]) == 0 {
+		return errors.New("tls: no verified peer certificate")
+	}
+	leaf := verifiedChains[0][0]
+	sans := make([]string, 0, len(leaf.DNSNames)+len(leaf.IPAddresses)+len(leaf.URIs))
+	sans = append(sans, leaf.DNSNames...)
+	for _, ip := range leaf.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	for _, uri := range leaf.URIs {
+		sans = append(sans, uri.String())
+	}
+	for _, san := range sans {
+		for _, allowed := range r.cfg.AllowedSANs {
+			if matchSAN(allowed, san) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("tls: peer certificate SANs %v are not allowed", sans)
+}
+
+// matchSAN pattern为"*.example.com"时匹配"a.example.com" 但不匹配"a.b.example.com"
+func matchSAN(pattern, san string) bool {
+	if strings.EqualFold(pattern, san) {
+		return true
+	}
+	suffix, ok := strings.CutPrefix(pattern, "*.")
+	if !ok {
+		return false
+	}
+	label, rest, ok := strings.Cut(san, ".")
+	return ok && label != "" && strings.EqualFold(rest, suffix)
+}
+
+// SetTLS rpc服务与到其他节点的连接都使用TLS 集群中所有节点需要一起开启
+// 需在SetPeers/Start之前调用
+func (s *server) SetTLS(cfg TLSConfig) error {
+	r, err := newCertReloader(cfg)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r.logger = s.log()
+	s.tls = r
+	s.resetPoolLocked(r.dial)
+	return nil
+}
+
+// SetTLS 使Client以TLS连接节点 Client将使用自己的连接池 需在第一次请求之前调用
+func (c *Client) SetTLS(cfg TLSConfig) error {
+	r, err := newCertReloader(cfg)
+	if err != nil {
+		return err
+	}
+	c.pool = newConnPool(nil, 0)
+	c.pool.creds = r.creds
+	return nil
+}
@@ -0,0 +1,256 @@
+package geecache
+
+import (
+	"GeeCache/geecache/discovery"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testCA 在测试中签发证书
+type testCA struct {
+	dir    string
+	cert   *x509.Certificate
+	key    *ecdsa.PrivateKey
+	file   string
+	serial int64
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "geecache test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	ca := &testCA{dir: t.TempDir(), cert: cert, key: key, serial: 1}
+	ca.file = filepath.Join(ca.dir, "ca.pem")
+	writePEM(t, ca.file, "CERTIFICATE", der)
+	return ca
+}
+
+// issue 签发SAN为dnsName与127.0.0.1的证书 写入name.pem/name-key.pem
+func (ca *testCA) issue(t *testing.T, name, dnsName string) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca.serial++
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(ca.serial),
+		Subject:      pkix.Name{CommonName: dnsName},
+		DNSNames:     []string{dnsName},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile = filepath.Join(ca.dir, name+".pem")
+	keyFile = filepath.Join(ca.dir, name+"-key.pem")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+	return certFile, keyFile
+}
+
+func writePEM(t *testing.T, file, typ string, der []byte) {
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (ca *testCA) config(t *testing.T, name, dnsName string) TLSConfig {
+	certFile, keyFile := ca.issue(t, name, dnsName)
+	return TLSConfig{
+		CertFile:    certFile,
+		KeyFile:     keyFile,
+		CAFile:      ca.file,
+		Mutual:      true,
+		AllowedSANs: []string{"*.geecache"},
+	}
+}
+
+func TestTLSCluster(t *testing.T) {
+	ca := newTestCA(t)
+	d := discovery.NewMemory()
+	var originA, originB int32
+	gA := NewGroup("tls", 2<<10, countingGetter(&originA))
+	gB := NewGroup("tls", 2<<10, countingGetter(&originB))
+
+	node := func(name string, g *Group) *server {
+		svr, err := NewServer(freeAddr(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := svr.SetTLS(ca.config(t, name, name+".geecache")); err != nil {
+			t.Fatal(err)
+		}
+		svr.SetDiscovery(d)
+		svr.SetGroups(GroupMap{"tls": g})
+		g.RegisterSvr(svr)
+		go svr.Start()
+		t.Cleanup(svr.Stop)
+		return svr
+	}
+	a := node("a", gA)
+	b := node("b", gB)
+	waitFor(t, "membership", func() bool {
+		return len(a.ListPeers()) == 1 && len(b.ListPeers()) == 1
+	})
+
+	// 节点之间通过mTLS获取
+	key := ""
+	for i := 0; key == ""; i++ {
+		if k := fmt.Sprintf("key%d", i); a.owner(k) == b.addr {
+			key = k
+		}
+	}
+	if v, err := gA.Get(key); err != nil || v.String() != "value-"+key {
+		t.Fatalf("get %s through TLS: %s %v", key, v, err)
+	}
+	if atomic.LoadInt32(&originA) != 0 || atomic.LoadInt32(&originB) != 1 {
+		t.Fatalf("%s should be loaded by its owner B", key)
+	}
+
+	fetch := func(dial dialFunc) error {
+		pool := newConnPool(dial, 0)
+		defer pool.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+		_, err := (&Client{name: b.addr, pool: pool}).FetchContext(ctx, "tls", key)
+		return err
+	}
+	withCert := func(cfg TLSConfig) dialFunc {
+		r, err := newCertReloader(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r.dial
+	}
+	if err := fetch(withCert(ca.config(t, "client", "client.geecache"))); err != nil {
+		t.Fatalf("client with an allowed certificate: %v", err)
+	}
+	if err := fetch(withCert(ca.config(t, "intruder", "intruder.example"))); err == nil {
+		t.Fatal("client SAN outside the allow-list should be rejected")
+	}
+	if err := fetch(directDial); err == nil {
+		t.Fatal("plaintext client should be rejected")
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	noCert := func(ctx context.Context, target string) (*grpc.ClientConn, error) {
+		return grpc.DialContext(ctx, target,
+			grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{RootCAs: roots})),
+			grpc.WithBlock(),
+		)
+	}
+	if err := fetch(noCert); err == nil {
+		t.Fatal("client without a certificate should be rejected")
+	}
+}
+
+func TestCertReload(t *testing.T) {
+	ca := newTestCA(t)
+	cfg := ca.config(t, "node", "node.geecache")
+	cfg.ReloadInterval = time.Minute
+	r, err := newCertReloader(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	r.now = func() time.Time { return now }
+	serial := func() int64 {
+		cert, _ := r.current()
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return leaf.SerialNumber.Int64()
+	}
+	touch := func() {
+		future := time.Now().Add(time.Duration(ca.serial) * time.Second)
+		for _, f := range []string{cfg.CertFile, cfg.KeyFile} {
+			if err := os.Chtimes(f, future, future); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	first := serial()
+
+	// 轮换证书 下一次检查时生效
+	ca.issue(t, "node", "node.geecache")
+	touch()
+	if serial() != first {
+		t.Fatal("certificate should not be reloaded before ReloadInterval")
+	}
+	now = now.Add(time.Minute)
+	rotated := serial()
+	if rotated == first {
+		t.Fatal("rotated certificate should be reloaded")
+	}
+
+	// 写入损坏的文件时继续使用旧证书
+	if err := os.WriteFile(cfg.CertFile, []byte("broken"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	touch()
+	now = now.Add(time.Minute)
+	if serial() != rotated {
+		t.Fatal("broken certificate should keep the previous one")
+	}
+}
+
+func TestMatchSAN(t *testing.T) {
+	cases := []struct {
+		pattern, san string
+		match        bool
+	}{
+		{"a.geecache", "a.geecache", true},
+		{"a.geecache", "b.geecache", false},
+		{"*.geecache", "a.geecache", true},
+		{"*.geecache", "A.GEECACHE", true},
+		{"*.geecache", "a.b.geecache", false},
+		{"*.geecache", "geecache", false},
+		{"127.0.0.1", "127.0.0.1", true},
+	}
+	for _, c := range cases {
+		if got := matchSAN(c.pattern, c.san); got != c.match {
+			t.Errorf("matchSAN(%q, %q) = %v", c.pattern, c.san, got)
+		}
+	}
+}
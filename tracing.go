@@ -0,0 +1,314 @@
+package geecache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"path"
+	"sync"
+	"time"
+)
+
+// Tracer 创建span 并在节点之间通过grpc metadata传播trace上下文
+// 接口与OpenTelemetry的概念一一对应 接入时只需一层很薄的适配:
+//
+//	Start   -> trace.Tracer.Start 并用attribute.String等转换attrs
+//	Inject  -> propagation.TextMapPropagator.Inject
+//	Extract -> propagation.TextMapPropagator.Extract
+//
+// Carrier的方法与propagation.TextMapCarrier相同 可以直接传给propagator
+// Recorder是在内存中记录span的实现 用于测试
+type Tracer interface {
+	// Start 创建ctx中span的子span attrs为键值对
+	Start(ctx context.Context, name string, attrs ...interface{}) (context.Context, Span)
+	// Inject 将ctx中的trace上下文写入carrier
+	Inject(ctx context.Context, carrier Carrier)
+	// Extract 从carrier读出trace上下文 返回携带它的ctx
+	Extract(ctx context.Context, carrier Carrier) context.Context
+}
+
+// Span 一次操作 必须调用End
+type Span interface {
+	SetAttributes(attrs ...interface{})
+	RecordError(err error)
+	End()
+}
+
+// Carrier trace上下文的载体 rpc中为grpc metadata
+type Carrier interface {
+	Get(key string) string
+	Set(key string, value string)
+	Keys() []string
+}
+
+// span名
+const (
+	SpanGet        = "geecache.Get"        // Group.Get 包括查找缓存
+	SpanLoad       = "geecache.load"       // 未命中后的加载 包括在singleflight中等待
+	SpanFetch      = "geecache.Fetch"      // 从远端节点获取一个key
+	SpanFetchMany  = "geecache.FetchMany"  // 从远端节点批量获取
+	SpanGetLocally = "geecache.getLocally" // 调用Getter
+	SpanServer     = "geecache.server/"    // server处理rpc 后接方法名 如geecache.server/Get
+)
+
+// WithTracer 为Group.Get、load、远端获取与Getter创建span
+func WithTracer(t Tracer) GroupOption {
+	return func(g *Group) {
+		g.tracer = t
+	}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(attrs ...interface{}) {}
+func (noopSpan) RecordError(err error)              {}
+func (noopSpan) End()                               {}
+
+// startSpan 创建带有group属性的span 未设置tracer时返回noopSpan
+func (g *Group) startSpan(ctx context.Context, name string, attrs ...interface{}) (context.Context, Span) {
+	if g.tracer == nil {
+		return ctx, noopSpan{}
+	}
+	return g.tracer.Start(withTracer(ctx, g.tracer), name, append([]interface{}{"group", g.name}, attrs...)...)
+}
+
+type tracerKey struct{}
+
+// withTracer 记录创建ctx中span的Tracer 发出rpc时由它传播trace上下文
+func withTracer(ctx context.Context, t Tracer) context.Context {
+	return context.WithValue(ctx, tracerKey{}, t)
+}
+
+func tracerFromContext(ctx context.Context) Tracer {
+	t, _ := ctx.Value(tracerKey{}).(Tracer)
+	return t
+}
+
+// extractTrace 以Group的Tracer从rpc的metadata中恢复trace上下文
+// server设置了Tracer时拦截器已经恢复过 只在Group上设置WithTracer时跨节点的span同样属于一个trace
+func (g *Group) extractTrace(ctx context.Context) context.Context {
+	if g.tracer == nil || tracerFromContext(ctx) != nil {
+		return ctx
+	}
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx
+	}
+	return withTracer(g.tracer.Extract(ctx, metadataCarrier(md)), g.tracer)
+}
+
+// endSpan 记录错误后结束span
+func endSpan(span Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+// metadataCarrier 以grpc metadata作为Carrier
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	if values := metadata.MD(c).Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func (c metadataCarrier) Set(key string, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// injectTrace 将ctx中的trace上下文写入发出的rpc的metadata
+// 优先使用创建ctx中span的Tracer(如Group的WithTracer) 没有时使用t
+func injectTrace(ctx context.Context, t Tracer) context.Context {
+	if ct := tracerFromContext(ctx); ct != nil {
+		t = ct
+	}
+	if t == nil {
+		return ctx
+	}
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if ok {
+		md = md.Copy()
+	} else {
+		md = metadata.MD{}
+	}
+	t.Inject(ctx, metadataCarrier(md))
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// SetTracer 从rpc的metadata中恢复trace上下文并为每个rpc创建span
+// 访问其他节点时同样传播trace上下文 需在SetPeers/Start之前调用
+func (s *server) SetTracer(t Tracer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tracer = t
+}
+
+// startRPCSpan 以rpc携带的trace上下文为父span
+func (s *server) startRPCSpan(ctx context.Context, fullMethod string) (context.Context, Span) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx = s.tracer.Extract(ctx, metadataCarrier(md))
+	return s.tracer.Start(withTracer(ctx, s.tracer), SpanServer+path.Base(fullMethod), "addr", s.addr)
+}
+
+func (s *server) traceUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, span := s.startRPCSpan(ctx, info.FullMethod)
+	resp, err := handler(ctx, req)
+	endSpan(span, err)
+	return resp, err
+}
+
+func (s *server) traceStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, span := s.startRPCSpan(ss.Context(), info.FullMethod)
+	err := handler(srv, &tracedStream{ServerStream: ss, ctx: ctx})
+	endSpan(span, err)
+	return err
+}
+
+type tracedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (t *tracedStream) Context() context.Context {
+	return t.ctx
+}
+
+// RecordedSpan Recorder记录的一个已结束的span
+type RecordedSpan struct {
+	Name     string
+	TraceID  string
+	SpanID   string
+	ParentID string // 为空表示根span
+	Start    time.Time
+	End      time.Time
+	Attrs    map[string]interface{}
+	Err      error
+}
+
+// Recorder 在内存中记录已结束的span 用于测试
+// 以W3C traceparent头传播trace上下文
+type Recorder struct {
+	mu    sync.Mutex
+	spans []RecordedSpan
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+const traceparentHeader = "traceparent"
+
+// spanContext 当前span的标识 保存在ctx中
+type spanContext struct {
+	traceID, spanID string
+}
+
+type spanContextKey struct{}
+
+func (r *Recorder) Start(ctx context.Context, name string, attrs ...interface{}) (context.Context, Span) {
+	parent, _ := ctx.Value(spanContextKey{}).(spanContext)
+	traceID := parent.traceID
+	if traceID == "" {
+		traceID = randomID(16)
+	}
+	span := &recordedSpan{r: r, data: RecordedSpan{
+		Name:     name,
+		TraceID:  traceID,
+		SpanID:   randomID(8),
+		ParentID: parent.spanID,
+		Start:    time.Now(),
+		Attrs:    make(map[string]interface{}),
+	}}
+	span.SetAttributes(attrs...)
+	return context.WithValue(ctx, spanContextKey{}, spanContext{traceID: traceID, spanID: span.data.SpanID}), span
+}
+
+func (r *Recorder) Inject(ctx context.Context, carrier Carrier) {
+	if sc, ok := ctx.Value(spanContextKey{}).(spanContext); ok {
+		carrier.Set(traceparentHeader, fmt.Sprintf("00-%s-%s-01", sc.traceID, sc.spanID))
+	}
+}
+
+func (r *Recorder) Extract(ctx context.Context, carrier Carrier) context.Context {
+	var traceID, spanID string
+	// 00-<32位trace id>-<16位span id>-<flags>
+	if _, err := fmt.Sscanf(carrier.Get(traceparentHeader), "00-%32s-%16s-", &traceID, &spanID); err != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, spanContextKey{}, spanContext{traceID: traceID, spanID: spanID})
+}
+
+// Spans 返回已结束的span 按结束的先后顺序
+func (r *Recorder) Spans() []RecordedSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]RecordedSpan(nil), r.spans...)
+}
+
+// Reset 清空已记录的span
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = nil
+}
+
+type recordedSpan struct {
+	r    *Recorder
+	mu   sync.Mutex
+	done bool
+	data RecordedSpan
+}
+
+func (s *recordedSpan) SetAttributes(attrs ...interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i+1 < len(attrs); i += 2 {
+		s.data.Attrs[fmt.Sprint(attrs[i])] = attrs[i+1]
+	}
+}
+
+func (s *recordedSpan) RecordError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Err = err
+}
+
+// End 重复调用时只记录一次
+func (s *recordedSpan) End() {
+	s.mu.Lock()
+	if s.done {
+		s.mu.Unlock()
+		return
+	}
+	s.done = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	s.r.spans = append(s.r.spans, data)
+}
+
+func randomID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+var _ Tracer = (*Recorder)(nil)
+var _ Carrier = metadataCarrier(nil)
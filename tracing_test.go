@@ -0,0 +1,84 @@
+package geecache
+
+import (
+	"fmt"
+	"testing"
+)
+
+// traceCluster 启动两个以rec记录span的节点 返回A上的Group以及owner为B的key
+func traceCluster(t *testing.T, addrA, addrB string, rec *Recorder, setup ...func(*server)) (*Group, string, string) {
+	var originA, originB int32
+	gA := NewGroup("trace", 1<<20, countingGetter(&originA), WithTracer(rec))
+	gB := NewGroup("trace", 1<<20, countingGetter(&originB), WithTracer(rec))
+
+	cluster := newBufNet()
+	a := cluster.node(t, addrA, map[string]*Group{"trace": gA}, setup...)
+	b := cluster.node(t, addrB, map[string]*Group{"trace": gB}, setup...)
+	a.SetPeers(addrA, addrB)
+	b.SetPeers(addrA, addrB)
+	gA.RegisterSvr(a)
+	gB.RegisterSvr(b)
+
+	var remote, local string
+	for i := 0; remote == "" || local == ""; i++ {
+		key := fmt.Sprintf("key%d", i)
+		if a.owner(key) == addrB {
+			remote = key
+		} else {
+			local = key
+		}
+	}
+	return gA, remote, local
+}
+
+// expectSpanChain 所有span属于同一个trace 并按names的顺序依次嵌套
+func expectSpanChain(t *testing.T, spans []RecordedSpan, names ...string) {
+	t.Helper()
+	children := make(map[string][]RecordedSpan)
+	for _, span := range spans {
+		if span.TraceID != spans[0].TraceID {
+			t.Fatalf("span %s is not in the same trace", span.Name)
+		}
+		children[span.ParentID] = append(children[span.ParentID], span)
+	}
+	parent := ""
+	for _, name := range names {
+		if len(children[parent]) != 1 || children[parent][0].Name != name {
+			t.Fatalf("expect %s under %q, got %+v", name, parent, children[parent])
+		}
+		parent = children[parent][0].SpanID
+	}
+	if len(children[parent]) != 0 {
+		t.Fatalf("%s should be the innermost span, got %+v", names[len(names)-1], children[parent])
+	}
+}
+
+func TestTracePropagation(t *testing.T) {
+	rec := NewRecorder()
+	gA, remote, local := traceCluster(t, "127.0.0.1:9401", "127.0.0.1:9402", rec, func(s *server) { s.SetTracer(rec) })
+
+	// A上的请求经过B 所有span属于同一个trace 并依次嵌套
+	if _, err := gA.Get(remote); err != nil {
+		t.Fatal(err)
+	}
+	expectSpanChain(t, rec.Spans(), SpanGet, SpanLoad, SpanFetch, SpanServer+"Get", SpanGet, SpanLoad, SpanGetLocally)
+
+	// 命中缓存时没有load
+	gA.Get(local)
+	rec.Reset()
+	gA.Get(local)
+	spans := rec.Spans()
+	if len(spans) != 1 || spans[0].Name != SpanGet || spans[0].Attrs["hit"] != true || spans[0].Attrs["key"] != local {
+		t.Fatalf("expect a single cache hit span, got %+v", spans)
+	}
+}
+
+func TestGroupTracePropagation(t *testing.T) {
+	// 只在Group上设置Tracer 没有server的span 但trace上下文同样跨节点传播
+	rec := NewRecorder()
+	gA, remote, _ := traceCluster(t, "127.0.0.1:9411", "127.0.0.1:9412", rec)
+	if _, err := gA.Get(remote); err != nil {
+		t.Fatal(err)
+	}
+	expectSpanChain(t, rec.Spans(), SpanGet, SpanLoad, SpanFetch, SpanGet, SpanLoad, SpanGetLocally)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"runtime"
 	"strings"
+	"time"
 )
 
 // 显示错误时运行栈堆
@@ -32,3 +33,18 @@ func validPeerAddr(addr string) bool {
 	}
 	return true
 }
+
+// rpc中过期时间以UnixNano传输 0表示永不过期
+func expireToUnixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func expireFromUnixNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}